@@ -0,0 +1,39 @@
+// scale-emulator is a stand-in CAS CL-series label scale for trying the PLU sync without hardware.
+// It answers the subset of the CL Ethernet protocol the server uses (see internal/scale/cas_network.go),
+// keeps its PLU memory in RAM and prints every change. Register it as a scale with protocol "cas".
+//
+//	go run ./cmd/scale-emulator -addr :20304
+//	go run ./cmd/scale-emulator -addr :20305 -capacity 2 -refuse 00008
+package main
+
+import (
+	"flag"
+	"log"
+	"net"
+	"strings"
+
+	"go-pos-agent/internal/scale"
+)
+
+func main() {
+	addr := flag.String("addr", ":20304", "address to listen on")
+	capacity := flag.Int("capacity", 0, "maximum PLUs the scale can hold (0 = unlimited); writes beyond it are refused")
+	refuse := flag.String("refuse", "", "comma-separated item codes to refuse, to simulate a scale rejecting a PLU")
+	flag.Parse()
+
+	var codes []string
+	for _, code := range strings.Split(*refuse, ",") {
+		if code = strings.TrimSpace(code); code != "" {
+			codes = append(codes, code)
+		}
+	}
+	standIn := scale.NewStandIn(*capacity, codes...)
+	standIn.Logf = log.Printf
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("⚖️ Scale emulator listening on %s", *addr)
+	log.Fatal(standIn.Serve(listener))
+}
@@ -8,6 +8,7 @@ import (
 	"go-pos-agent/internal/database"
 	"go-pos-agent/internal/handlers"
 	"go-pos-agent/internal/middleware"
+	"go-pos-agent/internal/utils"
 
 	"github.com/gin-contrib/cors" // <--- 2. ADD THIS (The Bridge Library)
 	"github.com/gin-gonic/gin"
@@ -27,6 +28,9 @@ func main() {
 	go handlers.RetryFailedUploads()
 	// --------------------------------------------------------------
 
+	// --- NEW: Checkout weighing scale (only if TILL_SCALE_PORT is set in .env) ---
+	handlers.StartTillScale()
+
 	// --- NEW: BACKGROUND BACKUP ENGINE ---
 	// 1. Hourly Auto-Backup
 	go func() {
@@ -43,6 +47,34 @@ func main() {
 			handlers.CleanupOldAutoBackups()
 		}
 	}()
+
+	// 3. Scheduled Price Changes (checked every minute)
+	go func() {
+		priceTicker := time.NewTicker(1 * time.Minute)
+		for range priceTicker.C {
+			handlers.ApplyScheduledPriceChanges()
+		}
+	}()
+
+	// 4. Daily Ledger Drift Check (report only, corrections are posted by a manager)
+	go func() {
+		driftTicker := time.NewTicker(24 * time.Hour)
+		for range driftTicker.C {
+			handlers.RunLedgerDriftCheck()
+		}
+	}()
+
+	// 5. Nightly PDF Archive of Z-reports, valuation and expenses at 02:30 (also catches up on start-up)
+	go func() {
+		handlers.ArchiveDailyReports()
+		utils.RunDailyAt(2, 30, handlers.ArchiveDailyReports)
+	}()
+
+	// 6. Daily Sales Summaries at 02:00 (backfills on the first start, then re-checks the last week every night)
+	go func() {
+		handlers.RefreshDailySummaries()
+		utils.RunDailyAt(2, 0, handlers.RefreshDailySummaries)
+	}()
 	// -------------------------------------
 
 	r := gin.Default()
@@ -84,6 +116,13 @@ func main() {
 		api.GET("/products", handlers.GetProducts)
 		api.POST("/checkout", handlers.ProcessSale)
 		api.GET("/products/scan/:barcode", handlers.ScanProduct)
+		api.GET("/categories", handlers.GetCategories)
+
+		// Checkout weighing scale (loose produce weighed at the till)
+		api.GET("/till-scale/weight", handlers.GetLiveWeight)
+		api.POST("/till-scale/tare", handlers.TareTillScale)
+		api.DELETE("/till-scale/tare", handlers.ClearTillScaleTare)
+
 		// --- NEW: SMART SECURITY ROUTES (Task 2.4) ---
 		security := api.Group("/security")
 		// --- ADD THIS NEW LINE ---
@@ -95,6 +134,10 @@ func main() {
 		// --- Task A3: Receipt Uploads ---
 		api.POST("/expenses/:id/receipt", handlers.UploadExpenseReceipt)
 
+		// --- NEW: Wastage & Shrinkage Write-Offs ---
+		api.POST("/stock/adjustments", handlers.CreateStockAdjustment)
+		api.POST("/stock/adjustments/:id/photo", handlers.UploadAdjustmentPhoto)
+
 		// --- NEW: TILL MANAGEMENT (Shift Logs) ---
 		api.GET("/settings", handlers.GetStoreSettings)
 		api.GET("/shift/active", handlers.GetActiveShift)
@@ -121,7 +164,56 @@ func main() {
 			management.POST("/upload", handlers.UploadImage)
 			management.POST("/products", handlers.AddProduct)
 			management.PUT("/products/:id", handlers.UpdateProduct)
+			management.POST("/products/import", handlers.ImportProducts) // Bulk .xlsx/.csv import (dry-run by default)
+
+			// Category Management
+			management.POST("/categories", handlers.CreateCategory)
+			management.PUT("/categories/:id", handlers.UpdateCategory)
+
+			// Price History & Scheduled Prices
+			management.GET("/products/:id/price-history", handlers.GetPriceHistory)
+			management.POST("/products/:id/scheduled-prices", handlers.SchedulePriceChange)
+			management.GET("/scheduled-prices", handlers.GetScheduledPriceChanges)
+			management.DELETE("/scheduled-prices/:id", handlers.CancelScheduledPriceChange)
 			management.GET("/reports/valuation", handlers.GetStockValuation) // Inventory Report
+
+			// Shelf Labels (ESC/POS to LABEL_PRINTER, or an A4 PDF sheet)
+			management.POST("/labels/print", handlers.PrintShelfLabels)
+			management.POST("/labels/pdf", handlers.DownloadShelfLabelSheet)
+			management.GET("/products/:id/barcode.png", handlers.GetProductBarcodeImage)
+
+			// Write-Off Approvals & Shrinkage
+			management.GET("/stock/adjustments", handlers.GetStockAdjustments)
+			management.POST("/stock/adjustments/:id/approve", handlers.ApproveStockAdjustment)
+			management.POST("/stock/adjustments/:id/reject", handlers.RejectStockAdjustment)
+			management.GET("/reports/shrinkage", handlers.GetShrinkageReport)
+			management.GET("/reports/inventory-analytics", handlers.GetInventoryAnalytics) // ABC classes, dead stock, days of cover
+
+			// Stock Ledger & Point-in-Time Stock
+			management.GET("/stock/ledger", handlers.GetStockLedger)
+			management.GET("/stock/as-of", handlers.GetStockAsOf)
+			management.GET("/stock/reconciliation", handlers.GetLedgerReconciliation)
+			management.POST("/stock/reconciliation/apply", handlers.ApplyLedgerReconciliation)
+
+			// Locations & Inter-Store Transfers (draft -> dispatch -> receive)
+			management.GET("/locations", handlers.GetLocations)
+			management.GET("/locations/:id/stock", handlers.GetLocationStock)
+			management.POST("/locations/:id/count", handlers.CountLocationStock)
+			management.GET("/transfers", handlers.GetStockTransfers)
+			management.GET("/transfers/:id", handlers.GetStockTransfer)
+			management.POST("/transfers", handlers.CreateStockTransfer)
+			management.POST("/transfers/:id/dispatch", handlers.DispatchStockTransfer)
+			management.POST("/transfers/:id/receive", handlers.ReceiveStockTransfer)
+			management.POST("/transfers/:id/cancel", handlers.CancelStockTransfer)
+
+			// --- NEW: X / Z shift reports ---
+			management.GET("/shift/x-report", handlers.GetXReport)
+			management.POST("/shift/x-report/print", handlers.PrintXReport)
+			management.GET("/reports/z", handlers.GetZReports)
+			management.GET("/reports/z/:number", handlers.GetZReport)
+			management.POST("/reports/z/:number/print", handlers.PrintZReport)
+			management.GET("/reports/archive", handlers.GetReportArchive)
+			management.GET("/reports/archive/:date/:file", handlers.DownloadArchivedReport)
 		}
 
 		// --- ADMIN ONLY (Strict Financials & Deletions) ---
@@ -131,8 +223,15 @@ func main() {
 			// AI is restricted to Admin
 			admin.POST("/ask", handlers.AskAI)
 
-			admin.DELETE("/products/:id", handlers.DeleteProduct) // Supervisors cannot delete
+			admin.DELETE("/products/:id", handlers.DeleteProduct) // Supervisors cannot delete (archives if the product has history)
+			admin.POST("/products/:id/unarchive", handlers.UnarchiveProduct)
+			admin.POST("/products/:id/merge", handlers.MergeProduct)
+			admin.DELETE("/categories/:id", handlers.DeleteCategory) // ?reassign_to=<id> when still in use
 			admin.GET("/reports", handlers.GetSalesReport)
+			admin.GET("/reports/heatmap", handlers.GetSalesHeatmap) // Same filters as /reports
+			admin.GET("/reports/cashiers", handlers.GetCashierReport)
+			admin.GET("/reports/daily-summary", handlers.GetDailySummary)              // ?start=&end= (YYYY-MM-DD)
+			admin.POST("/reports/daily-summary/rebuild", handlers.RebuildDailySummary) // After editing past sales or products
 			admin.GET("/reports/valuation/history", handlers.GetHistoricalValuation)
 
 			// Backup Management Routes
@@ -142,12 +241,39 @@ func main() {
 			admin.GET("/backup/download/:id", handlers.DownloadBackup)
 
 			admin.GET("/products/scale-export", handlers.ExportWeighableProducts)
+			admin.POST("/products/scale-import", handlers.CheckScalePLUFile)
+
+			// Accountant Exports (?format=xlsx|csv)
+			admin.GET("/export/products", handlers.ExportProductCatalogue)
+			admin.GET("/export/ledger", handlers.ExportStockLedger)
+			admin.GET("/export/sales", handlers.ExportSalesLineItems)
+			admin.GET("/export/sales-report", handlers.ExportSalesReport) // Same filters as /reports, no row limits
 
 			// Shop Expenses Management
 			admin.GET("/expenses", handlers.GetExpenses)
+			admin.GET("/reports/pnl", handlers.GetMonthlyPnL)  // ?month=YYYY-MM, with MoM and YoY columns
 			admin.PUT("/expenses/:id", handlers.UpdateExpense) // <--- NEW: Task 2.2 (Edit Expense)
 			admin.DELETE("/expenses/:id", handlers.DeleteExpense)
 
+			admin.PUT("/settings", handlers.UpdateStoreSettings)
+			admin.POST("/locations", handlers.CreateLocation)
+			admin.PUT("/locations/:id", handlers.UpdateLocation)
+
+			// Scale Barcode Layouts (prefix ranges 20-29, price or weight embedded)
+			admin.GET("/settings/scale-barcodes", handlers.GetScaleBarcodeFormats)
+			admin.POST("/settings/scale-barcodes", handlers.CreateScaleBarcodeFormat)
+			admin.PUT("/settings/scale-barcodes/:id", handlers.UpdateScaleBarcodeFormat)
+			admin.DELETE("/settings/scale-barcodes/:id", handlers.DeleteScaleBarcodeFormat)
+
+			// Networked Label Scales (PLUs pushed over TCP, only changes are sent)
+			admin.GET("/scales", handlers.GetLabelScales)
+			admin.POST("/scales", handlers.CreateLabelScale)
+			admin.PUT("/scales/:id", handlers.UpdateLabelScale)
+			admin.DELETE("/scales/:id", handlers.DeleteLabelScale)
+			admin.POST("/scales/:id/ping", handlers.PingLabelScale)
+			admin.POST("/scales/:id/sync", handlers.SyncLabelScale)
+			admin.GET("/scales/:id/sync-logs", handlers.GetScaleSyncLogs)
+
 			// --- NEW: User Management Routes ---
 			admin.GET("/users", handlers.GetUsers)
 			admin.POST("/users", handlers.CreateUser)
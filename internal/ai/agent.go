@@ -8,9 +8,12 @@ import (
 
 	"go-pos-agent/internal/database"
 	"go-pos-agent/internal/models"
+	"go-pos-agent/internal/services"
 
 	"github.com/google/generative-ai-go/genai"
 	"google.golang.org/api/option"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 func RunAgent(userMessage string, apiKey string) (string, error) {
@@ -72,7 +75,7 @@ func RunAgent(userMessage string, apiKey string) (string, error) {
 						Properties: map[string]*genai.Schema{
 							"name":           {Type: genai.TypeString, Description: "Name of the product"},
 							"price":          {Type: genai.TypeNumber, Description: "Price of the product"},
-							"category":       {Type: genai.TypeString, Description: "Category (Food, Drink, etc)"},
+							"category":       {Type: genai.TypeString, Description: "Existing category name (Food, Drink, etc)"},
 							"stock_quantity": {Type: genai.TypeInteger, Description: "Initial stock count"},
 						},
 						Required: []string{"name", "price", "category", "stock_quantity"},
@@ -108,7 +111,7 @@ func RunAgent(userMessage string, apiKey string) (string, error) {
 			// TOOL 1: Check Inventory
 			if funcCall.Name == "check_inventory" {
 				var products []models.Product
-				database.DB.Find(&products)
+				database.DB.Where("is_archived = ?", false).Find(&products)
 
 				type SimpleProduct struct {
 					ID    uint    `json:"id"`
@@ -179,16 +182,40 @@ func executeUpdatePrice(ctx context.Context, session *genai.ChatSession, funcCal
 	productID := int(args["product_id"].(float64))
 	newPrice := args["new_price"].(float64)
 
-	result := database.DB.Model(&models.Product{}).Where("id = ?", productID).Update("price", newPrice)
+	// Same rules as a manual edit: the price and its history are saved together or not at all
+	var product models.Product
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&product, productID).Error; err != nil {
+			return fmt.Errorf("Product ID %d not found", productID)
+		}
+		if product.IsArchived {
+			return fmt.Errorf("%s is archived and can't be repriced", product.Name)
+		}
+		if newPrice < 0 {
+			return fmt.Errorf("Price cannot be negative")
+		}
+
+		before := product
+		if err := tx.Model(&product).Update("price", newPrice).Error; err != nil {
+			return fmt.Errorf("Failed to save the new price: %v", err)
+		}
+		// Keep the price history complete even when the AI makes the change
+		if err := services.RecordPriceChange(tx, before, newPrice, before.CostPrice, "AI Agent", 0); err != nil {
+			return fmt.Errorf("Failed to write price history: %v", err)
+		}
+		return nil
+	})
 
-	msg := "Success"
-	if result.RowsAffected == 0 {
-		msg = "Product ID not found"
+	response := map[string]interface{}{"status": "Success", "new_price": newPrice}
+	if err != nil {
+		response = map[string]interface{}{"status": "error", "error": err.Error()}
+	} else if product.IsWeighable {
+		services.TriggerScaleSync(database.DB, "price_update")
 	}
 
 	finalResp, _ := session.SendMessage(ctx, genai.FunctionResponse{
 		Name:     "update_product_price",
-		Response: map[string]interface{}{"status": msg, "new_price": newPrice},
+		Response: response,
 	})
 	return printResponse(finalResp)
 }
@@ -202,7 +229,45 @@ func executeCreateProduct(ctx context.Context, session *genai.ChatSession, funcC
 		StockQuantity: args["stock_quantity"].(float64), // UPGRADED: Float64
 		ImageURL:      "https://via.placeholder.com/150",
 	}
-	database.DB.Create(&newProd)
+
+	// Only existing categories are allowed; tell the model so it can ask the user instead of guessing
+	category, err := services.ResolveCategory(database.DB, newProd.Category)
+	if err != nil {
+		finalResp, _ := session.SendMessage(ctx, genai.FunctionResponse{
+			Name:     "create_product",
+			Response: map[string]interface{}{"status": "error", "error": fmt.Sprintf("Unknown category '%s'. Ask the user to pick an existing category.", newProd.Category)},
+		})
+		return printResponse(finalResp)
+	}
+	newProd.CategoryID = &category.ID
+	newProd.Category = category.Name
+	newProd.IsSSTApplicable = category.DefaultSST
+
+	// Opening stock goes through the inventory service exactly like a manual AddProduct
+	openingStock := newProd.StockQuantity
+	newProd.StockQuantity = 0
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&newProd).Error; err != nil {
+			return err
+		}
+		if openingStock == 0 {
+			return nil
+		}
+		_, err := services.ApplyMovement(tx, services.StockMovement{
+			ProductID:      newProd.ID,
+			Change:         openingStock,
+			Reason:         "Initial Setup",
+			SourceDocument: "AI Agent",
+		})
+		return err
+	})
+	if err != nil {
+		finalResp, _ := session.SendMessage(ctx, genai.FunctionResponse{
+			Name:     "create_product",
+			Response: map[string]interface{}{"status": "error", "error": err.Error()},
+		})
+		return printResponse(finalResp)
+	}
 	finalResp, _ := session.SendMessage(ctx, genai.FunctionResponse{
 		Name:     "create_product",
 		Response: map[string]interface{}{"status": "created", "id": newProd.ID},
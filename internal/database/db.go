@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"go-pos-agent/internal/models"
+	"go-pos-agent/internal/services"
 
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/driver/sqlite"
@@ -72,6 +73,23 @@ func Connect() {
 		&models.ShiftLog{},      // <--- ADD THIS LINE
 		&models.StoreSettings{}, // <--- ADD THIS LINE
 		&models.DrawerActivityLog{},
+		&models.StockAdjustment{},
+		&models.PriceHistory{},
+		&models.ScheduledPriceChange{},
+		&models.Category{},
+		&models.ScaleBarcodeFormat{},
+		&models.LabelScale{},
+		&models.ScalePLUState{},
+		&models.ScaleSyncLog{},
+		&models.Location{},
+		&models.LocationStock{},
+		&models.StockTransfer{},
+		&models.StockTransferItem{},
+		&models.ZReport{},
+		&models.DailyProductSales{},
+		&models.DailyCategorySales{},
+		&models.DailyTenderSales{},
+		&models.DailyCashierSales{},
 	)
 	if err != nil {
 		log.Fatal("❌ Failed to migrate database:", err)
@@ -81,6 +99,15 @@ func Connect() {
 
 	// 5. Seed Default Users if empty
 	seedInitialUsers()
+
+	// 6. Move legacy free-text categories into the categories table
+	migrateCategories()
+
+	// 7. Put all existing stock at a default location
+	migrateLocations()
+
+	// 8. Sync state from before scales had a protocol has no PLU address to delete by: forget it, the next sync re-sends
+	DB.Where("hotkey = 0").Delete(&models.ScalePLUState{})
 }
 
 func seedInitialUsers() {
@@ -133,9 +160,85 @@ func seedInitialUsers() {
 	DB.Model(&models.StoreSettings{}).Count(&settingsCount)
 	if settingsCount == 0 {
 		defaultSettings := models.StoreSettings{
-			EnableShiftTracking: true,
+			EnableShiftTracking:       true,
+			WriteOffApprovalThreshold: 50,
+			NegativeStockPolicy:       "block",
+			InternalBarcodePrefix:     "29",
 		}
 		DB.Create(&defaultSettings)
 		log.Println("✅ Default Store Settings seeded")
 	}
+
+	// 4. Seed the classic 20/21 price-embedded scale label (what the scanner always assumed)
+	var formatCount int64
+	DB.Model(&models.ScaleBarcodeFormat{}).Count(&formatCount)
+	if formatCount == 0 {
+		DB.Create(&models.ScaleBarcodeFormat{
+			Name:           "Price-embedded (20-21)",
+			PrefixFrom:     20,
+			PrefixTo:       21,
+			ItemCodeLength: 5,
+			ValueType:      "price",
+			Decimals:       2,
+			IsActive:       true,
+		})
+		log.Println("✅ Default Scale Barcode Format seeded")
+	}
+}
+
+// migrateCategories links every product that still has only a free-text category to a Category row.
+// Names are matched case-insensitively and trimmed, so "drinks " and "Drinks" collapse into one category.
+// Safe to run on every start: products that already have a category_id are skipped.
+func migrateCategories() {
+	var products []models.Product
+	DB.Where("category_id IS NULL AND TRIM(category) <> ''").Find(&products)
+	if len(products) == 0 {
+		return
+	}
+
+	migrated := 0
+	for _, p := range products {
+		category, err := services.EnsureCategory(DB, p.Category)
+		if err != nil {
+			log.Printf("⚠️ Category migration: could not link product #%d (%q): %v", p.ID, p.Category, err)
+			continue
+		}
+
+		// Normalize the display copy to the canonical spelling
+		DB.Model(&models.Product{}).Where("id = ?", p.ID).Updates(map[string]interface{}{
+			"category_id": category.ID,
+			"category":    category.Name,
+		})
+		migrated++
+	}
+
+	log.Printf("✅ Category migration: linked %d products to categories", migrated)
+}
+
+// migrateLocations creates the default "Shop Floor" location on first run and places all existing
+// stock (and ledger history) there, so per-location balances add up to Product.StockQuantity.
+func migrateLocations() {
+	var count int64
+	DB.Model(&models.Location{}).Count(&count)
+	if count > 0 {
+		return
+	}
+
+	shopFloor := models.Location{Name: "Shop Floor", IsDefault: true, IsActive: true}
+	if err := DB.Create(&shopFloor).Error; err != nil {
+		log.Printf("⚠️ Location migration: could not create default location: %v", err)
+		return
+	}
+
+	var products []models.Product
+	DB.Where("stock_quantity <> 0").Find(&products)
+	for _, p := range products {
+		DB.Create(&models.LocationStock{LocationID: shopFloor.ID, ProductID: p.ID, Quantity: p.StockQuantity, UpdatedAt: time.Now()})
+	}
+
+	// Old movements all happened at the only place stock was kept
+	DB.Model(&models.StockLedger{}).Where("location_id = 0").
+		Updates(map[string]interface{}{"location_id": shopFloor.ID, "location_balance": gorm.Expr("balance")})
+
+	log.Printf("✅ Location migration: created %q with %d stocked products", shopFloor.Name, len(products))
 }
@@ -0,0 +1,301 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"go-pos-agent/internal/database"
+	"go-pos-agent/internal/models"
+	"go-pos-agent/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WriteOffReasons is the fixed list of shrinkage reason codes and their display labels.
+// Keeping this list closed is what lets the shrinkage report tell spoilage from theft.
+var WriteOffReasons = map[string]string{
+	"SPOILAGE":          "Spoilage",
+	"EXPIRED":           "Expired",
+	"BREAKAGE":          "Breakage / Damage",
+	"THEFT":             "Theft",
+	"STAFF_CONSUMPTION": "Staff Consumption",
+	"TRANSIT_LOSS":      "Lost in Transit", // Booked by transfer receipts that arrive short
+	"OTHER":             "Other",
+}
+
+// StockAdjustmentRequest defines the payload for a new write-off
+type StockAdjustmentRequest struct {
+	ProductID  uint    `json:"product_id" binding:"required"`
+	Quantity   float64 `json:"quantity" binding:"required"`
+	ReasonCode string  `json:"reason_code" binding:"required"`
+	Notes      string  `json:"notes"`
+	PhotoURL   string  `json:"photo_url"`
+	LocationID uint    `json:"location_id"` // Where the stock is written off; 0 = the default location
+}
+
+// --- POST: /api/stock/adjustments ---
+// CreateStockAdjustment records a write-off. Small write-offs (or ones raised by a supervisor)
+// hit the stock immediately; anything above the threshold waits for supervisor approval.
+func CreateStockAdjustment(c *gin.Context) {
+	var req StockAdjustmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Product, quantity and reason code are required"})
+		return
+	}
+
+	// 1. Validate the reason code and quantity
+	req.ReasonCode = strings.ToUpper(strings.TrimSpace(req.ReasonCode))
+	if _, ok := WriteOffReasons[req.ReasonCode]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown reason code", "allowed": WriteOffReasons})
+		return
+	}
+	if req.ReasonCode == "OTHER" && strings.TrimSpace(req.Notes) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Notes are required when the reason is OTHER"})
+		return
+	}
+	if req.Quantity <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Quantity must be greater than zero"})
+		return
+	}
+
+	var product models.Product
+	if err := database.DB.First(&product, req.ProductID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+	locationID, err := activeLocationID(database.DB, req.LocationID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot write off stock at this location: " + err.Error()})
+		return
+	}
+
+	userID := c.MustGet("userID").(uint)
+	role, _ := c.Get("role")
+
+	// 2. Freeze the cost at the moment of the write-off so later cost edits don't rewrite history
+	adjustment := models.StockAdjustment{
+		ProductID:   product.ID,
+		Quantity:    req.Quantity,
+		LocationID:  locationID,
+		ReasonCode:  req.ReasonCode,
+		Notes:       req.Notes,
+		PhotoURL:    req.PhotoURL,
+		UnitCost:    product.CostPrice,
+		TotalCost:   req.Quantity * product.CostPrice,
+		Status:      "pending",
+		RequestedBy: userID,
+		CreatedAt:   time.Now(),
+	}
+
+	// 3. Decide if a supervisor needs to sign this off
+	var settings models.StoreSettings
+	database.DB.First(&settings)
+
+	isManager := role == "admin" || role == "supervisor"
+	needsApproval := !isManager && adjustment.TotalCost > settings.WriteOffApprovalThreshold
+
+	if err := database.DB.Create(&adjustment).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record write-off"})
+		return
+	}
+
+	if needsApproval {
+		c.JSON(http.StatusAccepted, gin.H{
+			"message":    fmt.Sprintf("Write-off of RM %.2f is above the RM %.2f limit and is waiting for supervisor approval", adjustment.TotalCost, settings.WriteOffApprovalThreshold),
+			"adjustment": adjustment,
+		})
+		return
+	}
+
+	// 4. Under the threshold: deduct the stock straight away
+	if status, err := applyStockAdjustment(&adjustment, userID); err != nil {
+		database.DB.Delete(&adjustment)
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":    "Write-off recorded successfully",
+		"adjustment": adjustment,
+	})
+}
+
+// applyStockAdjustment marks the write-off approved, deducts the stock and writes the ledger row.
+// It returns the HTTP status to use if anything goes wrong.
+func applyStockAdjustment(adjustment *models.StockAdjustment, approverID uint) (int, error) {
+	tx := database.DB.Begin()
+
+	// 1. Claim the write-off: only one approval (or rejection) can move it out of "pending",
+	// so two supervisors pressing approve at once cannot deduct the stock twice
+	now := time.Now()
+	claim := tx.Model(&models.StockAdjustment{}).Where("id = ? AND status = ?", adjustment.ID, "pending").
+		Updates(map[string]interface{}{"status": "approved", "approved_by": approverID, "approved_at": now})
+	if claim.Error != nil {
+		tx.Rollback()
+		return http.StatusInternalServerError, fmt.Errorf("Failed to approve write-off")
+	}
+	if claim.RowsAffected != 1 {
+		tx.Rollback()
+		return http.StatusConflict, fmt.Errorf("Write-off is no longer pending, reload it")
+	}
+	adjustment.Status = "approved"
+	adjustment.ApprovedBy = &approverID
+	adjustment.ApprovedAt = &now
+
+	// 2. Deduct the stock through the inventory service (locks the row, enforces the
+	// negative-stock policy and writes the ledger; the reason carries the write-off code)
+	_, err := services.ApplyMovement(tx, services.StockMovement{
+		ProductID:      adjustment.ProductID,
+		Change:         -adjustment.Quantity,
+		Reason:         "Write-Off: " + WriteOffReasons[adjustment.ReasonCode],
+		UserID:         approverID,
+		SourceDocument: fmt.Sprintf("ADJ-%d", adjustment.ID),
+		LocationID:     adjustment.LocationID,
+	})
+	if err != nil {
+		tx.Rollback()
+		return stockErrorStatus(err), fmt.Errorf("Cannot write off %.3f: %v", adjustment.Quantity, err)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("Failed to approve write-off")
+	}
+	return http.StatusOK, nil
+}
+
+// --- GET: /api/stock/adjustments ---
+// GetStockAdjustments lists write-offs, optionally filtered by status (e.g., ?status=pending)
+func GetStockAdjustments(c *gin.Context) {
+	var adjustments []models.StockAdjustment
+
+	query := database.DB.Preload("Product").Order("created_at desc")
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	if err := query.Find(&adjustments).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch write-offs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, adjustments)
+}
+
+// --- POST: /api/stock/adjustments/:id/approve ---
+// ApproveStockAdjustment lets a supervisor sign off a pending write-off
+func ApproveStockAdjustment(c *gin.Context) {
+	var adjustment models.StockAdjustment
+	if err := database.DB.First(&adjustment, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Write-off not found"})
+		return
+	}
+
+	if adjustment.Status != "pending" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Write-off has already been " + adjustment.Status})
+		return
+	}
+
+	userID := c.MustGet("userID").(uint)
+	if status, err := applyStockAdjustment(&adjustment, userID); err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	database.DB.Create(&models.AuditLog{
+		UserID:    userID,
+		Action:    "APPROVE_WRITE_OFF",
+		Details:   fmt.Sprintf("Approved write-off #%d (%s, RM %.2f)", adjustment.ID, adjustment.ReasonCode, adjustment.TotalCost),
+		Timestamp: time.Now(),
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Write-off approved", "adjustment": adjustment})
+}
+
+// --- POST: /api/stock/adjustments/:id/reject ---
+// RejectStockAdjustment closes a pending write-off without touching the stock
+func RejectStockAdjustment(c *gin.Context) {
+	var adjustment models.StockAdjustment
+	if err := database.DB.First(&adjustment, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Write-off not found"})
+		return
+	}
+
+	if adjustment.Status != "pending" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Write-off has already been " + adjustment.Status})
+		return
+	}
+
+	// Same claim as approving: whichever of approve/reject lands first wins
+	userID := c.MustGet("userID").(uint)
+	now := time.Now()
+	claim := database.DB.Model(&models.StockAdjustment{}).Where("id = ? AND status = ?", adjustment.ID, "pending").
+		Updates(map[string]interface{}{"status": "rejected", "approved_by": userID, "approved_at": now})
+	if claim.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reject write-off"})
+		return
+	}
+	if claim.RowsAffected != 1 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Write-off is no longer pending, reload it"})
+		return
+	}
+	adjustment.Status = "rejected"
+	adjustment.ApprovedBy = &userID
+	adjustment.ApprovedAt = &now
+
+	database.DB.Create(&models.AuditLog{
+		UserID:    userID,
+		Action:    "REJECT_WRITE_OFF",
+		Details:   fmt.Sprintf("Rejected write-off #%d (%s, RM %.2f)", adjustment.ID, adjustment.ReasonCode, adjustment.TotalCost),
+		Timestamp: now,
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Write-off rejected", "adjustment": adjustment})
+}
+
+// --- POST: /api/stock/adjustments/:id/photo ---
+// UploadAdjustmentPhoto attaches photo evidence (multipart field "photo") to a write-off.
+// Only while it is pending, and only by the staff member who raised it or a supervisor:
+// the photo is what the approver judges it by.
+func UploadAdjustmentPhoto(c *gin.Context) {
+	var adjustment models.StockAdjustment
+	if err := database.DB.First(&adjustment, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Write-off not found"})
+		return
+	}
+	if adjustment.Status != "pending" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Photos can only be attached to a pending write-off"})
+		return
+	}
+	role, _ := c.Get("role")
+	isManager := role == "admin" || role == "supervisor"
+	if !isManager && adjustment.RequestedBy != c.MustGet("userID").(uint) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the staff member who raised this write-off or a supervisor can attach a photo"})
+		return
+	}
+
+	file, err := c.FormFile("photo")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No photo uploaded"})
+		return
+	}
+
+	// Same storage as product images so it is served by the /uploads static route
+	filename := fmt.Sprintf("%d_writeoff_%d_%s", time.Now().Unix(), adjustment.ID, file.Filename)
+	if err := c.SaveUploadedFile(file, "./uploads/"+filename); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save photo"})
+		return
+	}
+
+	baseURL := os.Getenv("BASE_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:8080"
+	}
+
+	adjustment.PhotoURL = baseURL + "/uploads/" + filename
+	database.DB.Model(&adjustment).Update("photo_url", adjustment.PhotoURL)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Photo attached", "url": adjustment.PhotoURL})
+}
@@ -0,0 +1,314 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-pos-agent/internal/database"
+	"go-pos-agent/internal/models"
+	"go-pos-agent/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// CategoryNode is one branch of the category tree returned to the dashboard
+type CategoryNode struct {
+	models.Category
+	ProductCount      int64           `json:"product_count"`       // Products directly in this category
+	TotalProductCount int64           `json:"total_product_count"` // Including every sub-category
+	Children          []*CategoryNode `json:"children"`
+}
+
+// CategoryRequest defines the payload for creating or editing a category
+type CategoryRequest struct {
+	Name         string  `json:"name" binding:"required"`
+	ParentID     *uint   `json:"parent_id"`
+	DefaultSST   bool    `json:"default_sst"`
+	MarginTarget float64 `json:"margin_target"`
+}
+
+// --- GET: /api/categories ---
+// GetCategories returns the category tree with product counts (archived products are not counted)
+func GetCategories(c *gin.Context) {
+	var categories []models.Category
+	if err := database.DB.Order("name asc").Find(&categories).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch categories"})
+		return
+	}
+
+	// 1. Count products per category in one query
+	var counts []struct {
+		CategoryID uint
+		Count      int64
+	}
+	database.DB.Model(&models.Product{}).
+		Select("category_id, COUNT(*) as count").
+		Where("category_id IS NOT NULL AND is_archived = ?", false).
+		Group("category_id").
+		Scan(&counts)
+
+	countByID := make(map[uint]int64)
+	for _, row := range counts {
+		countByID[row.CategoryID] = row.Count
+	}
+
+	// 2. Build the nodes, then hang each one under its parent
+	nodes := make(map[uint]*CategoryNode, len(categories))
+	for _, cat := range categories {
+		nodes[cat.ID] = &CategoryNode{Category: cat, ProductCount: countByID[cat.ID], Children: []*CategoryNode{}}
+	}
+
+	roots := []*CategoryNode{}
+	for _, cat := range categories {
+		node := nodes[cat.ID]
+		if parent, ok := nodes[derefID(cat.ParentID)]; ok && cat.ParentID != nil {
+			parent.Children = append(parent.Children, node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+
+	// 3. Roll the counts up so "Drinks" includes "Soft Drinks"
+	var rollUp func(node *CategoryNode) int64
+	rollUp = func(node *CategoryNode) int64 {
+		node.TotalProductCount = node.ProductCount
+		for _, child := range node.Children {
+			node.TotalProductCount += rollUp(child)
+		}
+		return node.TotalProductCount
+	}
+	for _, root := range roots {
+		rollUp(root)
+	}
+
+	sort.Slice(roots, func(i, j int) bool { return roots[i].Name < roots[j].Name })
+	c.JSON(http.StatusOK, roots)
+}
+
+// --- POST: /api/categories ---
+// CreateCategory adds a new category (optionally under a parent)
+func CreateCategory(c *gin.Context) {
+	var req CategoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Category name is required"})
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Category name is required"})
+		return
+	}
+
+	// 1. Names are unique regardless of case ("Drinks" vs "drinks" is exactly the typo we're preventing)
+	if _, err := services.ResolveCategory(database.DB, req.Name); err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "A category with this name already exists"})
+		return
+	}
+
+	// 2. Parent must exist
+	if req.ParentID != nil {
+		var parent models.Category
+		if err := database.DB.First(&parent, *req.ParentID).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Parent category not found"})
+			return
+		}
+	}
+
+	category := models.Category{
+		Name:         req.Name,
+		ParentID:     req.ParentID,
+		DefaultSST:   req.DefaultSST,
+		MarginTarget: req.MarginTarget,
+	}
+	if err := database.DB.Create(&category).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create category"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, category)
+}
+
+// --- PUT: /api/categories/:id ---
+// UpdateCategory renames or re-parents a category. Renames are copied onto every product in it.
+func UpdateCategory(c *gin.Context) {
+	var category models.Category
+	if err := database.DB.First(&category, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+		return
+	}
+
+	var req CategoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Category name is required"})
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Category name is required"})
+		return
+	}
+
+	// 1. Name clash with a different category
+	if existing, err := services.ResolveCategory(database.DB, req.Name); err == nil && existing.ID != category.ID {
+		c.JSON(http.StatusConflict, gin.H{"error": "A category with this name already exists"})
+		return
+	}
+
+	// 2. Re-parenting must not create a loop (a category can't sit under itself or its own children)
+	if req.ParentID != nil {
+		tree := services.LoadCategoryTree(database.DB)
+		if _, ok := tree[*req.ParentID]; !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Parent category not found"})
+			return
+		}
+		for _, id := range tree.DescendantIDs(category.ID) {
+			if id == *req.ParentID {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "A category cannot be moved under itself or one of its sub-categories"})
+				return
+			}
+		}
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&category).Updates(map[string]interface{}{
+			"name":          req.Name,
+			"parent_id":     req.ParentID,
+			"default_sst":   req.DefaultSST,
+			"margin_target": req.MarginTarget,
+			"updated_at":    time.Now(),
+		}).Error; err != nil {
+			return err
+		}
+
+		// Keep the display copy on products in sync
+		return tx.Model(&models.Product{}).Where("category_id = ?", category.ID).Update("category", req.Name).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update category"})
+		return
+	}
+
+	c.JSON(http.StatusOK, category)
+}
+
+// --- DELETE: /api/categories/:id ---
+// DeleteCategory removes a category. If products or sub-categories still use it, pass
+// ?reassign_to=<id> to move them first; otherwise the delete is refused.
+func DeleteCategory(c *gin.Context) {
+	var category models.Category
+	if err := database.DB.First(&category, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+		return
+	}
+
+	var target *models.Category
+	if reassignStr := c.Query("reassign_to"); reassignStr != "" {
+		reassignID, err := strconv.Atoi(reassignStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid reassign_to category ID"})
+			return
+		}
+
+		var found models.Category
+		if err := database.DB.First(&found, reassignID).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Reassignment category not found"})
+			return
+		}
+
+		// The target can't be the category itself or something that's about to lose its parent
+		tree := services.LoadCategoryTree(database.DB)
+		for _, id := range tree.DescendantIDs(category.ID) {
+			if id == found.ID {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot reassign to the category being deleted or one of its sub-categories"})
+				return
+			}
+		}
+		target = &found
+	}
+
+	var productCount, childCount int64
+	database.DB.Model(&models.Product{}).Where("category_id = ?", category.ID).Count(&productCount)
+	database.DB.Model(&models.Category{}).Where("parent_id = ?", category.ID).Count(&childCount)
+
+	if (productCount > 0 || childCount > 0) && target == nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":          "Category is still in use. Pass ?reassign_to=<category id> to move its products and sub-categories.",
+			"product_count":  productCount,
+			"children_count": childCount,
+		})
+		return
+	}
+
+	userID := c.MustGet("userID").(uint)
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if target != nil {
+			if err := tx.Model(&models.Product{}).Where("category_id = ?", category.ID).
+				Updates(map[string]interface{}{"category_id": target.ID, "category": target.Name}).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&models.Category{}).Where("parent_id = ?", category.ID).Update("parent_id", target.ID).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Delete(&category).Error; err != nil {
+			return err
+		}
+
+		details := fmt.Sprintf("Deleted category '%s'", category.Name)
+		if target != nil {
+			details += fmt.Sprintf(" (%d products and %d sub-categories moved to '%s')", productCount, childCount, target.Name)
+		}
+		return tx.Create(&models.AuditLog{
+			UserID:    userID,
+			Action:    "DELETE_CATEGORY",
+			Details:   details,
+			Timestamp: time.Now(),
+		}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete category"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Category deleted", "products_moved": productCount, "children_moved": childCount})
+}
+
+// resolveProductCategory validates the category sent with a product (by ID, or by name when no ID is given).
+// Returns nil, nil when the product is deliberately left uncategorized.
+func resolveProductCategory(categoryID *uint, name string) (*models.Category, error) {
+	if categoryID != nil {
+		var category models.Category
+		if err := database.DB.First(&category, *categoryID).Error; err != nil {
+			return nil, fmt.Errorf("Category #%d not found", *categoryID)
+		}
+		return &category, nil
+	}
+
+	if strings.TrimSpace(name) == "" {
+		return nil, nil
+	}
+
+	category, err := services.ResolveCategory(database.DB, name)
+	if errors.Is(err, services.ErrUnknownCategory) {
+		return nil, fmt.Errorf("Unknown category '%s'. Create it under Categories first.", name)
+	}
+	return category, err
+}
+
+// derefID turns an optional ID into 0 when missing (0 is never a real row ID)
+func derefID(id *uint) uint {
+	if id == nil {
+		return 0
+	}
+	return *id
+}
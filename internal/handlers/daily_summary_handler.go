@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"go-pos-agent/internal/database"
+	"go-pos-agent/internal/models"
+	"go-pos-agent/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// summaryRefreshDays is how many days before today the nightly job re-checks, to pick up
+// late corrections (product merges, category moves, a checkout whose summary update failed)
+const summaryRefreshDays = 7
+
+// RefreshDailySummaries is the scheduled job behind the daily sales summaries (backfills on first run)
+func RefreshDailySummaries() {
+	services.RefreshDailySummaries(database.DB, summaryRefreshDays)
+}
+
+// --- GET: /api/reports/daily-summary?start=YYYY-MM-DD&end=YYYY-MM-DD ---
+// GetDailySummary returns the stored per-day rows by tender, category and cashier (default: the last 30 days)
+func GetDailySummary(c *gin.Context) {
+	now := time.Now()
+	from, to, ok := summaryDayRange(c, services.SummaryDay(now.AddDate(0, 0, -29)), services.SummaryDay(now))
+	if !ok {
+		return
+	}
+
+	var tenders []models.DailyTenderSales
+	var categories []models.DailyCategorySales
+	var cashiers []models.DailyCashierSales
+	database.DB.Where("day >= ? AND day <= ?", from, to).Order("day asc, payment_method asc").Find(&tenders)
+	database.DB.Where("day >= ? AND day <= ?", from, to).Order("day asc, category_id asc").Find(&categories)
+	database.DB.Where("day >= ? AND day <= ?", from, to).Order("day asc, user_id asc").Find(&cashiers)
+
+	c.JSON(http.StatusOK, gin.H{
+		"start":      from,
+		"end":        to,
+		"ready":      services.SummariesReady(),
+		"tenders":    tenders,
+		"categories": categories,
+		"cashiers":   cashiers,
+	})
+}
+
+// --- POST: /api/reports/daily-summary/rebuild?start=YYYY-MM-DD&end=YYYY-MM-DD ---
+// RebuildDailySummary recomputes the summaries of a date range from the raw sales (default: yesterday)
+func RebuildDailySummary(c *gin.Context) {
+	yesterday := services.SummaryDay(time.Now().AddDate(0, 0, -1))
+	from, to, ok := summaryDayRange(c, yesterday, yesterday)
+	if !ok {
+		return
+	}
+	start, _ := time.ParseInLocation("2006-01-02", from, time.Local)
+	end, _ := time.ParseInLocation("2006-01-02", to, time.Local)
+	if end.Sub(start) > 3*366*24*time.Hour {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Rebuild at most three years at a time"})
+		return
+	}
+
+	days, err := services.RebuildDailySummaries(database.DB, start, end)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rebuild daily summaries"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Daily summaries rebuilt", "start": from, "end": to, "days": days})
+}
+
+// summaryDayRange reads ?start= and ?end= as local dates (YYYY-MM-DD). With only a start, the range is that one day.
+func summaryDayRange(c *gin.Context, defaultFrom, defaultTo string) (string, string, bool) {
+	from, to := defaultFrom, defaultTo
+	if value := c.Query("start"); value != "" {
+		if _, err := time.ParseInLocation("2006-01-02", value, time.Local); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start date, expected YYYY-MM-DD"})
+			return "", "", false
+		}
+		from, to = value, value
+	}
+	if value := c.Query("end"); value != "" {
+		if _, err := time.ParseInLocation("2006-01-02", value, time.Local); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end date, expected YYYY-MM-DD"})
+			return "", "", false
+		}
+		to = value
+	}
+	if to < from {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "End date is before start date"})
+		return "", "", false
+	}
+	return from, to, true
+}
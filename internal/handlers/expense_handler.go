@@ -88,10 +88,8 @@ type ExpenseReport struct {
 	StandingProfit float64          `json:"standing_profit"`
 }
 
-// GetExpenses retrieves expenses and calculates Standing Profit based on Date Filters
+// GetExpenses retrieves expenses and calculates Standing Profit based on Date Filters (?format=pdf for a printable P&L)
 func GetExpenses(c *gin.Context) {
-	var data ExpenseReport
-
 	// 1. Time Filter Logic (Matches Sales Report)
 	timeframe := c.Query("timeframe")
 	customStart := c.Query("customStart")
@@ -115,6 +113,24 @@ func GetExpenses(c *gin.Context) {
 		}
 	}
 
+	data, err := buildExpenseReport(startTime, endTime)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if c.Query("format") == "pdf" {
+		writeExpensePDF(c, data, periodLabel(startTime, endTime))
+		return
+	}
+
+	c.JSON(http.StatusOK, data)
+}
+
+// buildExpenseReport lists the expenses in a period and nets them against that period's gross profit
+func buildExpenseReport(startTime, endTime time.Time) (ExpenseReport, error) {
+	var data ExpenseReport
+
 	// 2. Fetch Expenses for Timeframe
 	expensesQuery := database.DB.Order("date desc")
 	if !startTime.IsZero() {
@@ -125,8 +141,7 @@ func GetExpenses(c *gin.Context) {
 	}
 
 	if err := expensesQuery.Find(&data.Expenses).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch expenses"})
-		return
+		return data, fmt.Errorf("Failed to fetch expenses")
 	}
 
 	// Calculate Total Expenses
@@ -153,7 +168,7 @@ func GetExpenses(c *gin.Context) {
 	// 4. Calculate Current Standing Profit
 	data.StandingProfit = data.GrossProfit - data.TotalExpenses
 
-	c.JSON(http.StatusOK, data)
+	return data, nil
 }
 
 // --- Task 2.2: The "Edit & Replace" System (S1 & S2) ---
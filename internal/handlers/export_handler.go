@@ -0,0 +1,617 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-pos-agent/internal/database"
+	"go-pos-agent/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xuri/excelize/v2"
+)
+
+// tableExporter hides the difference between CSV and .xlsx so every export only has to describe its rows.
+// Rows are pushed one at a time, so large date ranges never sit in memory as a whole.
+type tableExporter interface {
+	StartSheet(name string, headers []string) error
+	WriteRow(values ...interface{}) error
+	Finish() error
+	Discard() // Drops an export that failed half way (frees temp files)
+}
+
+// --- CSV: streams straight into the HTTP response ---
+type csvExporter struct {
+	w       *csv.Writer
+	started bool
+}
+
+func (e *csvExporter) StartSheet(name string, headers []string) error {
+	// A CSV file only has one table; extra sheets are a programming error
+	if e.started {
+		return fmt.Errorf("CSV exports only support a single sheet")
+	}
+	e.started = true
+	return e.w.Write(headers)
+}
+
+func (e *csvExporter) WriteRow(values ...interface{}) error {
+	record := make([]string, len(values))
+	for i, v := range values {
+		record[i] = formatExportValue(v)
+	}
+	return e.w.Write(record)
+}
+
+func (e *csvExporter) Finish() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+func (e *csvExporter) Discard() {}
+
+// --- XLSX: excelize's StreamWriter spills rows to a temp file instead of keeping them in RAM ---
+type xlsxExporter struct {
+	out    io.Writer
+	f      *excelize.File
+	stream *excelize.StreamWriter
+	row    int
+	sheets int
+}
+
+func (e *xlsxExporter) StartSheet(name string, headers []string) error {
+	if err := e.flushSheet(); err != nil {
+		return err
+	}
+
+	// The first sheet re-uses the default "Sheet1", later ones are added
+	if e.sheets == 0 {
+		if err := e.f.SetSheetName("Sheet1", name); err != nil {
+			return err
+		}
+	} else if _, err := e.f.NewSheet(name); err != nil {
+		return err
+	}
+	e.sheets++
+
+	stream, err := e.f.NewStreamWriter(name)
+	if err != nil {
+		return err
+	}
+	e.stream = stream
+	e.row = 0
+
+	headerRow := make([]interface{}, len(headers))
+	for i, h := range headers {
+		headerRow[i] = h
+	}
+	return e.WriteRow(headerRow...)
+}
+
+func (e *xlsxExporter) WriteRow(values ...interface{}) error {
+	e.row++
+	for i, v := range values {
+		if t, ok := v.(time.Time); ok {
+			values[i] = formatExportValue(t)
+		}
+	}
+	cell, _ := excelize.CoordinatesToCellName(1, e.row)
+	return e.stream.SetRow(cell, values)
+}
+
+func (e *xlsxExporter) flushSheet() error {
+	if e.stream == nil {
+		return nil
+	}
+	err := e.stream.Flush()
+	e.stream = nil
+	return err
+}
+
+func (e *xlsxExporter) Finish() error {
+	defer e.f.Close()
+	if err := e.flushSheet(); err != nil {
+		return err
+	}
+	return e.f.Write(e.out)
+}
+
+func (e *xlsxExporter) Discard() {
+	e.f.Close()
+}
+
+// newTableExporter sets the download headers and returns the exporter for ?format=csv|xlsx (default xlsx)
+func newTableExporter(c *gin.Context, baseName string) (tableExporter, error) {
+	format := c.DefaultQuery("format", "xlsx")
+	fileName := fmt.Sprintf("%s_%s.%s", baseName, time.Now().Format("20060102_150405"), format)
+
+	switch format {
+	case "csv":
+		c.Header("Content-Description", "File Transfer")
+		c.Header("Content-Disposition", "attachment; filename="+fileName)
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		return &csvExporter{w: csv.NewWriter(c.Writer)}, nil
+	case "xlsx":
+		c.Header("Content-Description", "File Transfer")
+		c.Header("Content-Disposition", "attachment; filename="+fileName)
+		c.Header("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		return &xlsxExporter{out: c.Writer, f: excelize.NewFile()}, nil
+	default:
+		return nil, fmt.Errorf("Unsupported export format %q (use csv or xlsx)", format)
+	}
+}
+
+// finishExport completes a download, or abandons it on the first error so nobody gets a file that looks
+// complete but is missing rows. A .xlsx only reaches the client in Finish, so a failure before that is a
+// plain 500; a CSV streams as it goes, so once rows are out the connection is cut instead of ending the file.
+func finishExport(c *gin.Context, exporter tableExporter, name string, err error) {
+	if err == nil {
+		if err = exporter.Finish(); err == nil {
+			return
+		}
+	} else {
+		exporter.Discard()
+	}
+	log.Printf("❌ EXPORT: %s stopped: %v", name, err)
+
+	if !c.Writer.Written() {
+		c.Writer.Header().Del("Content-Disposition")
+		c.Writer.Header().Del("Content-Type") // gin keeps a Content-Type already set, so the error would go out as CSV/XLSX
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Export failed, please try again"})
+		return
+	}
+	if conn, _, hijackErr := c.Writer.Hijack(); hijackErr == nil {
+		conn.Close()
+	}
+}
+
+// formatExportValue renders values the same way in both formats (dates as local "YYYY-MM-DD HH:MM:SS")
+func formatExportValue(v interface{}) string {
+	switch val := v.(type) {
+	case time.Time:
+		if val.IsZero() {
+			return ""
+		}
+		return val.Local().Format("2006-01-02 15:04:05")
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+// parseExportRange reads ?start=YYYY-MM-DD&end=YYYY-MM-DD (both inclusive, both optional)
+func parseExportRange(c *gin.Context) (time.Time, time.Time, error) {
+	var start, end time.Time
+
+	if s := c.Query("start"); s != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", s, time.Now().Location())
+		if err != nil {
+			return start, end, fmt.Errorf("Invalid start date, expected YYYY-MM-DD")
+		}
+		start = parsed
+	}
+	if e := c.Query("end"); e != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", e, time.Now().Location())
+		if err != nil {
+			return start, end, fmt.Errorf("Invalid end date, expected YYYY-MM-DD")
+		}
+		end = parsed.Add(24*time.Hour - time.Nanosecond) // Include the whole end day
+	}
+
+	return start, end, nil
+}
+
+// --- GET: /api/export/products ---
+// ExportProductCatalogue downloads the full product list (including archived items) for the accountant
+func ExportProductCatalogue(c *gin.Context) {
+	rows, err := database.DB.Model(&models.Product{}).Order("id asc").Rows()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch products"})
+		return
+	}
+	defer rows.Close()
+
+	exporter, err := newTableExporter(c, "product_catalogue")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = exporter.StartSheet("Products", []string{
+		"ID", "SKU", "Name", "Category", "Price", "Cost Price", "Stock Quantity",
+		"Stock Value (Cost)", "SST", "Weighable", "Gas", "Empty Cylinders", "Archived", "Created At", "Updated At",
+	})
+
+	for err == nil && rows.Next() {
+		var p models.Product
+		if err = database.DB.ScanRows(rows, &p); err != nil {
+			break
+		}
+		err = exporter.WriteRow(
+			p.ID, p.SKU, p.Name, p.Category, p.Price, p.CostPrice, p.StockQuantity,
+			p.StockQuantity*p.CostPrice, p.IsSSTApplicable, p.IsWeighable, p.IsGas, p.EmptyCylinderStock,
+			p.IsArchived, p.CreatedAt, p.UpdatedAt,
+		)
+	}
+	if err == nil {
+		err = rows.Err()
+	}
+
+	finishExport(c, exporter, "product export", err)
+}
+
+// --- GET: /api/export/ledger ---
+// ExportStockLedger downloads every stock movement in the requested date range
+func ExportStockLedger(c *gin.Context) {
+	start, end, err := parseExportRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := database.DB.Table("stock_ledgers").
+		Select("stock_ledgers.id, stock_ledgers.created_at, stock_ledgers.product_id, products.sku, products.name, stock_ledgers.change_amount, stock_ledgers.balance, stock_ledgers.reason, stock_ledgers.user_id, stock_ledgers.source_document, locations.name as location_name, stock_ledgers.location_balance").
+		Joins("LEFT JOIN products ON stock_ledgers.product_id = products.id").
+		Joins("LEFT JOIN locations ON stock_ledgers.location_id = locations.id").
+		Order("stock_ledgers.created_at asc, stock_ledgers.id asc")
+	if locationID := c.Query("location_id"); locationID != "" {
+		query = query.Where("stock_ledgers.location_id = ?", locationID)
+	}
+	if !start.IsZero() {
+		query = query.Where("stock_ledgers.created_at >= ?", start)
+	}
+	if !end.IsZero() {
+		query = query.Where("stock_ledgers.created_at <= ?", end)
+	}
+
+	rows, err := query.Rows()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch stock ledger"})
+		return
+	}
+	defer rows.Close()
+
+	exporter, err := newTableExporter(c, "stock_ledger")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = exporter.StartSheet("Stock Ledger", []string{"Entry ID", "Date", "Product ID", "SKU", "Product", "Change", "Balance", "Reason", "User ID", "Source Document", "Location", "Location Balance"})
+
+	for err == nil && rows.Next() {
+		var entry struct {
+			ID              uint
+			CreatedAt       time.Time
+			ProductID       uint
+			SKU             string
+			Name            string
+			ChangeAmount    float64
+			Balance         float64
+			Reason          string
+			UserID          uint
+			SourceDocument  string
+			LocationName    string
+			LocationBalance float64
+		}
+		if err = database.DB.ScanRows(rows, &entry); err != nil {
+			break
+		}
+		err = exporter.WriteRow(entry.ID, entry.CreatedAt, entry.ProductID, entry.SKU, entry.Name, entry.ChangeAmount, entry.Balance, entry.Reason, entry.UserID, entry.SourceDocument, entry.LocationName, entry.LocationBalance)
+	}
+	if err == nil {
+		err = rows.Err()
+	}
+
+	finishExport(c, exporter, "ledger export", err)
+}
+
+// --- GET: /api/export/sales ---
+// ExportSalesLineItems downloads one row per sold item (with receipt details) in the requested date range
+func ExportSalesLineItems(c *gin.Context) {
+	start, end, err := parseExportRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := database.DB.Table("sale_items").
+		Select("sales.receipt_id, sales.sale_time, sales.user_id, sales.payment_method, sales.status, products.sku, products.name, products.category, sale_items.quantity, sale_items.price_at_sale, sale_items.buy_price_rm").
+		Joins("JOIN sales ON sale_items.sale_id = sales.id").
+		Joins("LEFT JOIN products ON sale_items.product_id = products.id").
+		Order("sales.sale_time asc, sale_items.id asc")
+	if !start.IsZero() {
+		query = query.Where("sales.sale_time >= ?", start)
+	}
+	if !end.IsZero() {
+		query = query.Where("sales.sale_time <= ?", end)
+	}
+
+	rows, err := query.Rows()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sales"})
+		return
+	}
+	defer rows.Close()
+
+	exporter, err := newTableExporter(c, "sales_line_items")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = exporter.StartSheet("Sales Line Items", []string{
+		"Receipt", "Sale Time", "Cashier ID", "Payment Method", "Status", "SKU", "Product", "Category",
+		"Quantity", "Unit Price", "Unit Cost", "Line Total", "Line Profit",
+	})
+
+	for err == nil && rows.Next() {
+		var line struct {
+			ReceiptID     string
+			SaleTime      time.Time
+			UserID        uint
+			PaymentMethod string
+			Status        string
+			SKU           string
+			Name          string
+			Category      string
+			Quantity      float64
+			PriceAtSale   float64
+			BuyPriceRM    float64 `gorm:"column:buy_price_rm"`
+		}
+		if err = database.DB.ScanRows(rows, &line); err != nil {
+			break
+		}
+		err = exporter.WriteRow(
+			line.ReceiptID, line.SaleTime, line.UserID, line.PaymentMethod, line.Status, line.SKU, line.Name, line.Category,
+			line.Quantity, line.PriceAtSale, line.BuyPriceRM,
+			line.Quantity*line.PriceAtSale, line.Quantity*(line.PriceAtSale-line.BuyPriceRM),
+		)
+	}
+	if err == nil {
+		err = rows.Err()
+	}
+
+	finishExport(c, exporter, "sales export", err)
+}
+
+// --- GET: /api/export/sales-report ---
+// ExportSalesReport downloads everything the sales report dashboard shows, for the same filters
+// (timeframe, search, category, productType, paymentMethod) but without the on-screen row limits.
+// .xlsx gets one sheet each for the summary, products, line items, voids and drawer activity;
+// CSV holds a single table, picked with ?sheet=summary|products|line_items|voids|drawer (default line_items).
+func ExportSalesReport(c *gin.Context) {
+	filters := parseSalesReportFilters(c)
+
+	sheets := []struct {
+		key   string
+		write func(tableExporter) error
+	}{
+		{"summary", func(e tableExporter) error { return writeSalesSummarySheet(e, filters) }},
+		{"products", func(e tableExporter) error { return writeSalesProductsSheet(e, filters) }},
+		{"line_items", func(e tableExporter) error { return writeSalesLineItemsSheet(e, filters) }},
+		{"voids", func(e tableExporter) error { return writeVoidsSheet(e, filters) }},
+		{"drawer", func(e tableExporter) error { return writeDrawerActivitySheet(e, filters) }},
+	}
+
+	// CSV only has room for one of them
+	selected := sheets
+	if c.DefaultQuery("format", "xlsx") == "csv" {
+		sheet := c.DefaultQuery("sheet", "line_items")
+		selected = nil
+		for _, s := range sheets {
+			if s.key == sheet {
+				selected = append(selected, s)
+			}
+		}
+		if selected == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "sheet must be summary, products, line_items, voids or drawer"})
+			return
+		}
+	}
+
+	exporter, err := newTableExporter(c, "sales_report")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// A failed sheet stops the whole file: a workbook missing a sheet would look complete
+	for _, s := range selected {
+		if err = s.write(exporter); err != nil {
+			err = fmt.Errorf("%s sheet: %v", s.key, err)
+			break
+		}
+	}
+
+	finishExport(c, exporter, "sales report export", err)
+}
+
+// writeSalesSummarySheet repeats the dashboard totals along with the filters that produced them
+func writeSalesSummarySheet(e tableExporter, f salesReportFilters) error {
+	var revenue, profit float64
+	var orders int64
+	if err := f.lineItems(database.DB).
+		Select("COALESCE(SUM(sale_items.quantity * sale_items.price_at_sale), 0), COALESCE(SUM(sale_items.quantity * (sale_items.price_at_sale - sale_items.buy_price_rm)), 0)").
+		Row().Scan(&revenue, &profit); err != nil {
+		return err
+	}
+	if err := f.sales(database.DB).Where("status = ?", "completed").Count(&orders).Error; err != nil {
+		return err
+	}
+
+	if err := e.StartSheet("Summary", []string{"Item", "Value"}); err != nil {
+		return err
+	}
+	rows := [][]interface{}{
+		{"Period Start", f.Start},
+		{"Period End", f.End},
+		{"Search", f.Search},
+		{"Category", f.Category},
+		{"Product Type", f.ProductType},
+		{"Payment Method", f.PaymentMethod},
+		{"Total Revenue", revenue},
+		{"Total Profit", profit},
+		{"Total Orders", orders},
+		{"Average Basket", averageBasket(revenue, orders)},
+	}
+	for _, row := range rows {
+		if err := e.WriteRow(row...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeSalesProductsSheet is the dashboard's "top selling" list, every product instead of the top 5
+func writeSalesProductsSheet(e tableExporter, f salesReportFilters) error {
+	rows, err := f.lineItems(database.DB).
+		Select("products.sku, products.name as product_name, products.category, SUM(sale_items.quantity) as sold, SUM(sale_items.quantity * sale_items.price_at_sale) as revenue, SUM(sale_items.quantity * (sale_items.price_at_sale - sale_items.buy_price_rm)) as profit").
+		Group("products.id, products.sku, products.name, products.category").
+		Order("sold desc").
+		Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	if err := e.StartSheet("Products", []string{"SKU", "Product", "Category", "Sold", "Revenue", "Profit"}); err != nil {
+		return err
+	}
+	for rows.Next() {
+		var line struct {
+			SKU         string
+			ProductName string
+			Category    string
+			Sold        float64
+			Revenue     float64
+			Profit      float64
+		}
+		if err := database.DB.ScanRows(rows, &line); err != nil {
+			return err
+		}
+		if err := e.WriteRow(line.SKU, line.ProductName, line.Category, line.Sold, line.Revenue, line.Profit); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// writeSalesLineItemsSheet lists every line of every matching sale, like the dashboard's recent sales with items
+func writeSalesLineItemsSheet(e tableExporter, f salesReportFilters) error {
+	rows, err := database.DB.Table("sale_items").
+		Select("sales.receipt_id, sales.sale_time, sales.user_id, users.username, sales.payment_method, sales.status, sales.total_amount, products.sku, products.name, products.category, sale_items.quantity, sale_items.price_at_sale, sale_items.buy_price_rm").
+		Joins("JOIN sales ON sale_items.sale_id = sales.id").
+		Joins("LEFT JOIN products ON sale_items.product_id = products.id").
+		Joins("LEFT JOIN users ON sales.user_id = users.id").
+		Where("sales.id IN (?)", f.sales(database.DB).Select("id")).
+		Order("sales.sale_time desc, sale_items.id asc").
+		Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	if err := e.StartSheet("Line Items", []string{
+		"Receipt", "Sale Time", "Cashier ID", "Cashier", "Payment Method", "Status", "Receipt Total",
+		"SKU", "Product", "Category", "Quantity", "Unit Price", "Unit Cost", "Line Total", "Line Profit",
+	}); err != nil {
+		return err
+	}
+	for rows.Next() {
+		var line struct {
+			ReceiptID     string
+			SaleTime      time.Time
+			UserID        uint
+			Username      string
+			PaymentMethod string
+			Status        string
+			TotalAmount   float64
+			SKU           string
+			Name          string
+			Category      string
+			Quantity      float64
+			PriceAtSale   float64
+			BuyPriceRM    float64 `gorm:"column:buy_price_rm"`
+		}
+		if err := database.DB.ScanRows(rows, &line); err != nil {
+			return err
+		}
+		if err := e.WriteRow(
+			line.ReceiptID, line.SaleTime, line.UserID, line.Username, line.PaymentMethod, line.Status, line.TotalAmount,
+			line.SKU, line.Name, line.Category, line.Quantity, line.PriceAtSale, line.BuyPriceRM,
+			line.Quantity*line.PriceAtSale, line.Quantity*(line.PriceAtSale-line.BuyPriceRM),
+		); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// writeVoidsSheet lists every abandoned cart in the period (voids have no product or tender to filter on)
+func writeVoidsSheet(e tableExporter, f salesReportFilters) error {
+	query := database.DB.Model(&models.VoidedTransaction{}).Order("timestamp desc")
+	if !f.Start.IsZero() {
+		query = query.Where("timestamp >= ?", f.Start)
+	}
+	if !f.End.IsZero() {
+		query = query.Where("timestamp <= ?", f.End)
+	}
+	rows, err := query.Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	if err := e.StartSheet("Voids", []string{"ID", "Time", "Cashier ID", "Value Lost", "Reason", "Items In Cart", "Session", "Video"}); err != nil {
+		return err
+	}
+	for rows.Next() {
+		var v models.VoidedTransaction
+		if err := database.DB.ScanRows(rows, &v); err != nil {
+			return err
+		}
+		if err := e.WriteRow(v.ID, v.Timestamp, v.UserID, v.TotalValueLost, v.Reason, v.ItemsInCart, v.SessionID, v.SecurityVideoURL); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// writeDrawerActivitySheet lists every manual drawer open in the period
+func writeDrawerActivitySheet(e tableExporter, f salesReportFilters) error {
+	query := database.DB.Model(&models.DrawerActivityLog{}).Order("timestamp desc")
+	if !f.Start.IsZero() {
+		query = query.Where("timestamp >= ?", f.Start)
+	}
+	if !f.End.IsZero() {
+		query = query.Where("timestamp <= ?", f.End)
+	}
+	rows, err := query.Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	if err := e.StartSheet("Drawer Activity", []string{"ID", "Time", "Staff ID", "Username", "Reason", "Status", "Video"}); err != nil {
+		return err
+	}
+	for rows.Next() {
+		var d models.DrawerActivityLog
+		if err := database.DB.ScanRows(rows, &d); err != nil {
+			return err
+		}
+		if err := e.WriteRow(d.ID, d.Timestamp, d.StaffID, d.Username, d.Reason, d.Status, d.SecurityVideoURL); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
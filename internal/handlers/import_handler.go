@@ -0,0 +1,425 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-pos-agent/internal/database"
+	"go-pos-agent/internal/models"
+	"go-pos-agent/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xuri/excelize/v2"
+	"gorm.io/gorm"
+)
+
+// importColumns are the spreadsheet headers we understand (case and spacing are ignored).
+// "sku", "name" and "price" are mandatory; everything else is optional.
+var importColumns = []string{
+	"sku", "name", "price", "cost_price", "category", "stock_quantity",
+	"is_sst_applicable", "is_weighable", "is_gas", "image_url",
+}
+
+// ImportFieldChange shows the before/after value of a single field in the dry-run diff
+type ImportFieldChange struct {
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+// ImportRowResult is the verdict for one spreadsheet row
+type ImportRowResult struct {
+	Row     int                          `json:"row"` // Spreadsheet row number (header is row 1)
+	SKU     string                       `json:"sku"`
+	Name    string                       `json:"name"`
+	Action  string                       `json:"action"` // "create", "update", "unchanged" or "error"
+	Changes map[string]ImportFieldChange `json:"changes,omitempty"`
+	Errors  []string                     `json:"errors,omitempty"`
+
+	// Internal: what to write when the import is applied
+	product  *models.Product
+	updates  map[string]interface{}
+	sstGiven bool // The row had an is_sst_applicable cell; otherwise a new product takes its category's default
+}
+
+// ImportResponse is the final payload sent to React
+type ImportResponse struct {
+	DryRun  bool              `json:"dry_run"`
+	Applied bool              `json:"applied"`
+	Summary map[string]int    `json:"summary"`
+	Rows    []ImportRowResult `json:"rows"`
+}
+
+// --- POST: /api/products/import ---
+// ImportProducts bulk creates/updates products from an .xlsx or .csv upload (multipart field "file").
+// By default it only returns the dry-run diff; send ?dry_run=false to apply it.
+func ImportProducts(c *gin.Context) {
+	dryRun := c.DefaultQuery("dry_run", "true") != "false"
+	allowNewCategories := c.Query("allow_new_categories") == "true"
+
+	// 1. Read the uploaded spreadsheet into plain string rows
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No import file uploaded"})
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Could not open uploaded file"})
+		return
+	}
+	defer file.Close()
+
+	rows, err := readImportRows(file, filepath.Ext(fileHeader.Filename))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(rows) < 2 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The file has no product rows"})
+		return
+	}
+
+	// 2. Work out the diff against the live catalogue
+	results, err := planImport(database.DB, rows, allowNewCategories)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := ImportResponse{DryRun: dryRun, Rows: results, Summary: summarizeImport(results)}
+
+	if dryRun {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	// 3. Refuse to apply a partially valid file: fix the sheet and try again
+	if response.Summary["error"] > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  fmt.Sprintf("%d rows have errors. Nothing was imported.", response.Summary["error"]),
+			"import": response,
+		})
+		return
+	}
+
+	// 4. Apply everything in one transaction so a failure leaves the catalogue untouched
+	userID := c.MustGet("userID").(uint)
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		return applyImport(tx, results, userID)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Import failed: " + err.Error()})
+		return
+	}
+
+	database.DB.Create(&models.AuditLog{
+		UserID:    userID,
+		Action:    "PRODUCT_IMPORT",
+		Details:   fmt.Sprintf("Imported %s (%d created, %d updated)", fileHeader.Filename, response.Summary["create"], response.Summary["update"]),
+		Timestamp: time.Now(),
+	})
+
+	// Imports can reprice whole counters; scales only receive the PLUs that actually changed
+	services.TriggerScaleSync(database.DB, "import")
+
+	response.Applied = true
+	c.JSON(http.StatusOK, response)
+}
+
+// readImportRows turns an .xlsx (first sheet) or .csv upload into a grid of strings
+func readImportRows(file io.Reader, ext string) ([][]string, error) {
+	switch strings.ToLower(ext) {
+	case ".xlsx":
+		f, err := excelize.OpenReader(file)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read Excel file")
+		}
+		defer f.Close()
+
+		return f.GetRows(f.GetSheetName(0))
+	case ".csv":
+		reader := csv.NewReader(file)
+		reader.FieldsPerRecord = -1 // Tolerate ragged rows from hand-edited sheets
+		reader.TrimLeadingSpace = true
+
+		rows, err := reader.ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("Could not read CSV file: %v", err)
+		}
+		return rows, nil
+	default:
+		return nil, fmt.Errorf("Only .xlsx and .csv files are supported")
+	}
+}
+
+// planImport validates every row and compares it to the existing product with the same SKU
+func planImport(db *gorm.DB, rows [][]string, allowNewCategories bool) ([]ImportRowResult, error) {
+	// 1. Map the header row to column positions
+	colIndex := make(map[string]int)
+	for i, header := range rows[0] {
+		key := strings.ToLower(strings.TrimSpace(header))
+		key = strings.ReplaceAll(key, " ", "_")
+		colIndex[key] = i
+	}
+	for _, required := range []string{"sku", "name", "price"} {
+		if _, ok := colIndex[required]; !ok {
+			return nil, fmt.Errorf("Missing required column %q. Expected columns: %s", required, strings.Join(importColumns, ", "))
+		}
+	}
+
+	// 2. Preload the catalogue and the known categories
+	var existing []models.Product
+	if err := db.Find(&existing).Error; err != nil {
+		return nil, fmt.Errorf("Failed to load products")
+	}
+	bySKU := make(map[string]models.Product)
+	for _, p := range existing {
+		bySKU[p.SKU] = p
+	}
+
+	// Categories are matched case-insensitively and rewritten to their canonical spelling
+	var categories []models.Category
+	db.Find(&categories)
+	knownCategories := make(map[string]string)
+	for _, cat := range categories {
+		knownCategories[strings.ToLower(cat.Name)] = cat.Name
+	}
+
+	seenSKUs := make(map[string]int)
+	var results []ImportRowResult
+
+	for i, row := range rows[1:] {
+		rowNum := i + 2
+		cell := func(name string) (string, bool) {
+			idx, ok := colIndex[name]
+			if !ok || idx >= len(row) {
+				return "", false
+			}
+			return strings.TrimSpace(row[idx]), true
+		}
+
+		// Skip fully blank lines at the bottom of the sheet
+		if strings.TrimSpace(strings.Join(row, "")) == "" {
+			continue
+		}
+
+		sku, _ := cell("sku")
+		name, _ := cell("name")
+		result := ImportRowResult{Row: rowNum, SKU: sku, Name: name}
+
+		// 3. Row-level validation
+		if sku == "" {
+			result.Errors = append(result.Errors, "SKU is required")
+		} else if archived, isArchived := bySKU[sku]; isArchived && archived.IsArchived {
+			// Updating a hidden product would look like nothing happened; it has to be restored first
+			if archived.MergedIntoID != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("SKU belongs to %s, which was merged into product #%d", archived.Name, *archived.MergedIntoID))
+			} else {
+				result.Errors = append(result.Errors, fmt.Sprintf("SKU belongs to archived product %s (#%d), restore it before importing", archived.Name, archived.ID))
+			}
+		} else if firstRow, dup := seenSKUs[sku]; dup {
+			result.Errors = append(result.Errors, fmt.Sprintf("Duplicate SKU (already used on row %d)", firstRow))
+		} else {
+			seenSKUs[sku] = rowNum
+		}
+		if name == "" {
+			result.Errors = append(result.Errors, "Name is required")
+		}
+
+		fields := make(map[string]interface{})
+		for _, numeric := range []string{"price", "cost_price", "stock_quantity"} {
+			raw, ok := cell(numeric)
+			if !ok || raw == "" {
+				if numeric == "price" {
+					result.Errors = append(result.Errors, "Price is required")
+				}
+				continue
+			}
+			val, err := strconv.ParseFloat(strings.ReplaceAll(raw, ",", ""), 64)
+			if err != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("%s %q is not a number", numeric, raw))
+				continue
+			}
+			if val < 0 {
+				result.Errors = append(result.Errors, fmt.Sprintf("%s cannot be negative", numeric))
+				continue
+			}
+			fields[numeric] = val
+		}
+
+		for _, flag := range []string{"is_sst_applicable", "is_weighable", "is_gas"} {
+			if raw, ok := cell(flag); ok && raw != "" {
+				switch strings.ToLower(raw) {
+				case "1", "true", "yes", "y":
+					fields[flag] = true
+				case "0", "false", "no", "n":
+					fields[flag] = false
+				default:
+					result.Errors = append(result.Errors, fmt.Sprintf("%s %q must be yes or no", flag, raw))
+				}
+			}
+		}
+
+		if category, ok := cell("category"); ok && category != "" {
+			if canonical, known := knownCategories[strings.ToLower(category)]; known {
+				fields["category"] = canonical
+			} else if allowNewCategories {
+				fields["category"] = category
+			} else {
+				result.Errors = append(result.Errors, fmt.Sprintf("Unknown category %q", category))
+			}
+		}
+		if imageURL, ok := cell("image_url"); ok && imageURL != "" {
+			fields["image_url"] = imageURL
+		}
+		fields["name"] = name
+
+		if len(result.Errors) > 0 {
+			result.Action = "error"
+			results = append(results, result)
+			continue
+		}
+
+		// 4. New SKU: build the product to create
+		current, exists := bySKU[sku]
+		if !exists {
+			newProduct := models.Product{SKU: sku, Name: name, ScaleDepartment: defaultScaleDepartment, ShelfLifeDays: defaultShelfLifeDays}
+			newProduct.Price, _ = fields["price"].(float64)
+			newProduct.CostPrice, _ = fields["cost_price"].(float64)
+			newProduct.StockQuantity, _ = fields["stock_quantity"].(float64)
+			newProduct.Category, _ = fields["category"].(string)
+			newProduct.ImageURL, _ = fields["image_url"].(string)
+			newProduct.IsSSTApplicable, _ = fields["is_sst_applicable"].(bool)
+			newProduct.IsWeighable, _ = fields["is_weighable"].(bool)
+			newProduct.IsGas, _ = fields["is_gas"].(bool)
+
+			_, result.sstGiven = fields["is_sst_applicable"]
+			result.Action = "create"
+			result.product = &newProduct
+			results = append(results, result)
+			continue
+		}
+
+		// 5. Existing SKU: only keep the fields that actually differ
+		currentValues := map[string]interface{}{
+			"name":              current.Name,
+			"price":             current.Price,
+			"cost_price":        current.CostPrice,
+			"stock_quantity":    current.StockQuantity,
+			"category":          current.Category,
+			"image_url":         current.ImageURL,
+			"is_sst_applicable": current.IsSSTApplicable,
+			"is_weighable":      current.IsWeighable,
+			"is_gas":            current.IsGas,
+		}
+
+		result.Changes = make(map[string]ImportFieldChange)
+		result.updates = make(map[string]interface{})
+		for field, newVal := range fields {
+			if currentValues[field] != newVal {
+				result.Changes[field] = ImportFieldChange{Old: currentValues[field], New: newVal}
+				result.updates[field] = newVal
+			}
+		}
+
+		result.product = &current
+		if len(result.updates) == 0 {
+			result.Action = "unchanged"
+		} else {
+			result.Action = "update"
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// applyImport writes the planned creates/updates and their ledger rows
+func applyImport(tx *gorm.DB, results []ImportRowResult, userID uint) error {
+	for _, r := range results {
+		switch r.Action {
+		case "create":
+			if r.product.Category != "" {
+				category, err := services.EnsureCategory(tx, r.product.Category)
+				if err != nil {
+					return fmt.Errorf("row %d: failed to create category %q", r.Row, r.product.Category)
+				}
+				r.product.CategoryID = &category.ID
+				r.product.Category = category.Name
+				if !r.sstGiven {
+					r.product.IsSSTApplicable = category.DefaultSST
+				}
+			}
+
+			// Opening stock goes through the inventory service exactly like a manual AddProduct
+			openingStock := r.product.StockQuantity
+			r.product.StockQuantity = 0
+			if err := tx.Create(r.product).Error; err != nil {
+				return fmt.Errorf("row %d: %v", r.Row, err)
+			}
+
+			if openingStock != 0 {
+				result, err := services.ApplyMovement(tx, services.StockMovement{
+					ProductID:      r.product.ID,
+					Change:         openingStock,
+					Reason:         "Initial Setup",
+					UserID:         userID,
+					SourceDocument: "IMPORT",
+				})
+				if err != nil {
+					return fmt.Errorf("row %d: %v", r.Row, err)
+				}
+				r.product.StockQuantity = result.Product.StockQuantity
+			}
+
+		case "update":
+			if name, ok := r.updates["category"].(string); ok {
+				category, err := services.EnsureCategory(tx, name)
+				if err != nil {
+					return fmt.Errorf("row %d: failed to create category %q", r.Row, name)
+				}
+				r.updates["category_id"] = category.ID
+				r.updates["category"] = category.Name
+			}
+
+			// Stock is posted as a movement, never written directly
+			newStock, stockChanged := r.updates["stock_quantity"].(float64)
+			delete(r.updates, "stock_quantity")
+
+			before := *r.product
+			if len(r.updates) > 0 {
+				if err := tx.Model(r.product).Updates(r.updates).Error; err != nil {
+					return fmt.Errorf("row %d: %v", r.Row, err)
+				}
+			}
+
+			if err := services.RecordPriceChange(tx, before, r.product.Price, r.product.CostPrice, "Import", userID); err != nil {
+				return fmt.Errorf("row %d: failed to write price history", r.Row)
+			}
+
+			if stockChanged {
+				if _, err := services.SetStockLevel(tx, r.product.ID, newStock, "Import", userID, "IMPORT"); err != nil {
+					return fmt.Errorf("row %d: %v", r.Row, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// summarizeImport counts the rows per action for the dashboard banner
+func summarizeImport(results []ImportRowResult) map[string]int {
+	summary := map[string]int{"create": 0, "update": 0, "unchanged": 0, "error": 0}
+	for _, r := range results {
+		summary[r.Action]++
+	}
+	return summary
+}
@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"go-pos-agent/internal/database"
+	"go-pos-agent/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ABC class boundaries: the products making the first 80% of the basis are "A", the next 15% "B", the tail "C"
+const (
+	abcClassALimit = 0.80
+	abcClassBLimit = 0.95
+)
+
+// ProductAnalytics is one product's movement over the analysis window
+type ProductAnalytics struct {
+	ProductID     uint       `json:"product_id"`
+	SKU           string     `json:"sku"`
+	Name          string     `json:"name"`
+	Category      string     `json:"category"`
+	Class         string     `json:"class"` // "A", "B" or "C"
+	QuantitySold  float64    `json:"quantity_sold"`
+	Revenue       float64    `json:"revenue"`
+	Profit        float64    `json:"profit"`
+	Share         float64    `json:"share"`            // This product's percentage of the basis total
+	CumulativePct float64    `json:"cumulative_share"` // Running percentage down the ranking
+	StockQuantity float64    `json:"stock_quantity"`
+	StockCost     float64    `json:"stock_cost"`    // Cost value tied up on the shelf
+	DaysOfCover   *float64   `json:"days_of_cover"` // Stock / average daily sales since it was listed; nil when nothing sold
+	LastSoldAt    *time.Time `json:"last_sold_at"`
+}
+
+// ClassSummary totals one ABC class
+type ClassSummary struct {
+	Class     string  `json:"class"`
+	Products  int     `json:"products"`
+	Revenue   float64 `json:"revenue"`
+	Profit    float64 `json:"profit"`
+	StockCost float64 `json:"stock_cost"`
+}
+
+// DeadStockLine is a product with stock on hand that hasn't sold within the dead-stock window
+type DeadStockLine struct {
+	ProductID     uint       `json:"product_id"`
+	SKU           string     `json:"sku"`
+	Name          string     `json:"name"`
+	Category      string     `json:"category"`
+	StockQuantity float64    `json:"stock_quantity"`
+	CostPrice     float64    `json:"cost_price"`
+	TiedUpCost    float64    `json:"tied_up_cost"`
+	LastSoldAt    *time.Time `json:"last_sold_at"` // nil = never sold
+}
+
+// InventoryAnalytics is the final payload sent to React
+type InventoryAnalytics struct {
+	Basis          string             `json:"basis"`
+	WindowDays     int                `json:"window_days"`
+	DeadStockDays  int                `json:"dead_stock_days"`
+	Products       []ProductAnalytics `json:"products"`
+	Classes        []ClassSummary     `json:"classes"`
+	DeadStock      []DeadStockLine    `json:"dead_stock"`
+	DeadStockTotal float64            `json:"dead_stock_total"`
+}
+
+// --- GET: /api/reports/inventory-analytics ---
+// GetInventoryAnalytics ranks active products into A/B/C classes by ?basis=revenue|profit (default profit)
+// over the last ?days= (default 90), gives each product's days of cover at that sales rate, and lists
+// dead stock: products older than ?dead_days= (default 90) holding stock that hasn't sold in that time, valued at cost.
+func GetInventoryAnalytics(c *gin.Context) {
+	basis := c.DefaultQuery("basis", "profit")
+	if basis != "profit" && basis != "revenue" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "basis must be profit or revenue"})
+		return
+	}
+	windowDays, err := strconv.Atoi(c.DefaultQuery("days", "90"))
+	if err != nil || windowDays < 1 || windowDays > 3650 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "days must be between 1 and 3650"})
+		return
+	}
+	deadDays, err := strconv.Atoi(c.DefaultQuery("dead_days", "90"))
+	if err != nil || deadDays < 1 || deadDays > 3650 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "dead_days must be between 1 and 3650"})
+		return
+	}
+
+	now := time.Now()
+	windowStart := now.AddDate(0, 0, -windowDays)
+	deadSince := now.AddDate(0, 0, -deadDays)
+
+	// 1. Sales per product inside the window
+	var sold []struct {
+		ProductID uint
+		Quantity  float64
+		Revenue   float64
+		Profit    float64
+	}
+	err = database.DB.Table("sale_items").
+		Select("sale_items.product_id, SUM(sale_items.quantity) as quantity, "+
+			"SUM(sale_items.quantity * sale_items.price_at_sale) as revenue, "+
+			"SUM(sale_items.quantity * (sale_items.price_at_sale - sale_items.buy_price_rm)) as profit").
+		Joins("JOIN sales ON sale_items.sale_id = sales.id").
+		Where("sales.status = ? AND sales.sale_time >= ?", "completed", windowStart).
+		Group("sale_items.product_id").
+		Scan(&sold).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to aggregate sales"})
+		return
+	}
+
+	// 2. Last sale ever, per product (for dead stock, which may look further back than the window)
+	var lastSales []struct {
+		ProductID  uint
+		LastSoldAt string
+	}
+	err = database.DB.Table("sale_items").
+		Select("sale_items.product_id, MAX(sales.sale_time) as last_sold_at").
+		Joins("JOIN sales ON sale_items.sale_id = sales.id").
+		Where("sales.status = ?", "completed").
+		Group("sale_items.product_id").
+		Scan(&lastSales).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to aggregate sales"})
+		return
+	}
+	lastSoldAt := make(map[uint]time.Time, len(lastSales))
+	for _, ls := range lastSales {
+		if t, ok := parseDBTime(ls.LastSoldAt); ok {
+			lastSoldAt[ls.ProductID] = t
+		}
+	}
+
+	var products []models.Product
+	if err := database.DB.Where("is_archived = ?", false).Find(&products).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch inventory"})
+		return
+	}
+	soldByProduct := make(map[uint]int, len(sold))
+	for i, s := range sold {
+		soldByProduct[s.ProductID] = i
+	}
+
+	// 3. One analytics line per active product
+	report := InventoryAnalytics{
+		Basis:         basis,
+		WindowDays:    windowDays,
+		DeadStockDays: deadDays,
+		Products:      []ProductAnalytics{},
+		DeadStock:     []DeadStockLine{},
+	}
+	var basisTotal float64
+	for _, p := range products {
+		line := ProductAnalytics{
+			ProductID:     p.ID,
+			SKU:           p.SKU,
+			Name:          p.Name,
+			Category:      p.Category,
+			StockQuantity: p.StockQuantity,
+			StockCost:     p.StockQuantity * p.CostPrice,
+		}
+		if i, ok := soldByProduct[p.ID]; ok {
+			line.QuantitySold = sold[i].Quantity
+			line.Revenue = sold[i].Revenue
+			line.Profit = sold[i].Profit
+		}
+		if t, ok := lastSoldAt[p.ID]; ok {
+			line.LastSoldAt = &t
+		}
+		if line.QuantitySold > 0 {
+			// A product added part-way through the window has only been on sale since it was created
+			sellingDays := math.Min(float64(windowDays), math.Max(1, now.Sub(p.CreatedAt).Hours()/24))
+			cover := p.StockQuantity / (line.QuantitySold / sellingDays)
+			line.DaysOfCover = &cover
+		}
+		if value := abcBasisValue(line, basis); value > 0 {
+			basisTotal += value
+		}
+		report.Products = append(report.Products, line)
+
+		// Dead stock: something on the shelf, nothing sold since the cut-off, and on the books for at least
+		// that long (a product created yesterday hasn't had the chance to sell yet)
+		if p.StockQuantity > 0 && p.CreatedAt.Before(deadSince) && (line.LastSoldAt == nil || line.LastSoldAt.Before(deadSince)) {
+			dead := DeadStockLine{
+				ProductID:     p.ID,
+				SKU:           p.SKU,
+				Name:          p.Name,
+				Category:      p.Category,
+				StockQuantity: p.StockQuantity,
+				CostPrice:     p.CostPrice,
+				TiedUpCost:    line.StockCost,
+				LastSoldAt:    line.LastSoldAt,
+			}
+			report.DeadStock = append(report.DeadStock, dead)
+			report.DeadStockTotal += dead.TiedUpCost
+		}
+	}
+
+	// 4. Rank and classify. A product is "A" while the share before it is still under 80%,
+	// so the product that crosses the line is included in A. Loss-makers and non-sellers are always "C".
+	sort.SliceStable(report.Products, func(i, j int) bool {
+		return abcBasisValue(report.Products[i], basis) > abcBasisValue(report.Products[j], basis)
+	})
+	classes := map[string]*ClassSummary{"A": {Class: "A"}, "B": {Class: "B"}, "C": {Class: "C"}}
+	var running float64
+	for i := range report.Products {
+		line := &report.Products[i]
+		value := abcBasisValue(*line, basis)
+
+		line.Class = "C"
+		if value > 0 && basisTotal > 0 {
+			before := running / basisTotal
+			running += value
+			line.Share = value / basisTotal * 100
+			line.CumulativePct = running / basisTotal * 100
+			if before < abcClassALimit {
+				line.Class = "A"
+			} else if before < abcClassBLimit {
+				line.Class = "B"
+			}
+		}
+
+		summary := classes[line.Class]
+		summary.Products++
+		summary.Revenue += line.Revenue
+		summary.Profit += line.Profit
+		summary.StockCost += line.StockCost
+	}
+	report.Classes = []ClassSummary{*classes["A"], *classes["B"], *classes["C"]}
+
+	sort.Slice(report.DeadStock, func(i, j int) bool { return report.DeadStock[i].TiedUpCost > report.DeadStock[j].TiedUpCost })
+
+	c.JSON(http.StatusOK, report)
+}
+
+// abcBasisValue picks the figure products are ranked by
+func abcBasisValue(line ProductAnalytics, basis string) float64 {
+	if basis == "revenue" {
+		return line.Revenue
+	}
+	return line.Profit
+}
+
+// parseDBTime reads a timestamp that came back from an aggregate (SQLite returns MAX() of a datetime as text)
+func parseDBTime(value string) (time.Time, bool) {
+	for _, layout := range []string{"2006-01-02 15:04:05.999999999-07:00", "2006-01-02T15:04:05.999999999-07:00", "2006-01-02 15:04:05"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
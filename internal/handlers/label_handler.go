@@ -0,0 +1,260 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"go-pos-agent/internal/database"
+	"go-pos-agent/internal/models"
+	"go-pos-agent/internal/scale"
+	"go-pos-agent/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-pdf/fpdf"
+)
+
+// LabelRequest selects which products get shelf labels: either an explicit list,
+// or every product whose selling price changed since a date (e.g., after a price update run).
+type LabelRequest struct {
+	ProductIDs   []uint `json:"product_ids"`
+	ChangedSince string `json:"changed_since"` // "YYYY-MM-DD"
+	Copies       int    `json:"copies"`        // Labels per product (default 1)
+}
+
+// ShelfLabel is everything printed on one tag
+type ShelfLabel struct {
+	ProductID uint    `json:"product_id"`
+	Name      string  `json:"name"`
+	Price     float64 `json:"price"`
+	PriceText string  `json:"price_text"` // "RM 3.50" or "RM 12.90 / kg"
+	UnitText  string  `json:"unit_text"`  // "Price per kg" for weighables, "per unit" otherwise
+	Barcode   string  `json:"barcode"`    // Valid EAN-13 or empty (weighables get their barcode from the scale)
+	ItemCode  string  `json:"item_code"`  // Scale PLU code shown on weighable tags
+}
+
+// --- POST: /api/labels/print ---
+// PrintShelfLabels sends the selected labels as ESC/POS jobs to the label printer (LABEL_PRINTER in .env)
+func PrintShelfLabels(c *gin.Context) {
+	labels, copies, err := collectShelfLabels(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 1. One job for the whole batch so the printer doesn't pause between tags
+	job := utils.NewESCPOSBuilder()
+	for _, label := range labels {
+		for i := 0; i < copies; i++ {
+			job.Align(1).Bold(true).Size(1, 1).Line(label.Name)
+			job.Size(2, 2).Line(label.PriceText)
+			job.Bold(false).Size(1, 1).Line(label.UnitText)
+			if label.Barcode != "" {
+				job.BarcodeEAN13(label.Barcode)
+			} else if label.ItemCode != "" {
+				job.Line("PLU " + label.ItemCode)
+			}
+			job.Feed(2).Cut()
+		}
+	}
+
+	// 2. Read the shared printer name from .env
+	printerName := os.Getenv("LABEL_PRINTER")
+	if printerName == "" {
+		printerName = "LabelPrinter" // Default fallback if .env is missing
+	}
+
+	if err := sendRawToPrinter(printerName, job.Bytes(), "shelf_labels.bin"); err != nil {
+		log.Printf("❌ Error printing shelf labels: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to communicate with label printer"})
+		return
+	}
+
+	log.Printf("🏷️ LABELS: Sent %d shelf labels to %s", len(labels)*copies, printerName)
+	c.JSON(http.StatusOK, gin.H{"message": "Labels sent to printer", "printed": len(labels) * copies, "labels": labels})
+}
+
+// --- POST: /api/labels/pdf ---
+// DownloadShelfLabelSheet renders the selected labels onto A4 sticker sheets (3 x 7, 63.5 x 38.1 mm)
+func DownloadShelfLabelSheet(c *gin.Context) {
+	labels, copies, err := collectShelfLabels(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Sheet geometry for the common 21-up label stock
+	const (
+		cols, rows         = 3, 7
+		labelW, labelH     = 63.5, 38.1
+		marginLeft, margin = 7.2, 15.1
+		gapX               = 2.5
+	)
+
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetAutoPageBreak(false, 0)
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+
+	slot := 0
+	for _, label := range labels {
+		for i := 0; i < copies; i++ {
+			if slot%(cols*rows) == 0 {
+				pdf.AddPage()
+			}
+			col := slot % cols
+			row := (slot / cols) % rows
+			x := marginLeft + float64(col)*(labelW+gapX)
+			y := margin + float64(row)*labelH
+			drawShelfLabel(pdf, tr, label, x, y, labelW)
+			slot++
+		}
+	}
+
+	fileName := fmt.Sprintf("shelf_labels_%s.pdf", time.Now().Format("20060102_150405"))
+	c.Header("Content-Description", "File Transfer")
+	c.Header("Content-Disposition", "attachment; filename="+fileName)
+	c.Header("Content-Type", "application/pdf")
+
+	if err := pdf.Output(c.Writer); err != nil {
+		fmt.Println("Error writing label PDF:", err)
+	}
+}
+
+// drawShelfLabel lays out one tag: name, big price, unit line and the barcode drawn as filled bars
+func drawShelfLabel(pdf *fpdf.Fpdf, tr func(string) string, label ShelfLabel, x, y, width float64) {
+	pdf.SetFont("Helvetica", "B", 9)
+	pdf.SetXY(x+2, y+2)
+	pdf.CellFormat(width-4, 4, tr(truncateLabelText(label.Name, 34)), "", 0, "C", false, 0, "")
+
+	pdf.SetFont("Helvetica", "B", 18)
+	pdf.SetXY(x+2, y+7)
+	pdf.CellFormat(width-4, 8, tr(label.PriceText), "", 0, "C", false, 0, "")
+
+	pdf.SetFont("Helvetica", "", 7)
+	pdf.SetXY(x+2, y+15)
+	pdf.CellFormat(width-4, 3, tr(label.UnitText), "", 0, "C", false, 0, "")
+
+	if label.Barcode == "" {
+		if label.ItemCode != "" {
+			pdf.SetFont("Helvetica", "", 9)
+			pdf.SetXY(x+2, y+24)
+			pdf.CellFormat(width-4, 4, "PLU "+label.ItemCode, "", 0, "C", false, 0, "")
+		}
+		return
+	}
+
+	modules, err := utils.EncodeEAN13(label.Barcode)
+	if err != nil {
+		return
+	}
+
+	// 0.33 mm per module is the nominal EAN-13 size (95 modules = 31.35 mm)
+	const moduleW, barH = 0.33, 11.0
+	barX := x + (width-moduleW*float64(len(modules)))/2
+	barY := y + 19.5
+
+	pdf.SetFillColor(0, 0, 0)
+	for i := 0; i < len(modules); {
+		if !modules[i] {
+			i++
+			continue
+		}
+		// Merge neighbouring black modules into one rectangle
+		run := 1
+		for i+run < len(modules) && modules[i+run] {
+			run++
+		}
+		pdf.Rect(barX+float64(i)*moduleW, barY, float64(run)*moduleW, barH, "F")
+		i += run
+	}
+
+	pdf.SetFont("Helvetica", "", 7)
+	pdf.SetXY(x+2, barY+barH+0.5)
+	pdf.CellFormat(width-4, 3, label.Barcode, "", 0, "C", false, 0, "")
+}
+
+// collectShelfLabels reads the LabelRequest and builds the labels (archived products are skipped)
+func collectShelfLabels(c *gin.Context) ([]ShelfLabel, int, error) {
+	var req LabelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return nil, 0, fmt.Errorf("Invalid label request")
+	}
+
+	copies := req.Copies
+	if copies < 1 {
+		copies = 1
+	}
+	if copies > 50 {
+		return nil, 0, fmt.Errorf("At most 50 copies per product")
+	}
+
+	query := database.DB.Where("is_archived = ?", false).Order("name asc")
+
+	switch {
+	case len(req.ProductIDs) > 0:
+		query = query.Where("id IN ?", req.ProductIDs)
+	case req.ChangedSince != "":
+		since, err := time.ParseInLocation("2006-01-02", req.ChangedSince, time.Now().Location())
+		if err != nil {
+			return nil, 0, fmt.Errorf("Invalid changed_since date, expected YYYY-MM-DD")
+		}
+		// Only selling price changes matter for a shelf tag (cost changes aren't printed)
+		changed := database.DB.Model(&models.PriceHistory{}).
+			Select("DISTINCT product_id").
+			Where("changed_at >= ? AND old_price <> new_price", since)
+		query = query.Where("id IN (?)", changed)
+	default:
+		return nil, 0, fmt.Errorf("Pick products or a changed_since date")
+	}
+
+	var products []models.Product
+	if err := query.Find(&products).Error; err != nil {
+		return nil, 0, fmt.Errorf("Failed to fetch products")
+	}
+	if len(products) == 0 {
+		return nil, 0, fmt.Errorf("No products matched the selection")
+	}
+
+	labels := make([]ShelfLabel, 0, len(products))
+	for _, p := range products {
+		labels = append(labels, buildShelfLabel(p))
+	}
+	return labels, copies, nil
+}
+
+// buildShelfLabel turns a product into tag text. Weighables are priced per kg, the same
+// unit price the scale export sends, and carry their scale item code instead of a barcode.
+func buildShelfLabel(p models.Product) ShelfLabel {
+	label := ShelfLabel{ProductID: p.ID, Name: p.Name, Price: p.Price}
+
+	if p.IsWeighable {
+		label.PriceText = fmt.Sprintf("RM %.2f / kg", p.Price)
+		label.UnitText = "Price per kg"
+		label.ItemCode = scale.ItemCode(p)
+		return label
+	}
+
+	label.PriceText = fmt.Sprintf("RM %.2f", p.Price)
+	label.UnitText = "per unit"
+
+	// Manufacturer barcodes are printed as-is. A 12-digit SKU is a UPC-A, which already ends in its own
+	// check digit: drawn as EAN-13 with a leading 0 it is the same symbol, and scanners read back the SKU.
+	switch {
+	case utils.IsValidEAN13(p.SKU):
+		label.Barcode = p.SKU
+	case len(p.SKU) == 12 && utils.IsValidEAN13("0"+p.SKU):
+		label.Barcode = "0" + p.SKU
+	}
+	return label
+}
+
+// truncateLabelText keeps long names from running off the tag
+func truncateLabelText(text string, max int) string {
+	runes := []rune(text)
+	if len(runes) <= max {
+		return text
+	}
+	return string(runes[:max-1]) + "…"
+}
@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"go-pos-agent/internal/database"
+	"go-pos-agent/internal/models"
+	"go-pos-agent/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LedgerEntryView is one ledger row with the product details the dashboard needs to display it
+type LedgerEntryView struct {
+	ID              uint      `json:"id"`
+	ProductID       uint      `json:"product_id"`
+	SKU             string    `json:"sku"`
+	ProductName     string    `json:"product_name"`
+	ChangeAmount    float64   `json:"change_amount"`
+	Balance         float64   `json:"balance"`
+	Reason          string    `json:"reason"`
+	UserID          uint      `json:"user_id"`
+	SourceDocument  string    `json:"source_document"`
+	LocationID      uint      `json:"location_id"`
+	LocationName    string    `json:"location_name"`
+	LocationBalance float64   `json:"location_balance"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// --- GET: /api/stock/ledger ---
+// GetStockLedger pages through stock movements (newest first).
+// Filters: ?product_id=, ?location_id=, ?reason= (prefix match, so "Write-Off" finds every write-off reason),
+// ?start=YYYY-MM-DD&end=YYYY-MM-DD, plus ?page= and ?page_size= (max 500).
+func GetStockLedger(c *gin.Context) {
+	start, end, err := parseExportRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if page < 1 {
+		page = 1
+	}
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "50"))
+	if pageSize < 1 || pageSize > 500 {
+		pageSize = 50
+	}
+
+	// 1. Build the filtered query once, then use it for both the count and the page
+	query := database.DB.Table("stock_ledgers").
+		Joins("LEFT JOIN products ON stock_ledgers.product_id = products.id").
+		Joins("LEFT JOIN locations ON stock_ledgers.location_id = locations.id")
+	if productID := c.Query("product_id"); productID != "" {
+		query = query.Where("stock_ledgers.product_id = ?", productID)
+	}
+	if locationID := c.Query("location_id"); locationID != "" {
+		query = query.Where("stock_ledgers.location_id = ?", locationID)
+	}
+	if reason := c.Query("reason"); reason != "" {
+		query = query.Where("stock_ledgers.reason LIKE ?", reason+"%")
+	}
+	if !start.IsZero() {
+		query = query.Where("stock_ledgers.created_at >= ?", start)
+	}
+	if !end.IsZero() {
+		query = query.Where("stock_ledgers.created_at <= ?", end)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count ledger entries"})
+		return
+	}
+
+	// 2. Fetch the requested page
+	entries := []LedgerEntryView{}
+	err = query.
+		Select("stock_ledgers.id, stock_ledgers.product_id, products.sku, products.name as product_name, stock_ledgers.change_amount, stock_ledgers.balance, stock_ledgers.reason, stock_ledgers.user_id, stock_ledgers.source_document, stock_ledgers.location_id, locations.name as location_name, stock_ledgers.location_balance, stock_ledgers.created_at").
+		Order("stock_ledgers.created_at desc, stock_ledgers.id desc").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Scan(&entries).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch ledger entries"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"entries":     entries,
+		"total":       total,
+		"page":        page,
+		"page_size":   pageSize,
+		"total_pages": (total + int64(pageSize) - 1) / int64(pageSize),
+	})
+}
+
+// StockAsOfLine is one product's reconstructed quantity at the requested moment
+type StockAsOfLine struct {
+	ProductID uint    `json:"product_id"`
+	SKU       string  `json:"sku"`
+	Name      string  `json:"name"`
+	Category  string  `json:"category"`
+	Quantity  float64 `json:"quantity"`
+	CostPrice float64 `json:"cost_price"` // Cost in effect at that moment (from price history)
+	TotalCost float64 `json:"total_cost"`
+}
+
+// --- GET: /api/stock/as-of ---
+// GetStockAsOf rebuilds every product's quantity at ?at=YYYY-MM-DD (end of that day) or
+// ?at=YYYY-MM-DDTHH:MM by summing the ledger up to that moment, and values it at the cost
+// that applied then. This lets a month-end valuation be reproduced after the fact.
+// ?location_id= limits it to one location.
+func GetStockAsOf(c *gin.Context) {
+	at, err := parsePointInTime(c.Query("at"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 1. Sum every movement up to 'at', per product
+	var sums []struct {
+		ProductID uint
+		Quantity  float64
+	}
+	sumQuery := database.DB.Model(&models.StockLedger{}).
+		Select("product_id, SUM(change_amount) as quantity").
+		Where("created_at <= ?", at)
+	if locationID := c.Query("location_id"); locationID != "" {
+		sumQuery = sumQuery.Where("location_id = ?", locationID) // One room or branch only
+	}
+	err = sumQuery.Group("product_id").Scan(&sums).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read stock ledger"})
+		return
+	}
+
+	// 2. Products (archived ones included - they may have held stock back then) and historical costs
+	var products []models.Product
+	database.DB.Find(&products)
+	productByID := make(map[uint]models.Product, len(products))
+	for _, p := range products {
+		productByID[p.ID] = p
+	}
+	historicalCosts := services.CostPricesAt(database.DB, at)
+
+	// 3. Value each non-zero line
+	lines := []StockAsOfLine{}
+	var grandTotal float64
+	for _, row := range sums {
+		if row.Quantity == 0 {
+			continue
+		}
+		p := productByID[row.ProductID]
+
+		costPrice, changedSince := historicalCosts[row.ProductID]
+		if !changedSince {
+			costPrice = p.CostPrice
+		}
+
+		line := StockAsOfLine{
+			ProductID: row.ProductID,
+			SKU:       p.SKU,
+			Name:      p.Name,
+			Category:  p.Category,
+			Quantity:  row.Quantity,
+			CostPrice: costPrice,
+			TotalCost: row.Quantity * costPrice,
+		}
+		grandTotal += line.TotalCost
+		lines = append(lines, line)
+	}
+
+	sort.Slice(lines, func(i, j int) bool { return lines[i].Name < lines[j].Name })
+
+	c.JSON(http.StatusOK, gin.H{
+		"at":          at,
+		"products":    lines,
+		"grand_total": grandTotal,
+	})
+}
+
+// parsePointInTime reads "YYYY-MM-DDTHH:MM", or a bare "YYYY-MM-DD" meaning the end of that day (local time)
+func parsePointInTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, fmt.Errorf("Missing 'at' date, expected YYYY-MM-DD or YYYY-MM-DDTHH:MM")
+	}
+
+	if at, err := time.ParseInLocation("2006-01-02T15:04", value, time.Now().Location()); err == nil {
+		return at, nil
+	}
+
+	day, err := time.ParseInLocation("2006-01-02", value, time.Now().Location())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Invalid 'at' date, expected YYYY-MM-DD or YYYY-MM-DDTHH:MM")
+	}
+	return day.Add(24*time.Hour - time.Second), nil
+}
@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-pos-agent/internal/database"
+	"go-pos-agent/internal/models"
+	"go-pos-agent/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// LocationRequest defines the payload for creating or editing a location
+type LocationRequest struct {
+	Name      string `json:"name" binding:"required"`
+	IsDefault bool   `json:"is_default"` // Make this the till's location (the previous default is unset)
+	IsActive  *bool  `json:"is_active"`  // Defaults to true
+}
+
+// LocationSummary is a location with the totals shown on the locations screen
+type LocationSummary struct {
+	models.Location
+	ProductCount   int64   `json:"product_count"`    // Products with stock here
+	StockValue     float64 `json:"stock_value"`      // At current cost
+	InTransitUnits float64 `json:"in_transit_units"` // Dispatched towards this location, not yet received
+}
+
+// LocationStockLine is one product's balance at a location
+type LocationStockLine struct {
+	ProductID uint    `json:"product_id"`
+	SKU       string  `json:"sku"`
+	Name      string  `json:"name"`
+	Quantity  float64 `json:"quantity"`
+	CostPrice float64 `json:"cost_price"`
+	TotalCost float64 `json:"total_cost"`
+}
+
+// LocationCountRequest sets the counted quantity of one product at a location
+type LocationCountRequest struct {
+	ProductID uint     `json:"product_id" binding:"required"`
+	Quantity  *float64 `json:"quantity" binding:"required"`
+	Notes     string   `json:"notes"`
+}
+
+// --- GET: /api/locations ---
+// GetLocations lists every location with its stock totals (transfers' transit locations are left out)
+func GetLocations(c *gin.Context) {
+	var locations []models.Location
+	if err := database.DB.Where("is_transit = ?", false).Order("is_default desc, name asc").Find(&locations).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch locations"})
+		return
+	}
+
+	summaries := make([]LocationSummary, 0, len(locations))
+	for _, location := range locations {
+		summary := LocationSummary{Location: location}
+		database.DB.Table("location_stocks").
+			Select("COUNT(*) as product_count, COALESCE(SUM(location_stocks.quantity * products.cost_price), 0) as stock_value").
+			Joins("JOIN products ON location_stocks.product_id = products.id").
+			Where("location_stocks.location_id = ? AND location_stocks.quantity <> 0", location.ID).
+			Row().Scan(&summary.ProductCount, &summary.StockValue)
+		database.DB.Table("stock_transfer_items").
+			Select("COALESCE(SUM(stock_transfer_items.quantity), 0)").
+			Joins("JOIN stock_transfers ON stock_transfer_items.transfer_id = stock_transfers.id").
+			Where("stock_transfers.status = ? AND stock_transfers.to_location_id = ?", "in_transit", location.ID).
+			Row().Scan(&summary.InTransitUnits)
+		summaries = append(summaries, summary)
+	}
+
+	c.JSON(http.StatusOK, summaries)
+}
+
+// --- POST: /api/locations ---
+// CreateLocation adds a shop floor, back store, branch...
+func CreateLocation(c *gin.Context) {
+	var req LocationRequest
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Name) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Location name is required"})
+		return
+	}
+
+	location := models.Location{
+		Name:      strings.TrimSpace(req.Name),
+		IsDefault: req.IsDefault,
+		IsActive:  req.IsActive == nil || *req.IsActive,
+	}
+	if location.IsDefault && !location.IsActive {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The default location must be active"})
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if location.IsDefault {
+			if err := tx.Model(&models.Location{}).Where("is_default = ?", true).Update("is_default", false).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Create(&location).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "A location with that name already exists"})
+		return
+	}
+	c.JSON(http.StatusCreated, location)
+}
+
+// --- PUT: /api/locations/:id ---
+// UpdateLocation renames, (de)activates or promotes a location to default.
+// The default can only move by promoting another location, so the till always has one.
+func UpdateLocation(c *gin.Context) {
+	var location models.Location
+	if err := database.DB.First(&location, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Location not found"})
+		return
+	}
+	if location.IsTransit {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "This location holds a transfer in transit and can't be edited"})
+		return
+	}
+
+	var req LocationRequest
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Name) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Location name is required"})
+		return
+	}
+
+	isActive := req.IsActive == nil || *req.IsActive
+	if location.IsDefault && !req.IsDefault {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Make another location the default first"})
+		return
+	}
+	if (location.IsDefault || req.IsDefault) && !isActive {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The default location must be active"})
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if req.IsDefault && !location.IsDefault {
+			if err := tx.Model(&models.Location{}).Where("is_default = ?", true).Update("is_default", false).Error; err != nil {
+				return err
+			}
+		}
+		location.Name = strings.TrimSpace(req.Name)
+		location.IsDefault = req.IsDefault
+		location.IsActive = isActive
+		location.UpdatedAt = time.Now()
+		return tx.Save(&location).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "A location with that name already exists"})
+		return
+	}
+	c.JSON(http.StatusOK, location)
+}
+
+// --- GET: /api/locations/:id/stock ---
+// GetLocationStock lists what a location holds (non-zero balances only)
+func GetLocationStock(c *gin.Context) {
+	var location models.Location
+	if err := database.DB.First(&location, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Location not found"})
+		return
+	}
+
+	lines := []LocationStockLine{}
+	err := database.DB.Table("location_stocks").
+		Select("location_stocks.product_id, products.sku, products.name, location_stocks.quantity, products.cost_price, location_stocks.quantity * products.cost_price as total_cost").
+		Joins("JOIN products ON location_stocks.product_id = products.id").
+		Where("location_stocks.location_id = ? AND location_stocks.quantity <> 0", location.ID).
+		Order("products.name asc").
+		Scan(&lines).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch location stock"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"location": location, "products": lines})
+}
+
+// --- POST: /api/locations/:id/count ---
+// CountLocationStock records a stock count of one product at one location (e.g. goods received
+// straight into the back store). The difference is posted to the ledger at that location.
+func CountLocationStock(c *gin.Context) {
+	locationID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid location ID"})
+		return
+	}
+
+	var req LocationCountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Product and quantity are required"})
+		return
+	}
+	if *req.Quantity < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Counted quantity cannot be negative"})
+		return
+	}
+
+	var location models.Location
+	if err := database.DB.First(&location, locationID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Location not found"})
+		return
+	}
+	if location.IsTransit {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Stock in transit is settled by receiving or cancelling its transfer"})
+		return
+	}
+
+	userID := c.MustGet("userID").(uint)
+	var result *services.MovementResult
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		result, err = services.SetLocationStockLevel(tx, req.ProductID, location.ID, *req.Quantity, "Stock Count: "+location.Name, userID, "COUNT")
+		return err
+	})
+	if err != nil {
+		c.JSON(stockErrorStatus(err), gin.H{"error": "Failed to record count: " + err.Error()})
+		return
+	}
+
+	database.DB.Create(&models.AuditLog{
+		UserID:    userID,
+		Action:    "LOCATION_COUNT",
+		Details:   fmt.Sprintf("Counted %.3f of product #%d at %s. %s", *req.Quantity, req.ProductID, location.Name, req.Notes),
+		Timestamp: time.Now(),
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Count recorded", "product": result.Product, "ledger": result.Ledger})
+}
+
+// activeLocationID checks that a location exists and is in use, returning its ID (0 = the default location)
+func activeLocationID(db *gorm.DB, locationID uint) (uint, error) {
+	var location models.Location
+	query := db.Where("is_default = ?", true)
+	if locationID != 0 {
+		query = db.Where("id = ?", locationID)
+	}
+	if err := query.First(&location).Error; err != nil {
+		return 0, services.ErrLocationNotFound
+	}
+	if !location.IsActive {
+		return 0, fmt.Errorf("location %s is inactive", location.Name)
+	}
+	return location.ID, nil
+}
@@ -0,0 +1,519 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"go-pos-agent/internal/database"
+	"go-pos-agent/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-pdf/fpdf"
+	"gorm.io/gorm"
+)
+
+// reportArchiveDir is where the nightly job files a PDF copy of each day's reports (one folder per day)
+var reportArchiveDir = filepath.Join("C:\\NinePOS_Data", "reports")
+
+// reportPDF is an A4 document with the store header and "Page X of Y" footer on every page
+type reportPDF struct {
+	pdf *fpdf.Fpdf
+	tr  func(string) string
+}
+
+// StoreHeader is the shop identity printed at the top of every report
+type StoreHeader struct {
+	Name      string `json:"name"`
+	Address   string `json:"address"`
+	TaxNumber string `json:"tax_number"`
+}
+
+// currentStoreHeader reads the header from the store settings as they are now
+func currentStoreHeader(db *gorm.DB) StoreHeader {
+	var settings models.StoreSettings
+	db.First(&settings)
+	return StoreHeader{Name: settings.StoreName, Address: settings.StoreAddress, TaxNumber: settings.StoreTaxNumber}
+}
+
+// newReportPDF starts a report under the given store header. printedAt goes in the footer and the PDF
+// metadata, so a document rendered twice from the same data with the same printedAt is byte-for-byte identical.
+func newReportPDF(store StoreHeader, title string, subtitle string, printedAt time.Time) *reportPDF {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(10, 10, 10)
+	pdf.SetAutoPageBreak(true, 18)
+	pdf.AliasNbPages("")
+	pdf.SetCreationDate(printedAt)
+	pdf.SetModificationDate(printedAt)
+	pdf.SetTitle(title, true)
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+
+	pdf.SetHeaderFunc(func() {
+		pdf.SetFont("Helvetica", "B", 14)
+		pdf.CellFormat(0, 7, tr(store.Name), "", 1, "L", false, 0, "")
+
+		details := store.Address
+		if store.TaxNumber != "" {
+			details = strings.TrimSpace(details + "   SST No: " + store.TaxNumber)
+		}
+		if details != "" {
+			pdf.SetFont("Helvetica", "", 8)
+			pdf.CellFormat(0, 4, tr(details), "", 1, "L", false, 0, "")
+		}
+
+		pdf.Ln(2)
+		pdf.SetFont("Helvetica", "B", 12)
+		pdf.CellFormat(0, 6, tr(title), "", 1, "L", false, 0, "")
+		if subtitle != "" {
+			pdf.SetFont("Helvetica", "", 9)
+			pdf.CellFormat(0, 5, tr(subtitle), "", 1, "L", false, 0, "")
+		}
+
+		y := pdf.GetY() + 1
+		pdf.Line(10, y, 200, y)
+		pdf.SetY(y + 3)
+	})
+
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-13)
+		pdf.SetFont("Helvetica", "", 8)
+		pdf.CellFormat(95, 5, "Printed "+printedAt.Local().Format("02/01/2006 15:04"), "", 0, "L", false, 0, "")
+		pdf.CellFormat(95, 5, fmt.Sprintf("Page %d of {nb}", pdf.PageNo()), "", 0, "R", false, 0, "")
+	})
+
+	pdf.AddPage()
+	return &reportPDF{pdf: pdf, tr: tr}
+}
+
+// pdfTable draws rows under a column header that is repeated at the top of every new page
+type pdfTable struct {
+	doc     *reportPDF
+	headers []string
+	widths  []float64
+	aligns  []string // "L" or "R" per column
+}
+
+const pdfRowHeight = 5.5
+
+func (t *pdfTable) header() {
+	pdf := t.doc.pdf
+	pdf.SetFont("Helvetica", "B", 8)
+	pdf.SetFillColor(230, 230, 230)
+	for i, h := range t.headers {
+		pdf.CellFormat(t.widths[i], pdfRowHeight+0.5, t.doc.tr(h), "1", 0, t.aligns[i], true, 0, "")
+	}
+	pdf.Ln(-1)
+}
+
+// ensureSpace breaks the page early (and repeats the header) if the next h mm won't fit
+func (t *pdfTable) ensureSpace(h float64) {
+	pdf := t.doc.pdf
+	_, pageH := pdf.GetPageSize()
+	_, _, _, bottom := pdf.GetMargins()
+	if pdf.GetY()+h > pageH-bottom {
+		pdf.AddPage()
+		t.header()
+	}
+}
+
+// row writes one line; text longer than its column is cut to fit
+func (t *pdfTable) row(bold bool, cells ...string) {
+	t.ensureSpace(pdfRowHeight)
+	pdf := t.doc.pdf
+	style := ""
+	if bold {
+		style = "B"
+	}
+	pdf.SetFont("Helvetica", style, 8)
+	for i, cell := range cells {
+		text := t.doc.tr(cell)
+		for len(text) > 1 && pdf.GetStringWidth(text) > t.widths[i]-2 {
+			text = text[:len(text)-1]
+		}
+		pdf.CellFormat(t.widths[i], pdfRowHeight, text, "1", 0, t.aligns[i], false, 0, "")
+	}
+	pdf.Ln(-1)
+}
+
+// band writes a shaded line across the whole table (group headings and totals)
+func (t *pdfTable) band(label string, value string) {
+	t.ensureSpace(pdfRowHeight + 1)
+	pdf := t.doc.pdf
+	var total float64
+	for _, w := range t.widths {
+		total += w
+	}
+	last := t.widths[len(t.widths)-1]
+
+	pdf.SetFont("Helvetica", "B", 8)
+	pdf.SetFillColor(245, 245, 245)
+	pdf.CellFormat(total-last, pdfRowHeight+1, t.doc.tr(label), "1", 0, "L", true, 0, "")
+	pdf.CellFormat(last, pdfRowHeight+1, t.doc.tr(value), "1", 1, "R", true, 0, "")
+}
+
+// keyValues prints label/value pairs under a section heading (used for summaries)
+func (doc *reportPDF) keyValues(heading string, pairs [][2]string) {
+	table := &pdfTable{doc: doc, widths: []float64{130, 60}, aligns: []string{"L", "R"}}
+	table.ensureSpace(2*pdfRowHeight + 4)
+	doc.pdf.Ln(2)
+	doc.pdf.SetFont("Helvetica", "B", 10)
+	doc.pdf.CellFormat(0, 6, doc.tr(heading), "", 1, "L", false, 0, "")
+	for _, pair := range pairs {
+		table.row(false, pair[0], pair[1])
+	}
+}
+
+// pdfMoney formats an amount as "1,234.56" (negative amounts keep their sign)
+func pdfMoney(v float64) string {
+	sign := ""
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	whole := fmt.Sprintf("%.2f", v)
+	intPart, decimals := whole[:len(whole)-3], whole[len(whole)-3:]
+	var grouped []string
+	for len(intPart) > 3 {
+		grouped = append([]string{intPart[len(intPart)-3:]}, grouped...)
+		intPart = intPart[:len(intPart)-3]
+	}
+	grouped = append([]string{intPart}, grouped...)
+	return sign + strings.Join(grouped, ",") + decimals
+}
+
+// pdfQuantity drops the decimals on whole quantities and keeps three for weighed ones
+func pdfQuantity(v float64) string {
+	if v == float64(int64(v)) {
+		return fmt.Sprintf("%d", int64(v))
+	}
+	return fmt.Sprintf("%.3f", v)
+}
+
+// periodLabel describes a report window for a subtitle
+func periodLabel(start, end time.Time) string {
+	switch {
+	case start.IsZero() && end.IsZero():
+		return "All time"
+	case end.IsZero():
+		return "From " + start.Format("02/01/2006 15:04") + " to now"
+	case start.IsZero():
+		return "Up to " + end.Format("02/01/2006 15:04")
+	default:
+		return start.Format("02/01/2006 15:04") + " to " + end.Format("02/01/2006 15:04")
+	}
+}
+
+// valuationSubtitle names the location a valuation covers
+func valuationSubtitle(locationID string) string {
+	if locationID == "" {
+		return "All locations, stock on hand at cost"
+	}
+	var location models.Location
+	if err := database.DB.First(&location, locationID).Error; err != nil {
+		return "Location #" + locationID
+	}
+	return location.Name + ", stock on hand at cost"
+}
+
+// renderValuationPDF lays out a valuation the way the dashboard shows it: one block per category
+func renderValuationPDF(title string, subtitle string, response ValuationResponse, printedAt time.Time) *fpdf.Fpdf {
+	doc := newReportPDF(currentStoreHeader(database.DB), title, subtitle, printedAt)
+	table := &pdfTable{
+		doc:     doc,
+		headers: []string{"Product", "Category", "Qty", "Unit Cost", "Total Cost", "Sell Price", "Potential Profit"},
+		widths:  []float64{58, 30, 16, 20, 22, 20, 24},
+		aligns:  []string{"L", "L", "R", "R", "R", "R", "R"},
+	}
+	table.header()
+
+	for _, group := range response.Categories {
+		table.band(strings.ToUpper(group.CategoryName), "")
+		items := append([]ValuationItem(nil), group.Items...)
+		sort.Slice(items, func(i, j int) bool { return items[i].Name < items[j].Name })
+		for _, item := range items {
+			table.row(false, item.Name, item.Category, pdfQuantity(item.Quantity), pdfMoney(item.CostPrice),
+				pdfMoney(item.TotalCost), pdfMoney(item.SellPrice), pdfMoney(item.TotalProfit))
+		}
+		table.row(true, "Subtotal "+group.CategoryName, "", "", "", pdfMoney(group.Subtotal), "", pdfMoney(group.ProfitSubtotal))
+	}
+
+	doc.keyValues("Totals", [][2]string{
+		{"Total stock value (cost)", "RM " + pdfMoney(response.GrandTotal)},
+		{"Total potential profit", "RM " + pdfMoney(response.GrandTotalProfit)},
+	})
+	if response.InTransitTotal > 0 {
+		doc.keyValues("Stock in transit", [][2]string{{"Dispatched, not yet received (cost)", "RM " + pdfMoney(response.InTransitTotal)}})
+	}
+	return doc.pdf
+}
+
+// renderZReportPDF prints a shift report; Z-reports carry their issue time so every reprint is identical
+func renderZReportPDF(report ShiftReport) *fpdf.Fpdf {
+	title := "X-Report (mid-shift reading)"
+	if report.Kind == "Z" {
+		title = fmt.Sprintf("Z-Report #%06d", report.ZNumber)
+	}
+	subtitle := fmt.Sprintf("Shift #%d, opened %s by %s", report.ShiftID, report.OpenedAt.Local().Format("02/01/2006 15:04"), report.OpenedBy)
+	if report.ClosedAt != nil {
+		subtitle += fmt.Sprintf(", closed %s by %s", report.ClosedAt.Local().Format("02/01/2006 15:04"), report.ClosedBy)
+	}
+	// The header is the one frozen into the report when it was issued, so a reprint matches the original.
+	// Z-reports issued before the header was frozen fall back to the current settings.
+	store := report.Store
+	if store == (StoreHeader{}) {
+		store = currentStoreHeader(database.DB)
+	}
+	doc := newReportPDF(store, title, subtitle, report.GeneratedAt)
+
+	tenders := [][2]string{}
+	for _, t := range report.Tenders {
+		tenders = append(tenders, [2]string{fmt.Sprintf("%s (%d)", strings.ToUpper(t.Method), t.Count), pdfMoney(t.Amount)})
+	}
+	tenders = append(tenders,
+		[2]string{fmt.Sprintf("Gross sales (%d transactions)", report.TransactionCount), pdfMoney(report.GrossSales)},
+		[2]string{"Items sold", fmt.Sprintf("%.3f", report.ItemsSold)},
+		[2]string{"Average sale", pdfMoney(report.AverageSale)},
+	)
+	doc.keyValues("Sales by tender", tenders)
+
+	doc.keyValues("Tax", [][2]string{
+		{fmt.Sprintf("Taxable sales (SST %.0f%%)", report.SSTRatePercent), pdfMoney(report.TaxableSales)},
+		{"Non-taxable sales", pdfMoney(report.NonTaxableSales)},
+		{"SST included", pdfMoney(report.SSTAmount)},
+	})
+
+	doc.keyValues("Corrections", [][2]string{
+		{fmt.Sprintf("Voids (%d)", report.VoidCount), pdfMoney(report.VoidValue)},
+		{"Line voids", fmt.Sprintf("%d", report.LineVoidCount)},
+	})
+
+	drawer := [][2]string{}
+	for _, p := range report.Payouts {
+		drawer = append(drawer, [2]string{"Payout: " + p.Type + " " + p.Description, "-" + pdfMoney(p.Amount)})
+	}
+	drawer = append(drawer,
+		[2]string{"Payouts total", pdfMoney(report.PayoutTotal)},
+		[2]string{"No-sale drawer opens", fmt.Sprintf("%d (%d cancelled)", report.DrawerOpenCount, report.DrawerOpenCancel)},
+	)
+	doc.keyValues("Drawer", drawer)
+
+	cash := [][2]string{
+		{"Opening float", pdfMoney(report.OpeningCash)},
+		{"Cash sales", pdfMoney(report.CashSales)},
+		{"Payouts", "-" + pdfMoney(report.PayoutTotal)},
+		{"Expected in drawer", pdfMoney(report.ExpectedCash)},
+	}
+	if report.CountedCash != nil && report.OverShort != nil {
+		cash = append(cash,
+			[2]string{"Counted", pdfMoney(*report.CountedCash)},
+			[2]string{"Over / short", fmt.Sprintf("%+.2f", *report.OverShort)},
+		)
+	}
+	doc.keyValues("Cash", cash)
+
+	doc.pdf.Ln(4)
+	doc.pdf.SetFont("Helvetica", "", 8)
+	doc.pdf.CellFormat(0, 4, doc.tr("Issued by "+report.GeneratedBy), "", 1, "L", false, 0, "")
+	return doc.pdf
+}
+
+// renderExpensePDF prints the P&L summary, expenses grouped by type and the full expense list
+func renderExpensePDF(report ExpenseReport, period string, printedAt time.Time) *fpdf.Fpdf {
+	doc := newReportPDF(currentStoreHeader(database.DB), "Expenses & Profit", period, printedAt)
+
+	doc.keyValues("Summary", [][2]string{
+		{"Gross profit from sales", "RM " + pdfMoney(report.GrossProfit)},
+		{"Total expenses", "RM " + pdfMoney(report.TotalExpenses)},
+		{"Standing profit", "RM " + pdfMoney(report.StandingProfit)},
+	})
+
+	byType := make(map[string]float64)
+	for _, e := range report.Expenses {
+		byType[e.ExpenseType] += e.Amount
+	}
+	types := make([]string, 0, len(byType))
+	for t := range byType {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	typeLines := [][2]string{}
+	for _, t := range types {
+		typeLines = append(typeLines, [2]string{t, pdfMoney(byType[t])})
+	}
+	doc.keyValues("Expenses by type", typeLines)
+
+	doc.pdf.Ln(4)
+	table := &pdfTable{
+		doc:     doc,
+		headers: []string{"Date", "Type", "Description", "From Till", "Logged By", "Amount"},
+		widths:  []float64{26, 28, 72, 16, 26, 22},
+		aligns:  []string{"L", "L", "L", "L", "L", "R"},
+	}
+	table.ensureSpace(3 * pdfRowHeight)
+	table.header()
+	for _, e := range report.Expenses {
+		fromTill := "No"
+		if e.PaidFromTill {
+			fromTill = "Yes"
+		}
+		table.row(false, e.Date.Local().Format("02/01/2006 15:04"), e.ExpenseType, e.Description, fromTill, e.LoggedBy, pdfMoney(e.Amount))
+	}
+	table.band("Total expenses", pdfMoney(report.TotalExpenses))
+	return doc.pdf
+}
+
+// writePDF sends a finished document as a download
+func writePDF(c *gin.Context, pdf *fpdf.Fpdf, fileName string) {
+	c.Header("Content-Description", "File Transfer")
+	c.Header("Content-Disposition", "attachment; filename="+fileName)
+	c.Header("Content-Type", "application/pdf")
+
+	if err := pdf.Output(c.Writer); err != nil {
+		fmt.Println("Error writing report PDF:", err)
+	}
+}
+
+func writeValuationPDF(c *gin.Context, title string, subtitle string, response ValuationResponse) {
+	fileName := fmt.Sprintf("%s_%s.pdf", strings.ToLower(strings.ReplaceAll(title, " ", "_")), time.Now().Format("20060102_150405"))
+	writePDF(c, renderValuationPDF(title, subtitle, response, time.Now()), fileName)
+}
+
+func writeExpensePDF(c *gin.Context, report ExpenseReport, period string) {
+	writePDF(c, renderExpensePDF(report, period, time.Now()), fmt.Sprintf("expenses_%s.pdf", time.Now().Format("20060102_150405")))
+}
+
+// ArchiveDailyReports files PDF copies into C:\NinePOS_Data\reports\<YYYY-MM-DD>\: every Z-report not archived yet,
+// yesterday's stock received and expenses, and a snapshot of the stock valuation as it stands now.
+// Existing files are never overwritten, so running it twice (or on every start-up) is harmless.
+func ArchiveDailyReports() {
+	now := time.Now()
+	yesterday := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).AddDate(0, 0, -1)
+	endOfYesterday := yesterday.Add(24*time.Hour - time.Second)
+	archived := 0
+
+	save := func(day time.Time, fileName string, render func() (*fpdf.Fpdf, error)) {
+		dir := filepath.Join(reportArchiveDir, day.Format("2006-01-02"))
+		path := filepath.Join(dir, fileName)
+		if _, err := os.Stat(path); err == nil {
+			return
+		}
+		pdf, err := render()
+		if err != nil {
+			log.Printf("⚠️ REPORT ARCHIVE: %s skipped: %v", fileName, err)
+			return
+		}
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			log.Printf("❌ REPORT ARCHIVE: cannot create %s: %v", dir, err)
+			return
+		}
+		if err := pdf.OutputFileAndClose(path); err != nil {
+			log.Printf("❌ REPORT ARCHIVE: failed to write %s: %v", path, err)
+			return
+		}
+		archived++
+	}
+
+	// 1. Z-reports, filed under the day they were issued
+	var zReports []models.ZReport
+	database.DB.Select("z_number", "generated_at").Order("z_number asc").Find(&zReports)
+	for _, z := range zReports {
+		number := fmt.Sprintf("%d", z.ZNumber)
+		save(z.GeneratedAt.Local(), fmt.Sprintf("z_report_%06d.pdf", z.ZNumber), func() (*fpdf.Fpdf, error) {
+			view, err := loadZReport(number)
+			if err != nil {
+				return nil, err
+			}
+			return renderZReportPDF(view.Report), nil
+		})
+	}
+
+	// 2. Yesterday's stock received and expenses (both can be rebuilt exactly for a past day)
+	save(yesterday, "historical_valuation.pdf", func() (*fpdf.Fpdf, error) {
+		response, err := buildHistoricalValuation(yesterday, endOfYesterday)
+		if err != nil {
+			return nil, err
+		}
+		subtitle := fmt.Sprintf("Stock received %s", yesterday.Format("02/01/2006"))
+		return renderValuationPDF("Historical Valuation", subtitle, response, now), nil
+	})
+	save(yesterday, "expenses.pdf", func() (*fpdf.Fpdf, error) {
+		report, err := buildExpenseReport(yesterday, endOfYesterday)
+		if err != nil {
+			return nil, err
+		}
+		return renderExpensePDF(report, periodLabel(yesterday, endOfYesterday), now), nil
+	})
+
+	// 3. Stock on hand can't be rebuilt later at today's costs, so snapshot it as of this run
+	save(now, "stock_valuation.pdf", func() (*fpdf.Fpdf, error) {
+		response, err := buildStockValuation("")
+		if err != nil {
+			return nil, err
+		}
+		return renderValuationPDF("Stock Valuation", valuationSubtitle(""), response, now), nil
+	})
+
+	if archived > 0 {
+		log.Printf("🗄️ REPORT ARCHIVE: %d PDF(s) filed in %s", archived, reportArchiveDir)
+	}
+}
+
+// ArchivedReportDay is one day's folder in the report archive
+type ArchivedReportDay struct {
+	Date  string   `json:"date"`
+	Files []string `json:"files"`
+}
+
+// archiveDayPattern guards the download route against path tricks
+var archiveDayPattern = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+
+// --- GET: /api/reports/archive ---
+// GetReportArchive lists the archived PDFs, newest day first
+func GetReportArchive(c *gin.Context) {
+	days := []ArchivedReportDay{}
+	entries, err := os.ReadDir(reportArchiveDir)
+	if err != nil && !os.IsNotExist(err) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read report archive"})
+		return
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() || !archiveDayPattern.MatchString(entry.Name()) {
+			continue
+		}
+		day := ArchivedReportDay{Date: entry.Name(), Files: []string{}}
+		files, _ := os.ReadDir(filepath.Join(reportArchiveDir, entry.Name()))
+		for _, f := range files {
+			if !f.IsDir() && strings.HasSuffix(f.Name(), ".pdf") {
+				day.Files = append(day.Files, f.Name())
+			}
+		}
+		days = append(days, day)
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Date > days[j].Date })
+
+	c.JSON(http.StatusOK, days)
+}
+
+// --- GET: /api/reports/archive/:date/:file ---
+// DownloadArchivedReport returns one archived PDF exactly as it was filed
+func DownloadArchivedReport(c *gin.Context) {
+	day, file := c.Param("date"), c.Param("file")
+	if !archiveDayPattern.MatchString(day) || filepath.Base(file) != file || !strings.HasSuffix(file, ".pdf") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid archive path"})
+		return
+	}
+
+	path := filepath.Join(reportArchiveDir, day, file)
+	if _, err := os.Stat(path); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Archived report not found"})
+		return
+	}
+	c.FileAttachment(path, day+"_"+file)
+}
@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"go-pos-agent/internal/database"
+	"go-pos-agent/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// inventoryPurchaseTypes are expense types that buy stock. That money comes back through cost of goods sold
+// when the stock sells, so counting it again as an expense would charge it twice.
+var inventoryPurchaseTypes = map[string]bool{"restock": true}
+
+// ProfitAndLoss is one month's statement
+type ProfitAndLoss struct {
+	Month           string             `json:"month"` // YYYY-MM
+	GrossSales      float64            `json:"gross_sales"`
+	Discounts       float64            `json:"discounts"` // Cart discounts given at the till
+	NetSales        float64            `json:"net_sales"`
+	CostOfGoodsSold float64            `json:"cost_of_goods_sold"`
+	GrossMargin     float64            `json:"gross_margin"`
+	GrossMarginPct  float64            `json:"gross_margin_pct"`
+	Rounding        float64            `json:"rounding"`  // Cash rounding gained (+) or given away (-)
+	Shrinkage       float64            `json:"shrinkage"` // Approved write-offs at cost
+	Expenses        map[string]float64 `json:"expenses"`  // By ExpenseType
+	TotalExpenses   float64            `json:"total_expenses"`
+	NetProfit       float64            `json:"net_profit"`
+	NetMarginPct    float64            `json:"net_margin_pct"`
+	StockPurchases  float64            `json:"stock_purchases"` // Memo only: restock spending, already in COGS as it sells
+	Orders          int64              `json:"orders"`
+}
+
+// PnLLine is one row of the statement with its comparison columns
+type PnLLine struct {
+	Key           string   `json:"key"`
+	Label         string   `json:"label"`
+	Section       string   `json:"section"` // "revenue", "cost", "expense", "result" or "memo"
+	Current       float64  `json:"current"`
+	PreviousMonth float64  `json:"previous_month"`
+	LastYear      float64  `json:"last_year"`
+	MoMChange     float64  `json:"mom_change"`
+	MoMPct        *float64 `json:"mom_pct"` // nil when the previous figure was zero
+	YoYChange     float64  `json:"yoy_change"`
+	YoYPct        *float64 `json:"yoy_pct"`
+}
+
+// --- GET: /api/reports/pnl?month=YYYY-MM ---
+// GetMonthlyPnL builds the profit and loss statement for a month (default: this month) next to the
+// previous month and the same month last year
+func GetMonthlyPnL(c *gin.Context) {
+	now := time.Now()
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	if value := c.Query("month"); value != "" {
+		parsed, err := time.ParseInLocation("2006-01", value, now.Location())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid month, expected YYYY-MM"})
+			return
+		}
+		month = parsed
+	}
+
+	var statements [3]ProfitAndLoss
+	for i, m := range []time.Time{month, month.AddDate(0, -1, 0), month.AddDate(-1, 0, 0)} {
+		statement, err := buildMonthlyPnL(m)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build profit and loss for " + m.Format("2006-01")})
+			return
+		}
+		statements[i] = statement
+	}
+	current, previous, lastYear := statements[0], statements[1], statements[2]
+
+	// 1. Fixed lines, in statement order
+	pick := func(f func(ProfitAndLoss) float64) [3]float64 {
+		return [3]float64{f(current), f(previous), f(lastYear)}
+	}
+	lines := []PnLLine{
+		pnlLine("gross_sales", "Gross sales", "revenue", pick(func(p ProfitAndLoss) float64 { return p.GrossSales })),
+		pnlLine("discounts", "Less: discounts", "revenue", pick(func(p ProfitAndLoss) float64 { return -p.Discounts })),
+		pnlLine("net_sales", "Net sales", "revenue", pick(func(p ProfitAndLoss) float64 { return p.NetSales })),
+		pnlLine("cogs", "Less: cost of goods sold", "cost", pick(func(p ProfitAndLoss) float64 { return -p.CostOfGoodsSold })),
+		pnlLine("gross_margin", "Gross margin", "result", pick(func(p ProfitAndLoss) float64 { return p.GrossMargin })),
+		pnlLine("rounding", "Cash rounding", "cost", pick(func(p ProfitAndLoss) float64 { return p.Rounding })),
+		pnlLine("shrinkage", "Less: shrinkage (write-offs)", "cost", pick(func(p ProfitAndLoss) float64 { return -p.Shrinkage })),
+	}
+
+	// 2. One line per expense type seen in any of the three months
+	types := make(map[string]bool)
+	for _, p := range []ProfitAndLoss{current, previous, lastYear} {
+		for t := range p.Expenses {
+			types[t] = true
+		}
+	}
+	sortedTypes := make([]string, 0, len(types))
+	for t := range types {
+		sortedTypes = append(sortedTypes, t)
+	}
+	sort.Strings(sortedTypes)
+	for _, t := range sortedTypes {
+		lines = append(lines, pnlLine("expense:"+t, "Less: "+t, "expense",
+			[3]float64{-current.Expenses[t], -previous.Expenses[t], -lastYear.Expenses[t]}))
+	}
+
+	lines = append(lines,
+		pnlLine("total_expenses", "Total expenses", "expense", pick(func(p ProfitAndLoss) float64 { return -p.TotalExpenses })),
+		pnlLine("net_profit", "Net profit", "result", pick(func(p ProfitAndLoss) float64 { return p.NetProfit })),
+		pnlLine("stock_purchases", "Stock purchases (memo, not an expense)", "memo", pick(func(p ProfitAndLoss) float64 { return p.StockPurchases })),
+	)
+
+	c.JSON(http.StatusOK, gin.H{
+		"month":          current.Month,
+		"previous_month": previous.Month,
+		"last_year":      lastYear.Month,
+		"lines":          lines,
+		"statements":     []ProfitAndLoss{current, previous, lastYear},
+	})
+}
+
+// buildMonthlyPnL totals one calendar month (local time)
+func buildMonthlyPnL(month time.Time) (ProfitAndLoss, error) {
+	start := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, month.Location())
+	end := start.AddDate(0, 1, 0)
+	pnl := ProfitAndLoss{Month: start.Format("2006-01"), Expenses: make(map[string]float64)}
+
+	// 1. Sales: gross at shelf price and cost, with the discounts and cash rounding the receipts recorded
+	sales, err := salesReportFilters{Start: start, End: end.Add(-time.Nanosecond)}.totals()
+	if err != nil {
+		return pnl, err
+	}
+	pnl.GrossSales, pnl.CostOfGoodsSold = sales.Revenue, sales.Cost
+	pnl.Orders, pnl.Discounts, pnl.Rounding = sales.Orders, sales.Discounts, sales.Rounding
+
+	// 2. Shrinkage: write-offs count in the month they were approved
+	err = database.DB.Model(&models.StockAdjustment{}).
+		Select("COALESCE(SUM(total_cost), 0)").
+		Where("status = ? AND approved_at >= ? AND approved_at < ?", "approved", start, end).
+		Row().Scan(&pnl.Shrinkage)
+	if err != nil {
+		return pnl, err
+	}
+
+	// 3. Expenses by type (stock purchases kept aside)
+	var expenses []struct {
+		ExpenseType string
+		Amount      float64
+	}
+	err = database.DB.Model(&models.Expense{}).
+		Select("expense_type, SUM(amount) as amount").
+		Where("date >= ? AND date < ?", start, end).
+		Group("expense_type").
+		Scan(&expenses).Error
+	if err != nil {
+		return pnl, err
+	}
+	for _, e := range expenses {
+		label := strings.TrimSpace(e.ExpenseType)
+		if label == "" {
+			label = "Uncategorised"
+		}
+		if inventoryPurchaseTypes[strings.ToLower(label)] {
+			pnl.StockPurchases += e.Amount
+			continue
+		}
+		pnl.Expenses[label] += e.Amount
+		pnl.TotalExpenses += e.Amount
+	}
+
+	// 4. Results
+	pnl.NetSales = pnl.GrossSales - pnl.Discounts
+	pnl.GrossMargin = pnl.NetSales - pnl.CostOfGoodsSold
+	pnl.NetProfit = pnl.GrossMargin + pnl.Rounding - pnl.Shrinkage - pnl.TotalExpenses
+	if pnl.NetSales != 0 {
+		pnl.GrossMarginPct = pnl.GrossMargin / pnl.NetSales * 100
+		pnl.NetMarginPct = pnl.NetProfit / pnl.NetSales * 100
+	}
+	return pnl, nil
+}
+
+// pnlLine fills in the month-over-month and year-over-year differences for one row
+func pnlLine(key, label, section string, values [3]float64) PnLLine {
+	line := PnLLine{
+		Key:           key,
+		Label:         label,
+		Section:       section,
+		Current:       values[0],
+		PreviousMonth: values[1],
+		LastYear:      values[2],
+		MoMChange:     values[0] - values[1],
+		YoYChange:     values[0] - values[2],
+	}
+	line.MoMPct = percentChange(values[0], values[1])
+	line.YoYPct = percentChange(values[0], values[2])
+	return line
+}
+
+// percentChange is the change relative to the size of the earlier figure; nil when there's nothing to compare against
+func percentChange(current, earlier float64) *float64 {
+	if earlier == 0 {
+		return nil
+	}
+	pct := (current - earlier) / math.Abs(earlier) * 100
+	return &pct
+}
@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"go-pos-agent/internal/database"
+	"go-pos-agent/internal/models"
+	"go-pos-agent/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// --- GET: /api/products/:id/price-history ---
+// GetPriceHistory lists every price change for a product (newest first).
+// Pass ?at=YYYY-MM-DD or ?at=YYYY-MM-DDTHH:MM to also get the price that was in effect at that moment.
+func GetPriceHistory(c *gin.Context) {
+	var product models.Product
+	if err := database.DB.First(&product, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+
+	var history []models.PriceHistory
+	if err := database.DB.Where("product_id = ?", product.ID).Order("changed_at desc").Find(&history).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch price history"})
+		return
+	}
+
+	response := gin.H{
+		"product_id":    product.ID,
+		"product_name":  product.Name,
+		"current_price": product.Price,
+		"history":       history,
+	}
+
+	// Optional: "What was the price of X on this date?"
+	if atStr := c.Query("at"); atStr != "" {
+		at, err := parsePointInTime(atStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		response["at"] = at
+		response["price_at"] = services.PriceAt(database.DB, product, at)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// SchedulePriceRequest defines the payload for a future-dated price change
+type SchedulePriceRequest struct {
+	NewPrice    float64 `json:"new_price" binding:"required"`
+	EffectiveAt string  `json:"effective_at" binding:"required"` // "YYYY-MM-DDTHH:MM" in store local time
+	Note        string  `json:"note"`
+}
+
+// --- POST: /api/products/:id/scheduled-prices ---
+// SchedulePriceChange queues a price (e.g., a Friday promotion) for the background scheduler
+func SchedulePriceChange(c *gin.Context) {
+	var product models.Product
+	if err := database.DB.First(&product, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+
+	var req SchedulePriceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "New price and effective time are required"})
+		return
+	}
+
+	if req.NewPrice < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Price cannot be negative"})
+		return
+	}
+
+	effectiveAt, err := time.ParseInLocation("2006-01-02T15:04", req.EffectiveAt, time.Now().Location())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid effective_at, expected YYYY-MM-DDTHH:MM"})
+		return
+	}
+	if effectiveAt.Before(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Effective time must be in the future. Use the normal product edit for immediate changes."})
+		return
+	}
+
+	scheduled := models.ScheduledPriceChange{
+		ProductID:   product.ID,
+		NewPrice:    req.NewPrice,
+		EffectiveAt: effectiveAt,
+		Status:      "pending",
+		Note:        req.Note,
+		CreatedBy:   c.MustGet("userID").(uint),
+		CreatedAt:   time.Now(),
+	}
+
+	if err := database.DB.Create(&scheduled).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to schedule price change"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Price change scheduled", "scheduled": scheduled})
+}
+
+// --- GET: /api/scheduled-prices ---
+// GetScheduledPriceChanges lists queued price changes (?status=pending by default, ?status=all for everything)
+func GetScheduledPriceChanges(c *gin.Context) {
+	var changes []models.ScheduledPriceChange
+
+	query := database.DB.Preload("Product").Order("effective_at asc")
+	if status := c.DefaultQuery("status", "pending"); status != "all" {
+		query = query.Where("status = ?", status)
+	}
+
+	if err := query.Find(&changes).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch scheduled price changes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, changes)
+}
+
+// --- DELETE: /api/scheduled-prices/:id ---
+// CancelScheduledPriceChange stops a pending price change from being applied
+func CancelScheduledPriceChange(c *gin.Context) {
+	var scheduled models.ScheduledPriceChange
+	if err := database.DB.First(&scheduled, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Scheduled price change not found"})
+		return
+	}
+
+	if scheduled.Status != "pending" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Price change has already been " + scheduled.Status})
+		return
+	}
+
+	// Only if it is still pending: the scheduler may be applying it right now
+	result := database.DB.Model(&models.ScheduledPriceChange{}).Where("id = ? AND status = ?", scheduled.ID, "pending").Update("status", "cancelled")
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel scheduled price change"})
+		return
+	}
+	if result.RowsAffected != 1 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Price change is no longer pending, reload it"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Scheduled price change cancelled"})
+}
+
+// errScheduledPriceTaken means a due price change stopped being pending before the scheduler got to it
+var errScheduledPriceTaken = errors.New("scheduled price change is no longer pending")
+
+// ApplyScheduledPriceChanges is the background job (run every minute from main.go) that applies
+// every pending price change whose time has come, writing price history and an audit entry.
+func ApplyScheduledPriceChanges() {
+	var due []models.ScheduledPriceChange
+	if err := database.DB.Where("status = ? AND effective_at <= ?", "pending", time.Now()).Order("effective_at asc").Find(&due).Error; err != nil {
+		log.Printf("❌ PRICING: Failed to read due price changes: %v", err)
+		return
+	}
+
+	weighableChanged := false
+	for _, scheduled := range due {
+		var product models.Product
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			// Claim it first: a change cancelled since it was read stays cancelled
+			now := time.Now()
+			claim := tx.Model(&models.ScheduledPriceChange{}).Where("id = ? AND status = ?", scheduled.ID, "pending").
+				Updates(map[string]interface{}{"status": "applied", "applied_at": &now})
+			if claim.Error != nil {
+				return claim.Error
+			}
+			if claim.RowsAffected != 1 {
+				return errScheduledPriceTaken
+			}
+
+			if err := tx.First(&product, scheduled.ProductID).Error; err != nil {
+				return err
+			}
+
+			before := product
+			if err := tx.Model(&product).Update("price", scheduled.NewPrice).Error; err != nil {
+				return err
+			}
+
+			if err := services.RecordPriceChange(tx, before, scheduled.NewPrice, before.CostPrice, "Scheduled", scheduled.CreatedBy); err != nil {
+				return err
+			}
+
+			return tx.Create(&models.AuditLog{
+				UserID:    scheduled.CreatedBy,
+				Action:    "SCHEDULED_PRICE_APPLIED",
+				Details:   fmt.Sprintf("Scheduled price #%d applied to %s: RM %.2f -> RM %.2f", scheduled.ID, product.Name, before.Price, scheduled.NewPrice),
+				Timestamp: now,
+			}).Error
+		})
+
+		switch {
+		case errors.Is(err, errScheduledPriceTaken):
+			log.Printf("🏷️ PRICING: Scheduled price #%d was cancelled or applied elsewhere, skipped", scheduled.ID)
+		case err != nil:
+			log.Printf("❌ PRICING: Failed to apply scheduled price #%d: %v", scheduled.ID, err)
+		default:
+			weighableChanged = weighableChanged || product.IsWeighable
+			log.Printf("🏷️ PRICING: Scheduled price #%d applied (RM %.2f)", scheduled.ID, scheduled.NewPrice)
+		}
+	}
+
+	// One scale sync for the whole batch of weighable price changes
+	if weighableChanged {
+		services.TriggerScaleSync(database.DB, "scheduled_price")
+	}
+}
@@ -135,3 +135,18 @@ func OpenDrawerSecurely(c *gin.Context) {
 		"log_id":  logEntry.ID,
 	})
 }
+
+// sendRawToPrinter copies a raw ESC/POS job to a shared Windows printer, exactly like the drawer kick
+func sendRawToPrinter(printerName string, data []byte, fileName string) error {
+	tempFile := filepath.Join(os.TempDir(), fileName)
+	if err := os.WriteFile(tempFile, data, 0644); err != nil {
+		return fmt.Errorf("failed to write print job: %v", err)
+	}
+
+	sharePath := fmt.Sprintf(`\\127.0.0.1\%s`, printerName)
+	cmd := exec.Command("cmd", "/C", "copy", "/b", tempFile, sharePath)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to send job to %s: %v", sharePath, err)
+	}
+	return nil
+}
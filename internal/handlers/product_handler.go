@@ -2,19 +2,24 @@ package handlers
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"log"
+	"math"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"go-pos-agent/internal/database"
 	"go-pos-agent/internal/models"
+	"go-pos-agent/internal/scale"
 	"go-pos-agent/internal/services"
 	"go-pos-agent/internal/utils"
 
 	"github.com/gin-gonic/gin"
-	"github.com/xuri/excelize/v2"
+	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
 
@@ -23,8 +28,11 @@ import (
 func GetProducts(c *gin.Context) {
 	var products []models.Product
 
+	// Archived products are hidden unless the dashboard explicitly asks for them (?archived=true)
+	showArchived := c.Query("archived") == "true"
+
 	// Fetch from DB
-	result := database.DB.Find(&products)
+	result := database.DB.Where("is_archived = ?", showArchived).Find(&products)
 	if result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch products"})
 		return
@@ -33,36 +41,116 @@ func GetProducts(c *gin.Context) {
 	c.JSON(http.StatusOK, products)
 }
 
+// AddProductRequest is a new product. is_sst_applicable and the scale fields are pointers so that
+// leaving them out (take the default) can be told apart from an explicit false or zero.
+type AddProductRequest struct {
+	models.Product
+	IsSSTApplicable *bool `json:"is_sst_applicable"`
+	ScaleDepartment *int  `json:"scale_department"`
+	ShelfLifeDays   *int  `json:"shelf_life_days"`
+}
+
+// Scale fields given to new products that leave them out
+const (
+	defaultScaleDepartment = 21
+	defaultShelfLifeDays   = 15
+)
+
 // --- POST: Add a new product ---
 func AddProduct(c *gin.Context) {
-	var newProduct models.Product
+	var req AddProductRequest
 
 	// 1. Parse JSON Input
-	if err := c.ShouldBindJSON(&newProduct); err != nil {
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
 		return
 	}
+	newProduct := req.Product
+	if req.IsSSTApplicable != nil {
+		newProduct.IsSSTApplicable = *req.IsSSTApplicable
+	}
+	newProduct.ScaleDepartment, newProduct.ShelfLifeDays = defaultScaleDepartment, defaultShelfLifeDays
+	if req.ScaleDepartment != nil {
+		newProduct.ScaleDepartment = *req.ScaleDepartment
+	}
+	if req.ShelfLifeDays != nil {
+		newProduct.ShelfLifeDays = *req.ShelfLifeDays
+	}
 
-	// 2. Save to DB
-	if err := database.DB.Create(&newProduct).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create product"})
+	// --- NEW: Category Validation ---
+	// Unknown names are rejected instead of silently creating a phantom category
+	category, err := resolveProductCategory(newProduct.CategoryID, newProduct.Category)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-
-	// --- NEW: Ledger Interceptor ---
-	// If the user created the product with initial stock, log it in the ledger!
-	if newProduct.StockQuantity > 0 {
-		ledgerEntry := models.StockLedger{
-			ProductID:    newProduct.ID,
-			ChangeAmount: newProduct.StockQuantity,
-			Balance:      newProduct.StockQuantity,
-			Reason:       "Initial Setup",
-			CreatedAt:    time.Now(),
+	if category != nil {
+		newProduct.CategoryID = &category.ID
+		newProduct.Category = category.Name
+		if req.IsSSTApplicable == nil {
+			newProduct.IsSSTApplicable = category.DefaultSST
 		}
-		database.DB.Create(&ledgerEntry) // Silently save in background
 	}
 	// -------------------------------
 
+	// Scale fields left out of the JSON got the defaults above; an explicit 0 is kept
+	if err := validateScaleFields(newProduct.ScaleDepartment, newProduct.ShelfLifeDays, newProduct.TareWeight); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// A SKU held by an archived product can't be reused (the unique index would reject it): offer the restore
+	if archived, found := findArchivedSKU(database.DB, strings.TrimSpace(newProduct.SKU)); found {
+		c.JSON(http.StatusConflict, archivedSKUResponse(archived))
+		return
+	}
+
+	// 2. Save to DB. Opening stock is posted through the inventory service so it lands in the ledger.
+	openingStock := newProduct.StockQuantity
+	newProduct.StockQuantity = 0
+	userID := c.MustGet("userID").(uint)
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		// --- NEW: In-Store Barcodes ---
+		// Loose items without a manufacturer barcode get the next internal EAN-13.
+		// Weighables are skipped: the scale prints their barcode from the PLU code.
+		if strings.TrimSpace(newProduct.SKU) == "" && !newProduct.IsWeighable {
+			code, err := services.AllocateInternalBarcode(tx)
+			if err != nil {
+				return err
+			}
+			newProduct.SKU = code
+		}
+
+		if err := tx.Create(&newProduct).Error; err != nil {
+			return err
+		}
+		if openingStock == 0 {
+			return nil
+		}
+
+		result, err := services.ApplyMovement(tx, services.StockMovement{
+			ProductID: newProduct.ID,
+			Change:    openingStock,
+			Reason:    "Initial Setup",
+			UserID:    userID,
+		})
+		if err != nil {
+			return err
+		}
+		newProduct.StockQuantity = result.Product.StockQuantity
+		return nil
+	})
+	if err != nil {
+		c.JSON(stockErrorStatus(err), gin.H{"error": "Failed to create product: " + err.Error()})
+		return
+	}
+
+	// Networked label scales pick up the new PLU in the background
+	if newProduct.IsWeighable {
+		services.TriggerScaleSync(database.DB, "product_update")
+	}
+
 	c.JSON(http.StatusCreated, newProduct)
 }
 
@@ -88,7 +176,7 @@ func UpdateProduct(c *gin.Context) {
 	}
 
 	// --- UPGRADED: Ledger Preparation (Fractional Weights) ---
-	oldStock := product.StockQuantity
+	// Stock is never written directly: it is pulled out of the update and posted as a movement
 	var newStock float64 // MUST BE float64
 	stockChanged := false
 
@@ -98,30 +186,102 @@ func UpdateProduct(c *gin.Context) {
 			newStock = val // Directly use the float64
 			stockChanged = true
 		}
+		delete(updateData, "stock_quantity")
 	}
+	delete(updateData, "scale_plu") // Allocated by the scale sync, never edited
 	// -------------------------------
 
-	// 4. Save updates to the Product
-	if err := database.DB.Model(&product).Updates(updateData).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update product"})
+	// --- NEW: Category Validation ---
+	// Either field may be sent; both are always saved together so the display copy never drifts
+	_, nameSent := updateData["category"]
+	_, idSent := updateData["category_id"]
+	if nameSent || idSent {
+		var categoryID *uint
+		if val, ok := updateData["category_id"].(float64); ok {
+			id := uint(val)
+			categoryID = &id
+		}
+		categoryName, _ := updateData["category"].(string)
+
+		category, err := resolveProductCategory(categoryID, categoryName)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if category != nil {
+			updateData["category_id"] = category.ID
+			updateData["category"] = category.Name
+		} else {
+			updateData["category_id"] = nil
+			updateData["category"] = ""
+		}
+	}
+	// -------------------------------
+
+	// --- NEW: Scale Field Validation ---
+	department, shelfLife, tare := product.ScaleDepartment, product.ShelfLifeDays, product.TareWeight
+	if val, ok := updateData["scale_department"].(float64); ok {
+		department = int(val)
+	}
+	if val, ok := updateData["shelf_life_days"].(float64); ok {
+		shelfLife = int(val)
+	}
+	if val, ok := updateData["tare_weight"].(float64); ok {
+		tare = val
+	}
+	if err := validateScaleFields(department, shelfLife, tare); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	// -------------------------------
 
-	// --- NEW: Ledger Interceptor ---
-	// If the stock was changed, calculate the difference and record it
-	if stockChanged && oldStock != newStock {
-		changeAmount := newStock - oldStock // e.g., 50 - 40 = +10
-		ledgerEntry := models.StockLedger{
-			ProductID:    product.ID,
-			ChangeAmount: changeAmount,
-			Balance:      newStock,
-			Reason:       "Manual Audit / Restock",
-			CreatedAt:    time.Now(),
-		}
-		database.DB.Create(&ledgerEntry)
+	// --- NEW: Price History Preparation ---
+	// Keep a copy of the product as it was, so the history can record old -> new
+	productBefore := product
+	newPrice, newCostPrice := product.Price, product.CostPrice
+	if val, ok := updateData["price"].(float64); ok {
+		newPrice = val
+	}
+	if val, ok := updateData["cost_price"].(float64); ok {
+		newCostPrice = val
 	}
 	// -------------------------------
 
+	// 4. Save updates, price history and the stock movement together
+	userID := c.MustGet("userID").(uint)
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if len(updateData) > 0 {
+			if err := tx.Model(&product).Updates(updateData).Error; err != nil {
+				return err
+			}
+		}
+
+		// --- NEW: Price History Interceptor ---
+		if err := services.RecordPriceChange(tx, productBefore, newPrice, newCostPrice, "API", userID); err != nil {
+			return err
+		}
+
+		// --- NEW: Ledger Interceptor (via the inventory service) ---
+		if stockChanged {
+			result, err := services.SetStockLevel(tx, product.ID, newStock, "Manual Audit / Restock", userID, "")
+			if err != nil {
+				return err
+			}
+			product.StockQuantity = result.Product.StockQuantity
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(stockErrorStatus(err), gin.H{"error": "Failed to update product: " + err.Error()})
+		return
+	}
+
+	// --- NEW: Scale Sync ---
+	// Only changed PLUs go out, so it's safe to trigger on every edit of a weighable
+	if product.IsWeighable || productBefore.IsWeighable {
+		services.TriggerScaleSync(database.DB, "price_update")
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "Product updated successfully", "product": product})
 }
 
@@ -137,6 +297,8 @@ type SaleRequest struct {
 	RequestEInvoice bool    `json:"request_einvoice"`
 	PaymentMethod   string  `json:"payment_method"`  // <-- NEW: Catch from React
 	AmountTendered  float64 `json:"amount_tendered"` // <-- NEW: Catch from React
+	LocationID      uint    `json:"location_id"`     // The till's branch; 0 = the cashier's branch (or the default location)
+	Discount        float64 `json:"discount"`        // Cart discount in RM, off the whole receipt
 }
 
 func ProcessSale(c *gin.Context) {
@@ -152,67 +314,88 @@ func ProcessSale(c *gin.Context) {
 	// 1. Start a Database Transaction (ACID Safety)
 	tx := database.DB.Begin()
 
-	var totalAmount float64
+	var lineTotal float64
 	var saleItems []models.SaleItem
+	var stockWarnings []string
 
-	// 2. Loop through cart items
-	for _, item := range req.Items {
-		var product models.Product
+	// Generate a Unique Receipt ID (up front, so every ledger row can point at it)
+	uniqueReceiptID := fmt.Sprintf("RCPT-%d", time.Now().Unix())
 
-		// Lock the row to prevent race conditions
-		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&product, item.ProductID).Error; err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Product %d not found", item.ProductID)})
-			return
+	// --- NEW: Branch Stock ---
+	// Stock leaves the branch the till sits in: the till's own location, else the cashier's branch, else the default
+	requestedLocation := req.LocationID
+	if requestedLocation == 0 {
+		var cashier models.User
+		if err := tx.Select("id", "location_id").First(&cashier, userID).Error; err == nil && cashier.LocationID != nil {
+			requestedLocation = *cashier.LocationID
 		}
+	}
+	locationID, err := activeLocationID(tx, requestedLocation)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot sell from this location: " + err.Error()})
+		return
+	}
 
-		// Check Stock
-		if product.StockQuantity < item.Quantity {
+	// 2. Loop through cart items
+	for _, item := range req.Items {
+		// Archived products are off the till; a stale cart or a cached screen can still send one
+		var listed models.Product
+		if err := tx.Select("id", "name", "is_archived", "merged_into_id").First(&listed, item.ProductID).Error; err != nil {
 			tx.Rollback()
-			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Insufficient stock for %s", product.Name)})
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Product #%d not found", item.ProductID)})
 			return
 		}
-
-		// --- UPGRADED: Standard vs Gas Engine Math (Phase B) ---
-		// Always deduct the full product stock (because a full tank is leaving the store)
-		product.StockQuantity -= item.Quantity
-
-		// If this is a Gas Cylinder AND the customer returned an empty tank, increase our empty stock
-		if product.IsGas && item.IsEmptyExchange {
-			product.EmptyCylinderStock += item.Quantity
+		// A merged-away duplicate is sold as the product it was merged into
+		if listed.MergedIntoID != nil {
+			survivor, err := mergeSurvivor(tx, listed)
+			if err != nil {
+				tx.Rollback()
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+			listed = survivor
 		}
-		// -------------------------------------------------------
-
-		if err := tx.Save(&product).Error; err != nil {
+		if listed.IsArchived {
 			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update stock"})
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("%s is archived and can no longer be sold", listed.Name)})
 			return
 		}
 
-		// Deduct Stock
-		product.StockQuantity -= item.Quantity
-		if err := tx.Save(&product).Error; err != nil {
+		// --- UPGRADED: Central Inventory Service ---
+		// Locks the row, enforces the negative-stock policy and writes the ledger in one place.
+		// Always deduct the full product stock (because a full tank is leaving the store)
+		result, err := services.ApplyMovement(tx, services.StockMovement{
+			ProductID:      listed.ID,
+			Change:         -item.Quantity,
+			Reason:         "Sale Checkout",
+			UserID:         userID,
+			SourceDocument: uniqueReceiptID,
+			LocationID:     locationID,
+		})
+		if err != nil {
 			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update stock"})
+			c.JSON(stockErrorStatus(err), gin.H{"error": err.Error()})
 			return
 		}
-
-		// --- Ledger Interceptor ---
-		ledgerEntry := models.StockLedger{
-			ProductID:    product.ID,
-			ChangeAmount: -item.Quantity,
-			Balance:      product.StockQuantity,
-			Reason:       "Sale Checkout",
-			CreatedAt:    time.Now(),
+		product := result.Product
+		if result.Warning != "" {
+			stockWarnings = append(stockWarnings, result.Warning)
 		}
-		if err := tx.Create(&ledgerEntry).Error; err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write audit ledger"})
-			return
+
+		// --- Gas Engine Math (Phase B) ---
+		// If this is a Gas Cylinder AND the customer returned an empty tank, increase our empty stock
+		if product.IsGas && item.IsEmptyExchange {
+			if err := tx.Model(&product).Update("empty_cylinder_stock", gorm.Expr("empty_cylinder_stock + ?", item.Quantity)).Error; err != nil {
+				tx.Rollback()
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update stock"})
+				return
+			}
 		}
+		// -------------------------------------------------------
 
 		// Calculate Price for this item
-		totalAmount += product.Price * item.Quantity
+		lineTotal += product.Price * item.Quantity
 
 		// Prepare Sale Item record
 		saleItems = append(saleItems, models.SaleItem{
@@ -223,16 +406,26 @@ func ProcessSale(c *gin.Context) {
 		})
 	}
 
-	// Generate a Unique Receipt ID
-	uniqueReceiptID := fmt.Sprintf("RCPT-%d", time.Now().Unix())
+	// 3. Cart discount, then cash rounding on what's left (both kept on the receipt for the reports)
+	discount := math.Round(req.Discount*100) / 100
+	if discount < 0 || discount > lineTotal {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Discount must be between 0 and the cart total"})
+		return
+	}
+	rounding := services.CashRounding(req.PaymentMethod, lineTotal-discount)
+	totalAmount := math.Round((lineTotal-discount+rounding)*100) / 100
 
-	// 3. Create the Sale Header
+	// 4. Create the Sale Header
 	sale := models.Sale{
 		ReceiptID:      uniqueReceiptID,
 		UserID:         userID,
 		TotalAmount:    totalAmount,
+		Discount:       discount,
+		Rounding:       rounding,
 		PaymentMethod:  req.PaymentMethod,  // <-- NEW: Save to Database
 		AmountTendered: req.AmountTendered, // <-- NEW: Save to Database
+		LocationID:     locationID,
 		SaleTime:       time.Now(),
 		Status:         "completed",
 		Items:          saleItems,
@@ -244,9 +437,14 @@ func ProcessSale(c *gin.Context) {
 		return
 	}
 
-	// 4. Commit Transaction
+	// 5. Commit Transaction
 	tx.Commit()
 
+	// --- NEW: Daily Sales Summaries (the nightly rebuild repairs the day if this fails) ---
+	if err := services.RecordSaleInSummaries(database.DB, sale); err != nil {
+		log.Printf("⚠️ SUMMARIES: Failed to add sale %s to the daily summaries: %v", sale.ReceiptID, err)
+	}
+
 	// ==========================================
 	// --- NEW: LHDN Sandbox Integration ---
 	// ==========================================
@@ -262,29 +460,276 @@ func ProcessSale(c *gin.Context) {
 	}
 	// ==========================================
 
-	// 5. Final Response Payload
+	// 6. Final Response Payload
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Sale successful!",
-		"sale_id": sale.ID,
-		"total":   totalAmount,
-		"lhdn":    lhdnData, // <-- NEW: Passes the Mock QR URL and Validation ID back to React
+		"message":  "Sale successful!",
+		"sale_id":  sale.ID,
+		"total":    totalAmount,
+		"discount": discount,
+		"rounding": rounding,
+		"lhdn":     lhdnData, // <-- NEW: Passes the Mock QR URL and Validation ID back to React
+
+		// Only filled when the negative-stock policy is "warn"
+		"stock_warnings": stockWarnings,
 	})
 }
 
 // --- DELETE: Remove a product ---
+// Products with any history (sales, ledger, write-offs, price changes) are ARCHIVED instead of deleted,
+// so old receipts and reports keep working. Only never-used products (e.g., a typo) are hard deleted.
 func DeleteProduct(c *gin.Context) {
-	id := c.Param("id")
+	var product models.Product
+	if err := database.DB.First(&product, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+
+	// 1. Check if anything in the books points at this product
+	if !productHasHistory(database.DB, product.ID) {
+		if err := database.DB.Delete(&product).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not delete product"})
+			return
+		}
+		if product.IsWeighable {
+			services.TriggerScaleSync(database.DB, "product_delete")
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Product deleted successfully", "archived": false})
+		return
+	}
+
+	// 2. It has history: archive it instead
+	if product.IsArchived {
+		c.JSON(http.StatusConflict, gin.H{"error": "Product is already archived"})
+		return
+	}
+
+	if err := archiveProduct(database.DB, &product); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to archive product"})
+		return
+	}
+
+	database.DB.Create(&models.AuditLog{
+		UserID:    c.MustGet("userID").(uint),
+		Action:    "ARCHIVE_PRODUCT",
+		Details:   fmt.Sprintf("Archived %s (SKU %s) with %.3f in stock", product.Name, product.SKU, product.StockQuantity),
+		Timestamp: time.Now(),
+	})
+
+	if product.IsWeighable {
+		services.TriggerScaleSync(database.DB, "product_archive")
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Product has sales or stock history, so it was archived instead of deleted",
+		"archived": true,
+		"product":  product,
+	})
+}
+
+// --- POST: /api/products/:id/unarchive ---
+// UnarchiveProduct brings an archived product back onto the till
+func UnarchiveProduct(c *gin.Context) {
+	var product models.Product
+	if err := database.DB.First(&product, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+
+	if !product.IsArchived {
+		c.JSON(http.StatusConflict, gin.H{"error": "Product is not archived"})
+		return
+	}
+
+	if product.MergedIntoID != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Product was merged into product #%d and cannot be restored", *product.MergedIntoID)})
+		return
+	}
 
-	// Attempt to delete
-	// Unscoped() is optional: use it if you want to PERMANENTLY remove it.
-	// Without Unscoped(), GORM will just set a "deleted_at" timestamp (Soft Delete) if your model supports it.
-	if err := database.DB.Delete(&models.Product{}, id).Error; err != nil {
-		// This usually happens if the product is linked to existing sales (Foreign Key Constraint)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Could not delete product. It might be linked to past sales."})
+	database.DB.Model(&product).Updates(map[string]interface{}{"is_archived": false, "archived_at": nil})
+
+	database.DB.Create(&models.AuditLog{
+		UserID:    c.MustGet("userID").(uint),
+		Action:    "UNARCHIVE_PRODUCT",
+		Details:   fmt.Sprintf("Restored %s (SKU %s)", product.Name, product.SKU),
+		Timestamp: time.Now(),
+	})
+
+	if product.IsWeighable {
+		services.TriggerScaleSync(database.DB, "product_update")
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Product restored successfully", "product": product})
+}
+
+// MergeProductRequest names the product that survives the merge
+type MergeProductRequest struct {
+	IntoProductID uint `json:"into_product_id" binding:"required"`
+}
+
+// --- POST: /api/products/:id/merge ---
+// MergeProduct folds a duplicate product (:id) into another one: its sales lines, ledger rows,
+// write-offs and price history move across, its stock is added on, and the duplicate is archived.
+func MergeProduct(c *gin.Context) {
+	var req MergeProductRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "into_product_id is required"})
+		return
+	}
+
+	sourceID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || uint(sourceID) == req.IntoProductID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Pick two different products to merge"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Product deleted successfully"})
+	userID := c.MustGet("userID").(uint)
+	var source, target models.Product
+	status := http.StatusBadRequest
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		// 1. Lock both rows so no checkout sneaks in mid-merge
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&source, sourceID).Error; err != nil {
+			return fmt.Errorf("Duplicate product not found")
+		}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&target, req.IntoProductID).Error; err != nil {
+			return fmt.Errorf("Target product not found")
+		}
+		if source.MergedIntoID != nil {
+			return fmt.Errorf("Product was already merged into product #%d", *source.MergedIntoID)
+		}
+		// Stock and history must land on a product that is still on sale
+		if target.MergedIntoID != nil {
+			status = http.StatusConflict
+			return fmt.Errorf("Target product was itself merged into product #%d, merge into that one instead", *target.MergedIntoID)
+		}
+		if target.IsArchived {
+			status = http.StatusConflict
+			return fmt.Errorf("Target product is archived, restore it before merging into it")
+		}
+
+		// 2. Move the duplicate's stock across as two ledgered movements per location
+		// (out of the source, into the target), so each room keeps what it physically holds
+		var balances []models.LocationStock
+		tx.Where("product_id = ? AND quantity <> 0", source.ID).Find(&balances)
+		for _, balance := range balances {
+			if _, err := services.ApplyMovement(tx, services.StockMovement{
+				ProductID:      source.ID,
+				Change:         -balance.Quantity,
+				Reason:         fmt.Sprintf("Product Merge (into #%d %s)", target.ID, target.Name),
+				UserID:         userID,
+				SourceDocument: "MERGE",
+				LocationID:     balance.LocationID,
+			}); err != nil {
+				return fmt.Errorf("Failed to move stock: %v", err)
+			}
+			result, err := services.ApplyMovement(tx, services.StockMovement{
+				ProductID:      target.ID,
+				Change:         balance.Quantity,
+				Reason:         fmt.Sprintf("Product Merge (from #%d %s)", source.ID, source.Name),
+				UserID:         userID,
+				SourceDocument: "MERGE",
+				LocationID:     balance.LocationID,
+			})
+			if err != nil {
+				return fmt.Errorf("Failed to move stock: %v", err)
+			}
+			target.StockQuantity = result.Product.StockQuantity
+		}
+		if source.EmptyCylinderStock != 0 {
+			target.EmptyCylinderStock += source.EmptyCylinderStock
+			if err := tx.Model(&target).Update("empty_cylinder_stock", target.EmptyCylinderStock).Error; err != nil {
+				return fmt.Errorf("Failed to update stock")
+			}
+		}
+
+		// 3. Re-point the history tables at the surviving product. The moved ledger rows sum to the
+		// duplicate's final zero, so the target's ledger still adds up to its stock.
+		for _, table := range []string{"sale_items", "stock_ledgers", "stock_adjustments", "price_histories", "stock_transfer_items"} {
+			if err := tx.Table(table).Where("product_id = ?", source.ID).Update("product_id", target.ID).Error; err != nil {
+				return fmt.Errorf("Failed to move %s", table)
+			}
+		}
+		if err := tx.Model(&models.ComboComponent{}).Where("component_product_id = ?", source.ID).Update("component_product_id", target.ID).Error; err != nil {
+			return fmt.Errorf("Failed to move bundle components")
+		}
+
+		// The daily summaries still list the duplicate (and maybe its category), so rebuild its days from the moved sales
+		if _, err := services.RebuildSummariesForProduct(tx, source.ID); err != nil {
+			return fmt.Errorf("Failed to update the daily sales summaries")
+		}
+		if err := tx.Model(&models.ScheduledPriceChange{}).Where("product_id = ? AND status = ?", source.ID, "pending").Update("status", "cancelled").Error; err != nil {
+			return fmt.Errorf("Failed to cancel scheduled price changes")
+		}
+
+		// 4. Retire the duplicate
+		source.MergedIntoID = &target.ID
+		if err := tx.Model(&source).Updates(map[string]interface{}{"empty_cylinder_stock": 0, "merged_into_id": target.ID}).Error; err != nil {
+			return fmt.Errorf("Failed to retire duplicate product")
+		}
+		if err := archiveProduct(tx, &source); err != nil {
+			return fmt.Errorf("Failed to archive duplicate product")
+		}
+
+		return tx.Create(&models.AuditLog{
+			UserID:    userID,
+			Action:    "MERGE_PRODUCT",
+			Details:   fmt.Sprintf("Merged #%d %s (SKU %s) into #%d %s (SKU %s)", source.ID, source.Name, source.SKU, target.ID, target.Name, target.SKU),
+			Timestamp: time.Now(),
+		}).Error
+	})
+
+	if err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	if source.IsWeighable || target.IsWeighable {
+		services.TriggerScaleSync(database.DB, "product_merge")
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Products merged successfully", "product": target})
+}
+
+// productHasHistory reports whether any sale, ledger row, write-off or price change references the product
+func productHasHistory(db *gorm.DB, productID uint) bool {
+	for _, table := range []string{"sale_items", "stock_ledgers", "stock_adjustments", "price_histories"} {
+		var count int64
+		db.Table(table).Where("product_id = ?", productID).Count(&count)
+		if count > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// archiveProduct hides a product from the till and cancels its pending scheduled prices
+func archiveProduct(db *gorm.DB, product *models.Product) error {
+	now := time.Now()
+	if err := db.Model(product).Updates(map[string]interface{}{"is_archived": true, "archived_at": &now}).Error; err != nil {
+		return err
+	}
+	return db.Model(&models.ScheduledPriceChange{}).Where("product_id = ? AND status = ?", product.ID, "pending").Update("status", "cancelled").Error
+}
+
+// findArchivedSKU returns the archived product holding a SKU. Archived products keep their (unique) SKU so
+// old receipts still resolve, which means the code can't be reused: the caller offers a restore instead.
+func findArchivedSKU(db *gorm.DB, sku string) (models.Product, bool) {
+	var product models.Product
+	if sku == "" || db.Where("sku = ? AND is_archived = ?", sku, true).First(&product).Error != nil {
+		return product, false
+	}
+	return product, true
+}
+
+// archivedSKUResponse is the 409 payload for a SKU that belongs to an archived product
+func archivedSKUResponse(product models.Product) gin.H {
+	response := gin.H{"sku": product.SKU, "archived": true, "product_id": product.ID, "merged_into_id": product.MergedIntoID}
+	if product.MergedIntoID != nil {
+		response["error"] = fmt.Sprintf("%s was merged into product #%d", product.Name, *product.MergedIntoID)
+	} else {
+		response["error"] = fmt.Sprintf("%s is archived, restore it?", product.Name)
+	}
+	return response
 }
 
 // --- UPLOAD: Handle Image Files ---
@@ -332,26 +777,61 @@ func ScanProduct(c *gin.Context) {
 	// 1. Grab the scanned barcode string from the URL parameter
 	barcode := c.Param("barcode")
 
-	// 2. Pass the barcode through our new parsing engine
-	scaleData := utils.ParseEAN13(barcode)
+	// 2. Pass the barcode through the store's configured scale layouts
+	scaleData, err := utils.ParseScaleBarcode(barcode, services.LoadScaleBarcodeLayouts(database.DB))
+	if err != nil {
+		// A misread must not fall through to "Product not found" (that opens the Add Product modal)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Barcode misread, please scan again", "sku": barcode})
+		return
+	}
 
-	var product models.Product
+	var result ScanResult
 
 	if scaleData.IsScaleBarcode {
-		// 3. SCALE ITEM DETECTED: Lookup the base product using the 5-digit ItemID.
-		// We assume your Deli/Meat base products are saved with their 5-digit SKU.
-		if err := database.DB.Where("sku = ?", scaleData.ItemID).First(&product).Error; err != nil {
+		// 3. SCALE ITEM DETECTED: Lookup the base product using the embedded ItemID.
+		// We assume your Deli/Meat base products are saved with their scale item code as SKU.
+		if err := scanLookup(database.DB, scaleData.ItemID, &result); err != nil {
+			if archived, found := findArchivedSKU(database.DB, scaleData.ItemID); found {
+				c.JSON(http.StatusConflict, archivedSKUResponse(archived))
+				return
+			}
 			c.JSON(http.StatusNotFound, gin.H{"error": "Base scale product not found", "sku": scaleData.ItemID})
 			return
 		}
+		result.ScaleFormat = scaleData.Layout
 
-		// 4. DYNAMIC OVERRIDE: Replace the database base price with the exact calculated price
-		// embedded in the physical barcode sticker so the cart charges the right amount.
-		product.Price = scaleData.CalculatedPrice
+		if scaleData.ValueType == "weight" {
+			// 4a. WEIGHT LABEL: keep the per-kg price, the cart takes the weight as its quantity
+			weight := scaleData.CalculatedPrice
+			result.ScaleQuantity = &weight
+		} else {
+			// 4b. PRICE LABEL: Replace the database base price with the exact calculated price
+			// embedded in the physical barcode sticker so the cart charges the right amount.
+			price := scaleData.CalculatedPrice
+			result.Product.Price = price
+			result.EmbeddedPrice = &price
+		}
 
 	} else {
 		// 5. STANDARD ITEM DETECTED: Do a direct 1-to-1 lookup for the full 13 digits.
-		if err := database.DB.Where("sku = ?", barcode).First(&product).Error; err != nil {
+		// Scanners set to send every code as EAN-13 put a 0 in front of UPC-A (12-digit) SKUs: try without it.
+		err := scanLookup(database.DB, barcode, &result)
+		if err != nil && len(barcode) == 13 && barcode[0] == '0' {
+			err = scanLookup(database.DB, barcode[1:], &result)
+		}
+		if err != nil {
+			// A 13-digit code with a broken check digit is a misread, not a new product
+			if len(barcode) == 13 && !utils.IsValidEAN13(barcode) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Barcode misread, please scan again", "sku": barcode})
+				return
+			}
+
+			// An archived product keeps its SKU: offer to restore it rather than opening "Add Product"
+			if archived, found := findArchivedSKU(database.DB, barcode); found {
+				c.JSON(http.StatusConflict, archivedSKUResponse(archived))
+				return
+			}
+
 			// Returning a 404 is crucial here!
 			// In Task 1.3, the React frontend will use this exact 404 to auto-trigger the "Add Product" modal.
 			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found", "sku": barcode})
@@ -360,100 +840,190 @@ func ScanProduct(c *gin.Context) {
 	}
 
 	// 6. Return the perfectly formatted product back to the frontend
-	c.JSON(http.StatusOK, product)
+	c.JSON(http.StatusOK, result)
+}
+
+// ScanResult is the scanned product plus whatever a scale label embedded in the barcode.
+// The product fields stay at the top level so existing till code keeps working.
+type ScanResult struct {
+	models.Product
+	ScaleQuantity *float64 `json:"scale_quantity,omitempty"` // Weight (kg) from a weight-embedded label: use as the cart quantity
+	EmbeddedPrice *float64 `json:"embedded_price,omitempty"` // Price from a price-embedded label (already copied into "price")
+	ScaleFormat   string   `json:"scale_format,omitempty"`   // Which scale layout matched
+	MergedFrom    *uint    `json:"merged_from,omitempty"`    // The scanned SKU belongs to this merged-away product: "product" is the one it became
 }
 
-// --- GET: /api/products/scale-export ---
-// Generates a native .xlsx file compatible with advanced scale software
+// scanLookup finds the product on sale under a scanned SKU. The SKU of a merged-away duplicate still
+// rings up, as the product it was merged into (result.MergedFrom says so).
+func scanLookup(db *gorm.DB, sku string, result *ScanResult) error {
+	if err := db.Where("sku = ? AND is_archived = ?", sku, false).First(&result.Product).Error; err == nil {
+		return nil
+	}
+	duplicate, found := findArchivedSKU(db, sku)
+	if !found || duplicate.MergedIntoID == nil {
+		return gorm.ErrRecordNotFound
+	}
+	survivor, err := mergeSurvivor(db, duplicate)
+	if err != nil || survivor.IsArchived {
+		return gorm.ErrRecordNotFound
+	}
+	result.Product = survivor
+	result.MergedFrom = &duplicate.ID
+	return nil
+}
+
+// mergeSurvivor follows a merged-away product to the product that holds its stock and history now
+// (a target can itself be merged later on, so this may take more than one step)
+func mergeSurvivor(db *gorm.DB, product models.Product) (models.Product, error) {
+	for hops := 0; product.MergedIntoID != nil; hops++ {
+		if hops == 10 {
+			return product, fmt.Errorf("%s has too many merges chained after it", product.Name)
+		}
+		var target models.Product
+		if err := db.First(&target, *product.MergedIntoID).Error; err != nil {
+			return product, fmt.Errorf("%s was merged into a product that no longer exists", product.Name)
+		}
+		product = target
+	}
+	return product, nil
+}
+
+// --- GET: /api/products/scale-export?format=rongta|digi|cas|csv ---
+// Generates the PLU file for the store's label scales (Rongta .xlsx by default)
 func ExportWeighableProducts(c *gin.Context) {
-	var products []models.Product
+	exporter, err := scale.GetExporter(c.DefaultQuery("format", "rongta"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	// 1. Only fetch items explicitly marked as weighable
-	if err := database.DB.Where("is_weighable = ?", true).Find(&products).Error; err != nil {
+	records, err := services.WeighablePLURecords(database.DB)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch weighable products"})
 		return
 	}
 
-	// 2. Initialize a new Excel File
-	f := excelize.NewFile()
-	defer func() {
-		if err := f.Close(); err != nil {
-			fmt.Println("Error closing excel file:", err)
-		}
-	}()
+	// 2. Write the file in the scale brand's own layout
+	var b bytes.Buffer
+	if err := exporter.Write(&b, records); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate scale file"})
+		return
+	}
+
+	// 3. Force the browser to download it under the name the scale software expects
+	c.Header("Content-Description", "File Transfer")
+	c.Header("Content-Disposition", "attachment; filename="+exporter.FileName())
+	c.Header("Content-Type", exporter.ContentType())
+
+	c.Data(http.StatusOK, exporter.ContentType(), b.Bytes())
+}
 
-	// 3. Write the exact Column Headers expected by the Rongta Scale Software (Row 1)
-	// We include all 24 columns to guarantee perfect copy-paste alignment.
-	headers := []string{
-		"Hotkey", "Name", "LFCode", "Code", "Barcode Type", "Unit Price",
-		"Unit Weight", "Unit Amount", "Department", "PT Weight", "Shelf Time",
-		"Pack Type", "Tare", "Error(%)", "Message1", "Message2", "Label",
-		"Discount/Table", "Account", "sPluFieldTitle20", "Account",
-		"Recommend days", "nutrition", "Ice(%)",
+// --- POST: /api/products/scale-import?format=rongta|digi|cas|csv ---
+// CheckScalePLUFile reads a PLU file exported back from the scale software and reports
+// where the scale disagrees with the catalogue (price, name, department, shelf life, tare).
+// Nothing is changed: the fix is to re-send the export to the scale.
+func CheckScalePLUFile(c *gin.Context) {
+	exporter, err := scale.GetExporter(c.DefaultQuery("format", "rongta"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	for i, header := range headers {
-		cell, _ := excelize.CoordinatesToCellName(i+1, 1)
-		f.SetCellValue("Sheet1", cell, header)
+	// 1. Receive the uploaded file
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Please upload the scale's PLU file as 'file'"})
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Could not open uploaded file"})
+		return
 	}
+	defer file.Close()
 
-	// 4. Loop through the products and write the rows (Starting at Row 2)
-	for i, p := range products {
-		row := i + 2 // i starts at 0, headers are on row 1
+	// 2. Parse it with the brand's reader
+	onScale, err := exporter.Read(file)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Could not read PLU file: " + err.Error()})
+		return
+	}
 
-		itemCode := p.SKU
-		if itemCode == "" {
-			itemCode = fmt.Sprintf("%d", p.ID) // Fallback if no SKU exists
-		}
+	// 3. Compare against what we would export right now
+	expected, err := services.WeighablePLURecords(database.DB)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch weighable products"})
+		return
+	}
+	drifts := scale.CompareRecords(expected, onScale)
 
-		// --- SMART HOTKEY LOGIC ---
-		// Convert the 5-digit SKU (e.g., "00007") into a simple scale key (7).
-		pluInt, err := strconv.Atoi(itemCode)
-		var hotkey string
-		if err == nil && pluInt > 0 {
-			hotkey = fmt.Sprintf("%d", pluInt)
-		} else {
-			hotkey = fmt.Sprintf("%d", i+1)
-		}
-
-		// Fill out the 24 columns with your real data and safe Rongta defaults
-		f.SetCellValue("Sheet1", fmt.Sprintf("A%d", row), hotkey)   // Hotkey
-		f.SetCellValue("Sheet1", fmt.Sprintf("B%d", row), p.Name)   // Name
-		f.SetCellValue("Sheet1", fmt.Sprintf("C%d", row), hotkey)   // LFCode
-		f.SetCellValue("Sheet1", fmt.Sprintf("D%d", row), itemCode) // Code (SKU)
-		f.SetCellValue("Sheet1", fmt.Sprintf("E%d", row), 2)        // Barcode Type
-		f.SetCellValue("Sheet1", fmt.Sprintf("F%d", row), p.Price)  // Unit Price
-		f.SetCellValue("Sheet1", fmt.Sprintf("G%d", row), "Kg")     // Unit Weight
-		f.SetCellValue("Sheet1", fmt.Sprintf("H%d", row), 0)        // Unit Amount
-		f.SetCellValue("Sheet1", fmt.Sprintf("I%d", row), 21)       // Department
-		f.SetCellValue("Sheet1", fmt.Sprintf("J%d", row), "0.000")  // PT Weight
-		f.SetCellValue("Sheet1", fmt.Sprintf("K%d", row), 15)       // Shelf Time
-		f.SetCellValue("Sheet1", fmt.Sprintf("L%d", row), "Normal") // Pack Type
-		f.SetCellValue("Sheet1", fmt.Sprintf("M%d", row), "0.000")  // Tare
-		f.SetCellValue("Sheet1", fmt.Sprintf("N%d", row), 0)        // Error(%)
-		f.SetCellValue("Sheet1", fmt.Sprintf("O%d", row), 0)        // Message1
-		f.SetCellValue("Sheet1", fmt.Sprintf("P%d", row), 0)        // Message2
-		f.SetCellValue("Sheet1", fmt.Sprintf("Q%d", row), 0)        // Label
-		f.SetCellValue("Sheet1", fmt.Sprintf("R%d", row), 0)        // Discount/Table
-		f.SetCellValue("Sheet1", fmt.Sprintf("S%d", row), 0)        // Account
-		f.SetCellValue("Sheet1", fmt.Sprintf("T%d", row), "")       // sPluFieldTitle20
-		f.SetCellValue("Sheet1", fmt.Sprintf("U%d", row), 0)        // Account
-		f.SetCellValue("Sheet1", fmt.Sprintf("V%d", row), 0)        // Recommend days
-		f.SetCellValue("Sheet1", fmt.Sprintf("W%d", row), 0)        // nutrition
-		f.SetCellValue("Sheet1", fmt.Sprintf("X%d", row), 0)        // Ice(%)
-	}
-
-	// 5. Write the Excel file to a memory buffer
-	var b bytes.Buffer
-	if err := f.Write(&b); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate Excel file"})
+	c.JSON(http.StatusOK, gin.H{
+		"format":         exporter.Name(),
+		"items_on_scale": len(onScale),
+		"items_expected": len(expected),
+		"in_sync":        len(drifts) == 0,
+		"drift":          drifts,
+	})
+}
+
+// validateScaleFields rejects values the scales can't store
+func validateScaleFields(department int, shelfLifeDays int, tare float64) error {
+	// CAS scales address the department in one byte, so every brand is held to that range
+	if department < 0 || department > 255 {
+		return fmt.Errorf("Scale department must be between 0 and 255")
+	}
+	if shelfLifeDays < 0 || shelfLifeDays > 999 {
+		return fmt.Errorf("Shelf life must be between 0 and 999 days")
+	}
+	if tare < 0 || tare > 9.999 {
+		return fmt.Errorf("Tare must be between 0 and 9.999 kg")
+	}
+	return nil
+}
+
+// stockErrorStatus maps inventory service errors onto HTTP status codes
+func stockErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrInsufficientStock):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrProductNotFound), errors.Is(err, services.ErrLocationNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrStockAtSeveralLocations):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// --- GET: /api/products/:id/barcode.png ---
+// GetProductBarcodeImage renders the product's EAN-13 for label printing (?scale= pixels per bar, ?height= pixels)
+func GetProductBarcodeImage(c *gin.Context) {
+	var product models.Product
+	if err := database.DB.First(&product, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
 		return
 	}
 
-	// 6. Force the browser to download this as a native Excel file (.xlsx)
-	c.Header("Content-Description", "File Transfer")
-	c.Header("Content-Disposition", "attachment; filename=rongta_plu_export.xlsx")
-	c.Header("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	if !utils.IsValidEAN13(product.SKU) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Product SKU is not a valid EAN-13 barcode"})
+		return
+	}
+
+	pixelScale, _ := strconv.Atoi(c.DefaultQuery("scale", "3"))
+	if pixelScale < 1 || pixelScale > 10 {
+		pixelScale = 3
+	}
+	height, _ := strconv.Atoi(c.DefaultQuery("height", "120"))
+	if height < 20 || height > 1000 {
+		height = 120
+	}
+
+	img, err := utils.RenderEAN13PNG(product.SKU, pixelScale, height)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render barcode"})
+		return
+	}
 
-	c.Data(http.StatusOK, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", b.Bytes())
+	c.Data(http.StatusOK, "image/png", img)
 }
@@ -0,0 +1,253 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"time"
+
+	"go-pos-agent/internal/database"
+	"go-pos-agent/internal/models"
+	"go-pos-agent/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// LedgerDrift compares a product's live stock with what its ledger says it should be
+type LedgerDrift struct {
+	ProductID     uint    `json:"product_id"`
+	SKU           string  `json:"sku"`
+	Name          string  `json:"name"`
+	StockQuantity float64 `json:"stock_quantity"` // What the product row says
+	LedgerSum     float64 `json:"ledger_sum"`     // Sum of every change_amount
+	LatestBalance float64 `json:"latest_balance"` // Balance on the most recent ledger row
+	LedgerEntries int64   `json:"ledger_entries"` // 0 = stock exists with no history at all
+	SumDrift      float64 `json:"sum_drift"`      // stock_quantity - ledger_sum
+	BalanceDrift  float64 `json:"balance_drift"`  // stock_quantity - latest_balance
+
+	LocationTotal float64               `json:"location_total"`      // Sum of the per-location balances
+	LocationDrift float64               `json:"location_drift"`      // stock_quantity - location_total
+	Locations     []LocationLedgerDrift `json:"locations,omitempty"` // Locations whose balance doesn't match their ledger rows
+}
+
+// LocationLedgerDrift compares one location's balance with the ledger rows posted there
+type LocationLedgerDrift struct {
+	LocationID uint    `json:"location_id"`
+	Quantity   float64 `json:"quantity"`   // What the location_stocks row says
+	LedgerSum  float64 `json:"ledger_sum"` // Sum of change_amount at this location
+	Drift      float64 `json:"drift"`      // quantity - ledger_sum
+}
+
+// findLedgerDrift returns every product whose stock doesn't match its ledger
+func findLedgerDrift(db *gorm.DB) ([]LedgerDrift, error) {
+	// 1. Sum and count per product
+	var sums []struct {
+		ProductID uint
+		Total     float64
+		Entries   int64
+	}
+	if err := db.Model(&models.StockLedger{}).
+		Select("product_id, SUM(change_amount) as total, COUNT(*) as entries").
+		Group("product_id").
+		Scan(&sums).Error; err != nil {
+		return nil, err
+	}
+
+	// 2. The same per location, next to the balances
+	var locationSums []struct {
+		ProductID  uint
+		LocationID uint
+		Total      float64
+	}
+	if err := db.Model(&models.StockLedger{}).
+		Select("product_id, location_id, SUM(change_amount) as total").
+		Group("product_id, location_id").
+		Scan(&locationSums).Error; err != nil {
+		return nil, err
+	}
+	var balances []models.LocationStock
+	if err := db.Order("location_id asc").Find(&balances).Error; err != nil {
+		return nil, err
+	}
+
+	// 3. The most recent row per product carries the running balance
+	var latest []models.StockLedger
+	if err := db.Where("id IN (?)", db.Model(&models.StockLedger{}).Select("MAX(id)").Group("product_id")).
+		Find(&latest).Error; err != nil {
+		return nil, err
+	}
+
+	sumByID := make(map[uint]float64)
+	countByID := make(map[uint]int64)
+	for _, row := range sums {
+		sumByID[row.ProductID] = row.Total
+		countByID[row.ProductID] = row.Entries
+	}
+	balanceByID := make(map[uint]float64)
+	for _, row := range latest {
+		balanceByID[row.ProductID] = row.Balance
+	}
+	type productLocation struct{ productID, locationID uint }
+	locationSumByKey := make(map[productLocation]float64)
+	ledgerLocationsByID := make(map[uint][]uint)
+	for _, row := range locationSums {
+		locationSumByKey[productLocation{row.ProductID, row.LocationID}] = row.Total
+		ledgerLocationsByID[row.ProductID] = append(ledgerLocationsByID[row.ProductID], row.LocationID)
+	}
+	balancesByID := make(map[uint][]models.LocationStock)
+	for _, b := range balances {
+		balancesByID[b.ProductID] = append(balancesByID[b.ProductID], b)
+	}
+
+	// 4. Compare against every product, archived ones included
+	var products []models.Product
+	if err := db.Order("id asc").Find(&products).Error; err != nil {
+		return nil, err
+	}
+
+	drifts := []LedgerDrift{}
+	for _, p := range products {
+		d := LedgerDrift{
+			ProductID:     p.ID,
+			SKU:           p.SKU,
+			Name:          p.Name,
+			StockQuantity: p.StockQuantity,
+			LedgerSum:     sumByID[p.ID],
+			LatestBalance: balanceByID[p.ID],
+			LedgerEntries: countByID[p.ID],
+		}
+		d.SumDrift = p.StockQuantity - d.LedgerSum
+		d.BalanceDrift = p.StockQuantity - d.LatestBalance
+
+		// Every location's balance against its own ledger rows (rows left at a location without a balance row count too)
+		checked := make(map[uint]bool)
+		for _, b := range balancesByID[p.ID] {
+			checked[b.LocationID] = true
+			d.LocationTotal += b.Quantity
+			ledgerSum := locationSumByKey[productLocation{p.ID, b.LocationID}]
+			if math.Abs(b.Quantity-ledgerSum) > services.DriftTolerance {
+				d.Locations = append(d.Locations, LocationLedgerDrift{LocationID: b.LocationID, Quantity: b.Quantity, LedgerSum: ledgerSum, Drift: b.Quantity - ledgerSum})
+			}
+		}
+		for _, locationID := range ledgerLocationsByID[p.ID] {
+			ledgerSum := locationSumByKey[productLocation{p.ID, locationID}]
+			if !checked[locationID] && math.Abs(ledgerSum) > services.DriftTolerance {
+				d.Locations = append(d.Locations, LocationLedgerDrift{LocationID: locationID, LedgerSum: ledgerSum, Drift: -ledgerSum})
+			}
+		}
+		d.LocationDrift = p.StockQuantity - d.LocationTotal
+
+		if math.Abs(d.SumDrift) > services.DriftTolerance || math.Abs(d.BalanceDrift) > services.DriftTolerance ||
+			math.Abs(d.LocationDrift) > services.DriftTolerance || len(d.Locations) > 0 {
+			drifts = append(drifts, d)
+		}
+	}
+
+	return drifts, nil
+}
+
+// --- GET: /api/stock/reconciliation ---
+// GetLedgerReconciliation lists every product whose stock has drifted away from its ledger
+func GetLedgerReconciliation(c *gin.Context) {
+	drifts, err := findLedgerDrift(database.DB)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reconcile stock ledger"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"checked_at":     time.Now(),
+		"drifting_count": len(drifts),
+		"products":       drifts,
+	})
+}
+
+// ReconciliationRequest optionally limits the correction to specific products
+type ReconciliationRequest struct {
+	ProductIDs []uint `json:"product_ids"` // Empty = correct every drifting product
+}
+
+// --- POST: /api/stock/reconciliation/apply ---
+// ApplyLedgerReconciliation trusts the live stock figure and posts "Reconciliation" ledger entries at the
+// locations that drifted, so the ledger sums and balances line up again (in total and per location).
+func ApplyLedgerReconciliation(c *gin.Context) {
+	var req ReconciliationRequest
+	// An empty body is fine (means "fix everything")
+	_ = c.ShouldBindJSON(&req)
+
+	selected := make(map[uint]bool)
+	for _, id := range req.ProductIDs {
+		selected[id] = true
+	}
+
+	userID := c.MustGet("userID").(uint)
+	var corrected []LedgerDrift
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// Re-check inside the transaction so we never post a correction from stale numbers
+		drifts, err := findLedgerDrift(tx)
+		if err != nil {
+			return err
+		}
+
+		for _, d := range drifts {
+			if len(selected) > 0 && !selected[d.ProductID] {
+				continue
+			}
+
+			// Corrections are posted per location; a zero-change row still fixes a wrong running balance
+			if _, err := services.ReconcileLedger(tx, d.ProductID, userID); err != nil {
+				return err
+			}
+			corrected = append(corrected, d)
+		}
+
+		if len(corrected) == 0 {
+			return nil
+		}
+		return tx.Create(&models.AuditLog{
+			UserID:    userID,
+			Action:    "LEDGER_RECONCILIATION",
+			Details:   fmt.Sprintf("Posted reconciliation entries for %d products", len(corrected)),
+			Timestamp: time.Now(),
+		}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to post reconciliation entries"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   fmt.Sprintf("Reconciled %d products", len(corrected)),
+		"corrected": corrected,
+	})
+}
+
+// RunLedgerDriftCheck is the daily background job (started from main.go). It only reports:
+// corrections are left to a manager so unexplained drift gets looked at first.
+func RunLedgerDriftCheck() {
+	drifts, err := findLedgerDrift(database.DB)
+	if err != nil {
+		log.Println("❌ LEDGER: Drift check failed:", err)
+		return
+	}
+
+	if len(drifts) == 0 {
+		log.Println("✅ LEDGER: Stock matches the ledger for every product")
+		return
+	}
+
+	for _, d := range drifts {
+		log.Printf("⚠️ LEDGER: %s (#%d) stock %.3f, ledger sum %.3f, latest balance %.3f, location balances %.3f (%d drifting)",
+			d.Name, d.ProductID, d.StockQuantity, d.LedgerSum, d.LatestBalance, d.LocationTotal, len(d.Locations))
+	}
+
+	database.DB.Create(&models.AuditLog{
+		UserID:    0, // System
+		Action:    "LEDGER_DRIFT_DETECTED",
+		Details:   fmt.Sprintf("Daily check found %d products whose stock does not match the ledger", len(drifts)),
+		Timestamp: time.Now(),
+	})
+}
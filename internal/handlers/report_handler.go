@@ -1,39 +1,73 @@
 package handlers
 
 import (
+	"fmt"
+	"math"
 	"net/http"
+	"sort"
 	"strconv"
 	"time"
 
 	"go-pos-agent/internal/database"
 	"go-pos-agent/internal/models"
+	"go-pos-agent/internal/services"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // ReportData defines the shape of our analytics response
 type ReportData struct {
-	TotalRevenue float64 `json:"total_revenue"`
-	TotalProfit  float64 `json:"total_profit"` // Fixes the NaN issue
-	TotalOrders  int64   `json:"total_orders"`
-	TopSelling   []struct {
-		ProductName string  `json:"product_name"`
-		Sold        float64 `json:"sold"`
-		Revenue     float64 `json:"revenue"`
-		Profit      float64 `json:"profit"`
-	} `json:"top_selling"`
+	TotalRevenue   float64                    `json:"total_revenue"`
+	TotalProfit    float64                    `json:"total_profit"` // Fixes the NaN issue
+	TotalOrders    int64                      `json:"total_orders"`
+	TopSelling     []TopSellerLine            `json:"top_selling"`
 	RecentSales    []models.Sale              `json:"recent_sales"`
 	VoidedSales    []models.VoidedTransaction `json:"voided_sales"`    // NEW: Task 2.4 Security Audits
 	DrawerActivity []models.DrawerActivityLog `json:"drawer_activity"` // <-- ADD THIS LINE
+	PreviousPeriod *PeriodComparison          `json:"previous_period"` // nil for "all time"
+	LastYear       *PeriodComparison          `json:"last_year"`       // nil for "all time"
+}
+
+// TopSellerLine is one product in the top-selling list
+type TopSellerLine struct {
+	ProductName string  `json:"product_name"`
+	Sold        float64 `json:"sold"`
+	Revenue     float64 `json:"revenue"`
+	Profit      float64 `json:"profit"`
+}
+
+// MetricChange is one figure of the report next to the same figure for a comparison period
+type MetricChange struct {
+	Current   float64  `json:"current"`
+	Previous  float64  `json:"previous"`
+	Change    float64  `json:"change"`
+	ChangePct *float64 `json:"change_pct"` // nil when the previous figure was zero
+}
+
+// TopSellerChange compares one of the current period's top sellers with the comparison period
+type TopSellerChange struct {
+	ProductName string       `json:"product_name"`
+	Sold        MetricChange `json:"sold"`
+	Revenue     MetricChange `json:"revenue"`
+	Profit      MetricChange `json:"profit"`
+}
+
+// PeriodComparison is the report's period set against an earlier one of the same length, with the same filters
+type PeriodComparison struct {
+	Start      time.Time         `json:"start"`
+	End        time.Time         `json:"end"`
+	Revenue    MetricChange      `json:"revenue"`
+	Profit     MetricChange      `json:"profit"`
+	Orders     MetricChange      `json:"orders"`
+	TopSelling []TopSellerChange `json:"top_selling"` // The current top sellers, in the same order
 }
 
 // --- GET: /api/reports ---
 func GetSalesReport(c *gin.Context) {
 	var data ReportData
 
-	// --- 1. DYNAMIC TIME & SEARCH FILTER LOGIC ---
-	timeframe := c.Query("timeframe")
-
+	// --- 1. PAGINATION & FILTERS ---
 	salesLimitStr := c.Query("salesLimit")
 	salesLimit := 10
 	if salesLimitStr != "" {
@@ -59,198 +93,42 @@ func GetSalesReport(c *gin.Context) {
 	}
 	// --------------------------------------------------
 
-	customStart := c.Query("customStart")
-	customEnd := c.Query("customEnd")
-	searchQuery := c.Query("search")
-	categoryFilter := c.Query("category")
-
-	// --- NEW: Phase B & Payment Filters ---
-	productType := c.Query("productType")
-	paymentMethod := c.Query("paymentMethod") // e.g., "cash", "qr", "card", "laterpay"
-
-	now := time.Now()
-	var startTime time.Time
-	var endTime time.Time
-
-	if timeframe == "custom" && customStart != "" && customEnd != "" {
-		parsedStart, errStart := time.ParseInLocation("2006-01-02T15:04", customStart, now.Location())
-		if errStart == nil {
-			startTime = parsedStart
-		}
-		parsedEnd, errEnd := time.ParseInLocation("2006-01-02T15:04", customEnd, now.Location())
-		if errEnd == nil {
-			endTime = parsedEnd
-		}
-	} else {
-		switch timeframe {
-		case "today":
-			startTime = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
-		case "7days":
-			startTime = now.AddDate(0, 0, -7)
-		case "30days":
-			startTime = now.AddDate(0, 0, -30)
-		default:
-			startTime = time.Time{}
-		}
-	}
-
-	// Helper boolean for product traits
-	needsProductJoin := searchQuery != "" || (categoryFilter != "" && categoryFilter != "All") || (productType != "" && productType != "All")
-
-	// --- 2. REVENUE & PROFIT (Filtered) ---
-	salesQuery := database.DB.Table("sale_items").
-		Joins("JOIN sales ON sale_items.sale_id = sales.id").
-		Where("sales.status = ?", "completed")
-
-	// Apply Payment Method Filter
-	if paymentMethod != "" && paymentMethod != "All" {
-		salesQuery = salesQuery.Where("sales.payment_method = ?", paymentMethod)
-	}
-
-	if needsProductJoin {
-		salesQuery = salesQuery.Joins("JOIN products ON sale_items.product_id = products.id")
-		if searchQuery != "" {
-			salesQuery = salesQuery.Where("products.name LIKE ? OR products.sku LIKE ?", "%"+searchQuery+"%", "%"+searchQuery+"%")
-		}
-		if categoryFilter != "" && categoryFilter != "All" {
-			salesQuery = salesQuery.Where("products.category = ?", categoryFilter)
-		}
-		if productType == "Standard" {
-			salesQuery = salesQuery.Where("products.is_weighable = ? AND products.is_gas = ?", false, false)
-		} else if productType == "Weighable" {
-			salesQuery = salesQuery.Where("products.is_weighable = ?", true)
-		} else if productType == "Gas" {
-			salesQuery = salesQuery.Where("products.is_gas = ?", true)
-		}
-	}
-
-	if !startTime.IsZero() {
-		salesQuery = salesQuery.Where("sales.sale_time >= ?", startTime)
-	}
-	if !endTime.IsZero() {
-		salesQuery = salesQuery.Where("sales.sale_time <= ?", endTime)
-	}
-
-	row := salesQuery.
-		Select("COALESCE(SUM(sale_items.quantity * sale_items.price_at_sale), 0), COALESCE(SUM(sale_items.quantity * (sale_items.price_at_sale - sale_items.buy_price_rm)), 0)").
-		Row()
+	filters := parseSalesReportFilters(c)
 
-	if err := row.Scan(&data.TotalRevenue, &data.TotalProfit); err != nil {
+	// --- 2. REVENUE, PROFIT & ORDERS (Filtered; whole past days come from the daily summaries) ---
+	totals, err := filters.totals()
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate revenue and profit"})
 		return
 	}
+	data.TotalRevenue = totals.Revenue
+	data.TotalProfit = totals.Revenue - totals.Cost
+	data.TotalOrders = totals.Orders
 
-	// --- 3. TOTAL ORDERS (Filtered via Subquery) ---
-	ordersQuery := database.DB.Model(&models.Sale{}).Where("status = ?", "completed")
-
-	// Apply Payment Method Filter
-	if paymentMethod != "" && paymentMethod != "All" {
-		ordersQuery = ordersQuery.Where("payment_method = ?", paymentMethod)
-	}
-
-	if needsProductJoin {
-		subQuery := database.DB.Table("sale_items").Select("sale_items.sale_id").Joins("JOIN products ON sale_items.product_id = products.id")
-		if searchQuery != "" {
-			subQuery = subQuery.Where("products.name LIKE ? OR products.sku LIKE ?", "%"+searchQuery+"%", "%"+searchQuery+"%")
-		}
-		if categoryFilter != "" && categoryFilter != "All" {
-			subQuery = subQuery.Where("products.category = ?", categoryFilter)
-		}
-		if productType == "Standard" {
-			subQuery = subQuery.Where("products.is_weighable = ? AND products.is_gas = ?", false, false)
-		} else if productType == "Weighable" {
-			subQuery = subQuery.Where("products.is_weighable = ?", true)
-		} else if productType == "Gas" {
-			subQuery = subQuery.Where("products.is_gas = ?", true)
-		}
-		ordersQuery = ordersQuery.Where("id IN (?)", subQuery)
-	}
-
-	if !startTime.IsZero() {
-		ordersQuery = ordersQuery.Where("sale_time >= ?", startTime)
-	}
-	if !endTime.IsZero() {
-		ordersQuery = ordersQuery.Where("sale_time <= ?", endTime)
-	}
-
-	if err := ordersQuery.Count(&data.TotalOrders).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count orders"})
-		return
-	}
-
-	// --- 4. TOP SELLING ITEMS (Filtered) ---
-	topSellingQuery := database.DB.Table("sale_items").
-		Select("products.name as product_name, SUM(sale_items.quantity) as sold, SUM(sale_items.quantity * sale_items.price_at_sale) as revenue, SUM(sale_items.quantity * (sale_items.price_at_sale - sale_items.buy_price_rm)) as profit").
-		Joins("JOIN products ON sale_items.product_id = products.id").
-		Joins("JOIN sales ON sale_items.sale_id = sales.id").
-		Where("sales.status = ?", "completed")
-
-	// Apply Payment Method Filter
-	if paymentMethod != "" && paymentMethod != "All" {
-		topSellingQuery = topSellingQuery.Where("sales.payment_method = ?", paymentMethod)
-	}
-
-	if searchQuery != "" {
-		topSellingQuery = topSellingQuery.Where("products.name LIKE ? OR products.sku LIKE ?", "%"+searchQuery+"%", "%"+searchQuery+"%")
-	}
-	if categoryFilter != "" && categoryFilter != "All" {
-		topSellingQuery = topSellingQuery.Where("products.category = ?", categoryFilter)
-	}
-	if productType == "Standard" {
-		topSellingQuery = topSellingQuery.Where("products.is_weighable = ? AND products.is_gas = ?", false, false)
-	} else if productType == "Weighable" {
-		topSellingQuery = topSellingQuery.Where("products.is_weighable = ?", true)
-	} else if productType == "Gas" {
-		topSellingQuery = topSellingQuery.Where("products.is_gas = ?", true)
-	}
-
-	if !startTime.IsZero() {
-		topSellingQuery = topSellingQuery.Where("sales.sale_time >= ?", startTime)
-	}
-	if !endTime.IsZero() {
-		topSellingQuery = topSellingQuery.Where("sales.sale_time <= ?", endTime)
-	}
-
-	err := topSellingQuery.Group("products.name").Order("sold desc").Limit(5).Scan(&data.TopSelling).Error
+	// --- 3. TOP SELLING ITEMS (Filtered) ---
+	data.TopSelling, err = filters.topSellers(5)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch top selling items"})
 		return
 	}
 
-	// --- 5. RECENT SALES & VOIDED (Filtered via Subquery) ---
-	recentSalesQuery := database.DB.Preload("Items").Preload("Items.Product").Order("sale_time desc").Limit(salesLimit)
-
-	// Apply Payment Method Filter
-	if paymentMethod != "" && paymentMethod != "All" {
-		recentSalesQuery = recentSalesQuery.Where("payment_method = ?", paymentMethod)
-	}
-
-	if needsProductJoin {
-		subQuery := database.DB.Table("sale_items").Select("sale_items.sale_id").Joins("JOIN products ON sale_items.product_id = products.id")
-		if searchQuery != "" {
-			subQuery = subQuery.Where("products.name LIKE ? OR products.sku LIKE ?", "%"+searchQuery+"%", "%"+searchQuery+"%")
+	// --- 4. COMPARISON: the period just before and the same period last year ---
+	if !filters.Start.IsZero() {
+		previous, lastYear := comparisonPeriods(filters, time.Now())
+		if data.PreviousPeriod, err = comparePeriods(totals, data.TopSelling, previous); err == nil {
+			data.LastYear, err = comparePeriods(totals, data.TopSelling, lastYear)
 		}
-		if categoryFilter != "" && categoryFilter != "All" {
-			subQuery = subQuery.Where("products.category = ?", categoryFilter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate period comparison"})
+			return
 		}
-		if productType == "Standard" {
-			subQuery = subQuery.Where("products.is_weighable = ? AND products.is_gas = ?", false, false)
-		} else if productType == "Weighable" {
-			subQuery = subQuery.Where("products.is_weighable = ?", true)
-		} else if productType == "Gas" {
-			subQuery = subQuery.Where("products.is_gas = ?", true)
-		}
-		recentSalesQuery = recentSalesQuery.Where("id IN (?)", subQuery)
 	}
 
-	if !startTime.IsZero() {
-		recentSalesQuery = recentSalesQuery.Where("sale_time >= ?", startTime)
-	}
-	if !endTime.IsZero() {
-		recentSalesQuery = recentSalesQuery.Where("sale_time <= ?", endTime)
-	}
-	recentSalesQuery.Find(&data.RecentSales)
+	// --- 5. RECENT SALES & VOIDED (Filtered via Subquery) ---
+	filters.sales(database.DB.Preload("Items").Preload("Items.Product").Order("sale_time desc").Limit(salesLimit)).
+		Find(&data.RecentSales)
 
+	startTime, endTime := filters.Start, filters.End
 	voidedQuery := database.DB.Order("timestamp desc").Limit(voidsLimit)
 	if !startTime.IsZero() {
 		voidedQuery = voidedQuery.Where("timestamp >= ?", startTime)
@@ -274,11 +152,81 @@ func GetSalesReport(c *gin.Context) {
 	c.JSON(http.StatusOK, data)
 }
 
+// comparisonPeriods shifts the filters back to the equivalent previous period and to the same period last year.
+// Periods starting at midnight step back in whole days, so "today so far" compares with yesterday up to the same time.
+func comparisonPeriods(f salesReportFilters, now time.Time) (salesReportFilters, salesReportFilters) {
+	end := f.End
+	if end.IsZero() {
+		end = now
+	}
+
+	previous := f
+	start := f.Start.Local()
+	if start.Equal(time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.Local)) {
+		days := int(math.Ceil(end.Sub(start).Hours() / 24))
+		if days < 1 {
+			days = 1
+		}
+		previous.Start, previous.End = start.AddDate(0, 0, -days), end.AddDate(0, 0, -days)
+	} else {
+		length := end.Sub(f.Start)
+		previous.Start, previous.End = f.Start.Add(-length), end.Add(-length)
+	}
+	if !previous.End.Before(f.Start) {
+		previous.End = f.Start.Add(-time.Nanosecond)
+	}
+
+	lastYear := f
+	lastYear.Start, lastYear.End = f.Start.AddDate(-1, 0, 0), end.AddDate(-1, 0, 0)
+	return previous, lastYear
+}
+
+// comparePeriods totals the comparison filters and sets them against the current figures and top sellers
+func comparePeriods(current salesTotals, topSelling []TopSellerLine, earlier salesReportFilters) (*PeriodComparison, error) {
+	totals, err := earlier.totals()
+	if err != nil {
+		return nil, err
+	}
+	sellers, err := earlier.topSellers(0)
+	if err != nil {
+		return nil, err
+	}
+	earlierByName := make(map[string]TopSellerLine, len(sellers))
+	for _, line := range sellers {
+		earlierByName[line.ProductName] = line
+	}
+
+	comparison := &PeriodComparison{
+		Start:      earlier.Start,
+		End:        earlier.End,
+		Revenue:    metricChange(current.Revenue, totals.Revenue),
+		Profit:     metricChange(current.Revenue-current.Cost, totals.Revenue-totals.Cost),
+		Orders:     metricChange(float64(current.Orders), float64(totals.Orders)),
+		TopSelling: make([]TopSellerChange, 0, len(topSelling)),
+	}
+	for _, line := range topSelling {
+		before := earlierByName[line.ProductName]
+		comparison.TopSelling = append(comparison.TopSelling, TopSellerChange{
+			ProductName: line.ProductName,
+			Sold:        metricChange(line.Sold, before.Sold),
+			Revenue:     metricChange(line.Revenue, before.Revenue),
+			Profit:      metricChange(line.Profit, before.Profit),
+		})
+	}
+	return comparison, nil
+}
+
+// metricChange fills in the difference between a figure and its comparison figure
+func metricChange(current, previous float64) MetricChange {
+	return MetricChange{Current: current, Previous: previous, Change: current - previous, ChangePct: percentChange(current, previous)}
+}
+
 // --- DATA STRUCTURES FOR VALUATION REPORT ---
 
 // ValuationItem represents a single row in the PDF table
 type ValuationItem struct {
 	Name          string  `json:"name"`
+	Category      string  `json:"category"` // The product's own (possibly sub-) category
 	Quantity      float64 `json:"quantity"` // UPGRADED: Changed from int to float64
 	CostPrice     float64 `json:"cost_price"`
 	TotalCost     float64 `json:"total_cost"`
@@ -300,31 +248,72 @@ type ValuationResponse struct {
 	Categories       []CategoryGroup `json:"categories"`
 	GrandTotal       float64         `json:"grand_total"`
 	GrandTotalProfit float64         `json:"grand_total_profit"` // NEW: For Profitability View
+	InTransitTotal   float64         `json:"in_transit_total"`   // Cost of stock dispatched on a transfer but not yet received (in the all-locations totals above)
 }
 
 // --- GET: /api/reports/valuation ---
-// GetStockValuation calculates the total monetary value of all physical inventory
+// GetStockValuation calculates the total monetary value of all physical inventory.
+// ?location_id= values a single location (shop floor, back store, branch) instead of the whole business.
+// ?format=pdf downloads the same figures as a printable PDF.
 func GetStockValuation(c *gin.Context) {
+	locationID := c.Query("location_id")
+	response, err := buildStockValuation(locationID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if c.Query("format") == "pdf" {
+		writeValuationPDF(c, "Stock Valuation", valuationSubtitle(locationID), response)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// buildStockValuation values the stock on hand, for one location or (locationID "") the whole business
+func buildStockValuation(locationID string) (ValuationResponse, error) {
 	var products []models.Product
 
 	// 1. Fetch all products from the database
 	if err := database.DB.Find(&products).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch inventory"})
-		return
+		return ValuationResponse{}, fmt.Errorf("Failed to fetch inventory")
 	}
 
-	// 2. Initialize our running totals and a map to group items by Category
+	// --- NEW: Location Filter ---
+	// Quantities come from that location's balances; products it has never held are left out
+	var locationQty map[uint]float64
+	if locationID != "" {
+		var balances []models.LocationStock
+		if err := database.DB.Where("location_id = ?", locationID).Find(&balances).Error; err != nil {
+			return ValuationResponse{}, fmt.Errorf("Failed to fetch location stock")
+		}
+		locationQty = make(map[uint]float64, len(balances))
+		for _, b := range balances {
+			locationQty[b.ProductID] = b.Quantity
+		}
+	}
+	// -------------------------------
+
+	// 2. Initialize our running totals and a map to group items by top-level Category
+	categoryTree := services.LoadCategoryTree(database.DB)
 	var grandTotal float64
 	var grandTotalProfit float64 // NEW
 	groupedMap := make(map[string]*CategoryGroup)
 
 	// 3. Loop through every single product in the database
 	for _, p := range products {
-		catName := p.Category
-		if catName == "" {
-			catName = "Uncategorized"
+		if locationQty != nil {
+			qty, held := locationQty[p.ID]
+			if !held {
+				continue
+			}
+			p.StockQuantity = qty
 		}
 
+		// Sub-categories roll up into their top-level parent
+		catName := categoryTree.RootName(p.CategoryID)
+
 		if _, exists := groupedMap[catName]; !exists {
 			groupedMap[catName] = &CategoryGroup{
 				CategoryName:   catName,
@@ -340,6 +329,7 @@ func GetStockValuation(c *gin.Context) {
 
 		valItem := ValuationItem{
 			Name:          p.Name,
+			Category:      p.Category,
 			Quantity:      p.StockQuantity,
 			CostPrice:     p.CostPrice,
 			TotalCost:     itemTotal,
@@ -362,13 +352,26 @@ func GetStockValuation(c *gin.Context) {
 	for _, group := range groupedMap {
 		response.Categories = append(response.Categories, *group)
 	}
+	sort.Slice(response.Categories, func(i, j int) bool { return response.Categories[i].CategoryName < response.Categories[j].CategoryName })
 
-	// 5. Send the structured data to the frontend
-	c.JSON(http.StatusOK, response)
+	// 5. Stock on the road between locations (heading TO the filtered location, if any).
+	// It sits at the transfers' transit locations, so the all-locations figures above already include it.
+	inTransit := database.DB.Table("stock_transfer_items").
+		Select("COALESCE(SUM(stock_transfer_items.quantity * products.cost_price), 0)").
+		Joins("JOIN stock_transfers ON stock_transfer_items.transfer_id = stock_transfers.id").
+		Joins("JOIN products ON stock_transfer_items.product_id = products.id").
+		Where("stock_transfers.status = ?", "in_transit")
+	if locationID != "" {
+		inTransit = inTransit.Where("stock_transfers.to_location_id = ?", locationID)
+	}
+	inTransit.Row().Scan(&response.InTransitTotal)
+
+	return response, nil
 }
 
 // --- GET: /api/reports/valuation/history ---
-// GetHistoricalValuation calculates the value of NEW stock received on a specific date, with optional time filtering
+// GetHistoricalValuation calculates the value of NEW stock received on a specific date, with optional time filtering.
+// ?format=pdf downloads it as a printable PDF.
 func GetHistoricalValuation(c *gin.Context) {
 	dateStr := c.Query("date")
 	if dateStr == "" {
@@ -408,39 +411,65 @@ func GetHistoricalValuation(c *gin.Context) {
 	}
 	// ----------------------------------------------
 
+	response, err := buildHistoricalValuation(startOfDay, endOfDay)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if c.Query("format") == "pdf" {
+		subtitle := fmt.Sprintf("Stock received %s to %s", startOfDay.Format("02/01/2006 15:04"), endOfDay.Format("15:04"))
+		writeValuationPDF(c, "Historical Valuation", subtitle, response)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// stockReceivedReasons are the ledger reasons that bring new stock into the business. Transfers, merges,
+// cancellations and counts also add stock somewhere, but only move or correct what was already there.
+var stockReceivedReasons = []string{"Initial Setup", "Import", "Manual Audit / Restock"}
+
+// buildHistoricalValuation values the stock that came IN (received, see stockReceivedReasons) between start and end
+func buildHistoricalValuation(startOfDay, endOfDay time.Time) (ValuationResponse, error) {
 	var products []models.Product
 	if err := database.DB.Find(&products).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch inventory"})
-		return
+		return ValuationResponse{}, fmt.Errorf("Failed to fetch inventory")
 	}
 
+	// 4. All stock received within our specific time window, totalled per product in one query
+	var additions []struct {
+		ProductID uint
+		Added     float64
+	}
+	err := database.DB.Model(&models.StockLedger{}).
+		Select("product_id, SUM(change_amount) as added").
+		Where("created_at >= ? AND created_at <= ? AND change_amount > 0 AND reason IN ?", startOfDay, endOfDay, stockReceivedReasons).
+		Group("product_id").
+		Scan(&additions).Error
+	if err != nil {
+		return ValuationResponse{}, fmt.Errorf("Failed to read stock ledger")
+	}
+	addedByProduct := make(map[uint]float64, len(additions))
+	for _, a := range additions {
+		addedByProduct[a.ProductID] = a.Added
+	}
+
+	categoryTree := services.LoadCategoryTree(database.DB)
 	var grandTotal float64
 	var grandTotalProfit float64 // ADD THIS LINE HERE
 	groupedMap := make(map[string]*CategoryGroup)
 
 	for _, p := range products {
-		var dailyLedgers []models.StockLedger
-
-		// 4. Find all ledger entries for this product within our specific time window where stock went UP (+)
-		database.DB.Where(
-			"product_id = ? AND created_at >= ? AND created_at <= ? AND change_amount > 0",
-			p.ID, startOfDay, endOfDay,
-		).Find(&dailyLedgers)
-
-		var totalAddedToday float64 // UPGRADED: Now a decimal
-		for _, ledger := range dailyLedgers {
-			totalAddedToday += ledger.ChangeAmount
-		}
+		totalAddedToday := addedByProduct[p.ID] // UPGRADED: Now a decimal
 
 		if totalAddedToday <= 0 {
 			continue
 		}
 
 		// --- Grouping and Math ---
-		catName := p.Category
-		if catName == "" {
-			catName = "Uncategorized"
-		}
+		// Sub-categories roll up into their top-level parent
+		catName := categoryTree.RootName(p.CategoryID)
 
 		if _, exists := groupedMap[catName]; !exists {
 			groupedMap[catName] = &CategoryGroup{
@@ -457,6 +486,7 @@ func GetHistoricalValuation(c *gin.Context) {
 
 		valItem := ValuationItem{
 			Name:          p.Name,
+			Category:      p.Category,
 			Quantity:      totalAddedToday,
 			CostPrice:     p.CostPrice,
 			TotalCost:     itemTotal,
@@ -478,6 +508,421 @@ func GetHistoricalValuation(c *gin.Context) {
 	for _, group := range groupedMap {
 		response.Categories = append(response.Categories, *group)
 	}
+	sort.Slice(response.Categories, func(i, j int) bool { return response.Categories[i].CategoryName < response.Categories[j].CategoryName })
 
-	c.JSON(http.StatusOK, response)
+	return response, nil
+}
+
+// salesReportFilters is the dashboard's standard filter set, shared by every sales report:
+// ?timeframe= (with ?customStart= / ?customEnd=), ?search=, ?category= (includes sub-categories),
+// ?productType=Standard|Weighable|Gas and ?paymentMethod=.
+type salesReportFilters struct {
+	Start         time.Time // Zero means no lower bound
+	End           time.Time // Zero means no upper bound
+	Search        string
+	Category      string
+	ProductType   string
+	PaymentMethod string
+	categoryIDs   []uint
+}
+
+// parseSalesReportFilters reads the standard filters from the query string
+func parseSalesReportFilters(c *gin.Context) salesReportFilters {
+	f := salesReportFilters{
+		Search:        c.Query("search"),
+		Category:      c.Query("category"),
+		ProductType:   c.Query("productType"),
+		PaymentMethod: c.Query("paymentMethod"), // e.g., "cash", "qr", "card", "laterpay"
+	}
+	f.Start, f.End = resolveTimeframe(c)
+
+	// Category filter includes every sub-category ("Drinks" also matches "Soft Drinks")
+	if f.Category != "" && f.Category != "All" {
+		f.categoryIDs = []uint{0} // Unknown names match nothing instead of everything
+		if category, err := services.ResolveCategory(database.DB, f.Category); err == nil {
+			f.categoryIDs = services.LoadCategoryTree(database.DB).DescendantIDs(category.ID)
+		}
+	}
+	return f
+}
+
+// filtersProducts reports whether any filter is about the product rather than the sale
+func (f salesReportFilters) filtersProducts() bool {
+	return f.Search != "" || (f.Category != "" && f.Category != "All") || (f.ProductType != "" && f.ProductType != "All")
+}
+
+// applyProductFilters narrows a query that already joins the products table
+func (f salesReportFilters) applyProductFilters(query *gorm.DB) *gorm.DB {
+	if f.Search != "" {
+		query = query.Where("products.name LIKE ? OR products.sku LIKE ?", "%"+f.Search+"%", "%"+f.Search+"%")
+	}
+	if f.Category != "" && f.Category != "All" {
+		query = query.Where("products.category_id IN ?", f.categoryIDs)
+	}
+	if f.ProductType == "Standard" {
+		query = query.Where("products.is_weighable = ? AND products.is_gas = ?", false, false)
+	} else if f.ProductType == "Weighable" {
+		query = query.Where("products.is_weighable = ?", true)
+	} else if f.ProductType == "Gas" {
+		query = query.Where("products.is_gas = ?", true)
+	}
+	return query
+}
+
+// lineItems returns the completed sale lines matching every filter (sale_items joined to sales and products)
+func (f salesReportFilters) lineItems(db *gorm.DB) *gorm.DB {
+	query := db.Table("sale_items").
+		Joins("JOIN sales ON sale_items.sale_id = sales.id").
+		Joins("JOIN products ON sale_items.product_id = products.id").
+		Where("sales.status = ?", "completed")
+
+	if f.PaymentMethod != "" && f.PaymentMethod != "All" {
+		query = query.Where("sales.payment_method = ?", f.PaymentMethod)
+	}
+	if !f.Start.IsZero() {
+		query = query.Where("sales.sale_time >= ?", f.Start)
+	}
+	if !f.End.IsZero() {
+		query = query.Where("sales.sale_time <= ?", f.End)
+	}
+	return f.applyProductFilters(query)
+}
+
+// sales narrows a query on the sales table to the filtered period and tender, keeping only
+// sales that contain at least one matching product. The caller decides which statuses count.
+func (f salesReportFilters) sales(query *gorm.DB) *gorm.DB {
+	query = query.Model(&models.Sale{})
+	if f.PaymentMethod != "" && f.PaymentMethod != "All" {
+		query = query.Where("payment_method = ?", f.PaymentMethod)
+	}
+	if f.filtersProducts() {
+		subQuery := database.DB.Table("sale_items").Select("sale_items.sale_id").Joins("JOIN products ON sale_items.product_id = products.id")
+		query = query.Where("id IN (?)", f.applyProductFilters(subQuery))
+	}
+	if !f.Start.IsZero() {
+		query = query.Where("sale_time >= ?", f.Start)
+	}
+	if !f.End.IsZero() {
+		query = query.Where("sale_time <= ?", f.End)
+	}
+	return query
+}
+
+// salesRangePlan splits a report period into whole past days, which are read from the daily summaries,
+// and the pieces still read from the raw sales tables: today, and part-days at either end.
+type salesRangePlan struct {
+	UseSummary bool
+	FromDay    string               // First summary day (inclusive), "" = from the beginning
+	ToDay      string               // Last summary day (inclusive)
+	Live       []salesReportFilters // The same filters narrowed to each raw piece
+}
+
+// plan works out which part of the filtered period can come from the summaries
+func (f salesReportFilters) plan() salesRangePlan {
+	if !services.SummariesReady() {
+		return salesRangePlan{Live: []salesReportFilters{f}}
+	}
+
+	now := time.Now()
+	midnight := func(t time.Time) time.Time {
+		t = t.Local()
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+	}
+
+	// 1. First whole day: the start's own day only if the period starts exactly at midnight
+	var firstDay time.Time
+	if !f.Start.IsZero() {
+		firstDay = midnight(f.Start)
+		if firstDay.Before(f.Start) {
+			firstDay = firstDay.AddDate(0, 0, 1)
+		}
+	}
+
+	// 2. Whole days stop at today, or earlier at the (partial) day the period ends in
+	summaryEnd := midnight(now)
+	if !f.End.IsZero() && f.End.Before(summaryEnd) {
+		summaryEnd = midnight(f.End)
+	}
+	if !firstDay.IsZero() && !firstDay.Before(summaryEnd) {
+		return salesRangePlan{Live: []salesReportFilters{f}}
+	}
+
+	plan := salesRangePlan{UseSummary: true, ToDay: services.SummaryDay(summaryEnd.AddDate(0, 0, -1))}
+	if !firstDay.IsZero() {
+		plan.FromDay = services.SummaryDay(firstDay)
+	}
+
+	// 3. The raw pieces either side
+	if !f.Start.IsZero() && f.Start.Before(firstDay) {
+		before := f
+		before.End = firstDay.Add(-time.Nanosecond)
+		plan.Live = append(plan.Live, before)
+	}
+	if f.End.IsZero() || !f.End.Before(summaryEnd) {
+		after := f
+		after.Start = summaryEnd
+		plan.Live = append(plan.Live, after)
+	}
+	return plan
+}
+
+// summaryProducts returns the daily_product_sales rows of the planned days that match the filters (products joined)
+func (f salesReportFilters) summaryProducts(db *gorm.DB, plan salesRangePlan) *gorm.DB {
+	query := db.Table("daily_product_sales").
+		Joins("JOIN products ON daily_product_sales.product_id = products.id").
+		Where("daily_product_sales.day <= ?", plan.ToDay)
+	if plan.FromDay != "" {
+		query = query.Where("daily_product_sales.day >= ?", plan.FromDay)
+	}
+	if f.PaymentMethod != "" && f.PaymentMethod != "All" {
+		query = query.Where("daily_product_sales.payment_method = ?", f.PaymentMethod)
+	}
+	return f.applyProductFilters(query)
+}
+
+// summaryTenders returns the daily_tender_sales rows of the planned days (only valid without product filters)
+func (f salesReportFilters) summaryTenders(db *gorm.DB, plan salesRangePlan) *gorm.DB {
+	query := db.Model(&models.DailyTenderSales{}).Where("day <= ?", plan.ToDay)
+	if plan.FromDay != "" {
+		query = query.Where("day >= ?", plan.FromDay)
+	}
+	if f.PaymentMethod != "" && f.PaymentMethod != "All" {
+		query = query.Where("payment_method = ?", f.PaymentMethod)
+	}
+	return query
+}
+
+// salesTotals are the headline figures of a filtered period
+type salesTotals struct {
+	Revenue   float64 // Line totals at shelf price
+	Cost      float64
+	Orders    int64
+	Discounts float64
+	Rounding  float64
+}
+
+// totals adds up the period, reading whole past days from the summaries. Orders, discounts and rounding
+// belong to whole receipts, so with product filters they always come from the raw tables.
+func (f salesReportFilters) totals() (salesTotals, error) {
+	var t salesTotals
+	plan := f.plan()
+
+	// 1. Line totals
+	for _, live := range plan.Live {
+		var revenue, cost float64
+		err := live.lineItems(database.DB).
+			Select("COALESCE(SUM(sale_items.quantity * sale_items.price_at_sale), 0), COALESCE(SUM(sale_items.quantity * sale_items.buy_price_rm), 0)").
+			Row().Scan(&revenue, &cost)
+		if err != nil {
+			return t, err
+		}
+		t.Revenue += revenue
+		t.Cost += cost
+	}
+	if plan.UseSummary {
+		var revenue, cost float64
+		err := f.summaryProducts(database.DB, plan).
+			Select("COALESCE(SUM(daily_product_sales.revenue), 0), COALESCE(SUM(daily_product_sales.cost), 0)").
+			Row().Scan(&revenue, &cost)
+		if err != nil {
+			return t, err
+		}
+		t.Revenue += revenue
+		t.Cost += cost
+	}
+
+	// 2. Receipt-level figures
+	receiptPieces := plan.Live
+	if !plan.UseSummary || f.filtersProducts() {
+		receiptPieces = []salesReportFilters{f}
+	} else {
+		var orders int64
+		var discounts, rounding float64
+		err := f.summaryTenders(database.DB, plan).
+			Select("COALESCE(SUM(orders), 0), COALESCE(SUM(discounts), 0), COALESCE(SUM(rounding), 0)").
+			Row().Scan(&orders, &discounts, &rounding)
+		if err != nil {
+			return t, err
+		}
+		t.Orders += orders
+		t.Discounts += discounts
+		t.Rounding += rounding
+	}
+	for _, live := range receiptPieces {
+		var orders int64
+		var discounts, rounding float64
+		err := live.sales(database.DB).Where("status = ?", "completed").
+			Select("COUNT(sales.id), "+services.SaleDiscountSQL+", "+services.SaleRoundingSQL).
+			Row().Scan(&orders, &discounts, &rounding)
+		if err != nil {
+			return t, err
+		}
+		t.Orders += orders
+		t.Discounts += discounts
+		t.Rounding += rounding
+	}
+	return t, nil
+}
+
+// topSellers ranks products by quantity sold in the period (limit <= 0 returns all of them)
+func (f salesReportFilters) topSellers(limit int) ([]TopSellerLine, error) {
+	plan := f.plan()
+	byName := make(map[string]*TopSellerLine)
+	add := func(rows []TopSellerLine) {
+		for _, r := range rows {
+			if _, exists := byName[r.ProductName]; !exists {
+				byName[r.ProductName] = &TopSellerLine{ProductName: r.ProductName}
+			}
+			byName[r.ProductName].Sold += r.Sold
+			byName[r.ProductName].Revenue += r.Revenue
+			byName[r.ProductName].Profit += r.Profit
+		}
+	}
+
+	for _, live := range plan.Live {
+		var rows []TopSellerLine
+		err := live.lineItems(database.DB).
+			Select("products.name as product_name, SUM(sale_items.quantity) as sold, SUM(sale_items.quantity * sale_items.price_at_sale) as revenue, SUM(sale_items.quantity * (sale_items.price_at_sale - sale_items.buy_price_rm)) as profit").
+			Group("products.name").Scan(&rows).Error
+		if err != nil {
+			return nil, err
+		}
+		add(rows)
+	}
+	if plan.UseSummary {
+		var rows []TopSellerLine
+		err := f.summaryProducts(database.DB, plan).
+			Select("products.name as product_name, SUM(daily_product_sales.quantity) as sold, SUM(daily_product_sales.revenue) as revenue, SUM(daily_product_sales.revenue - daily_product_sales.cost) as profit").
+			Group("products.name").Scan(&rows).Error
+		if err != nil {
+			return nil, err
+		}
+		add(rows)
+	}
+
+	lines := make([]TopSellerLine, 0, len(byName))
+	for _, line := range byName {
+		lines = append(lines, *line)
+	}
+	sort.Slice(lines, func(i, j int) bool {
+		if lines[i].Sold != lines[j].Sold {
+			return lines[i].Sold > lines[j].Sold
+		}
+		return lines[i].ProductName < lines[j].ProductName
+	})
+	if limit > 0 && len(lines) > limit {
+		lines = lines[:limit]
+	}
+	return lines, nil
+}
+
+// resolveTimeframe turns the dashboard's standard ?timeframe= / ?customStart= / ?customEnd= filters
+// into a start and end time. A zero time means "no bound" on that side.
+func resolveTimeframe(c *gin.Context) (time.Time, time.Time) {
+	timeframe := c.Query("timeframe")
+	customStart := c.Query("customStart")
+	customEnd := c.Query("customEnd")
+
+	now := time.Now()
+	var startTime, endTime time.Time
+
+	if timeframe == "custom" && customStart != "" && customEnd != "" {
+		if parsed, err := time.ParseInLocation("2006-01-02T15:04", customStart, now.Location()); err == nil {
+			startTime = parsed
+		}
+		if parsed, err := time.ParseInLocation("2006-01-02T15:04", customEnd, now.Location()); err == nil {
+			endTime = parsed
+		}
+	} else {
+		switch timeframe {
+		case "today":
+			startTime = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		case "7days":
+			startTime = now.AddDate(0, 0, -7)
+		case "30days":
+			startTime = now.AddDate(0, 0, -30)
+		}
+	}
+
+	return startTime, endTime
+}
+
+// --- DATA STRUCTURES FOR SHRINKAGE REPORT ---
+
+// ShrinkageLine is one reason (or category) bucket, valued at cost
+type ShrinkageLine struct {
+	Key       string  `json:"key"`
+	Label     string  `json:"label"`
+	Count     int     `json:"count"`
+	Quantity  float64 `json:"quantity"`
+	TotalCost float64 `json:"total_cost"`
+}
+
+// ShrinkageReport is the final payload sent to React
+type ShrinkageReport struct {
+	ByReason   []ShrinkageLine               `json:"by_reason"`
+	ByCategory []ShrinkageLine               `json:"by_category"`
+	Matrix     map[string]map[string]float64 `json:"matrix"` // category -> reason code -> cost
+	GrandTotal float64                       `json:"grand_total"`
+}
+
+// --- GET: /api/reports/shrinkage ---
+// GetShrinkageReport values all approved write-offs at cost, grouped by reason and by category
+func GetShrinkageReport(c *gin.Context) {
+	startTime, endTime := resolveTimeframe(c)
+
+	// 1. Only approved write-offs actually left the shelf
+	query := database.DB.Preload("Product").Where("status = ?", "approved")
+	if !startTime.IsZero() {
+		query = query.Where("approved_at >= ?", startTime)
+	}
+	if !endTime.IsZero() {
+		query = query.Where("approved_at <= ?", endTime)
+	}
+
+	var adjustments []models.StockAdjustment
+	if err := query.Find(&adjustments).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch write-offs"})
+		return
+	}
+
+	// 2. Bucket every write-off by reason and by top-level category
+	categoryTree := services.LoadCategoryTree(database.DB)
+	reasonMap := make(map[string]*ShrinkageLine)
+	categoryMap := make(map[string]*ShrinkageLine)
+	report := ShrinkageReport{Matrix: make(map[string]map[string]float64)}
+
+	for _, adj := range adjustments {
+		catName := categoryTree.RootName(adj.Product.CategoryID)
+
+		if _, exists := reasonMap[adj.ReasonCode]; !exists {
+			reasonMap[adj.ReasonCode] = &ShrinkageLine{Key: adj.ReasonCode, Label: WriteOffReasons[adj.ReasonCode]}
+		}
+		if _, exists := categoryMap[catName]; !exists {
+			categoryMap[catName] = &ShrinkageLine{Key: catName, Label: catName}
+		}
+		if _, exists := report.Matrix[catName]; !exists {
+			report.Matrix[catName] = make(map[string]float64)
+		}
+
+		for _, line := range []*ShrinkageLine{reasonMap[adj.ReasonCode], categoryMap[catName]} {
+			line.Count++
+			line.Quantity += adj.Quantity
+			line.TotalCost += adj.TotalCost
+		}
+		report.Matrix[catName][adj.ReasonCode] += adj.TotalCost
+		report.GrandTotal += adj.TotalCost
+	}
+
+	// 3. Flatten the maps, biggest losses first
+	for _, line := range reasonMap {
+		report.ByReason = append(report.ByReason, *line)
+	}
+	for _, line := range categoryMap {
+		report.ByCategory = append(report.ByCategory, *line)
+	}
+	sort.Slice(report.ByReason, func(i, j int) bool { return report.ByReason[i].TotalCost > report.ByReason[j].TotalCost })
+	sort.Slice(report.ByCategory, func(i, j int) bool { return report.ByCategory[i].TotalCost > report.ByCategory[j].TotalCost })
+
+	c.JSON(http.StatusOK, report)
 }
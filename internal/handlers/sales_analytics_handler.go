@@ -0,0 +1,342 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"go-pos-agent/internal/database"
+	"go-pos-agent/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// HeatmapCell is one hour-of-day on one day-of-week
+type HeatmapCell struct {
+	Weekday       int     `json:"weekday"` // 0 = Sunday ... 6 = Saturday
+	Hour          int     `json:"hour"`    // 0-23, shop local time
+	Revenue       float64 `json:"revenue"`
+	Orders        int64   `json:"orders"`
+	AverageBasket float64 `json:"average_basket"`
+}
+
+// HeatmapTotal rolls the grid up along one axis (a whole weekday or a whole hour)
+type HeatmapTotal struct {
+	Key           int     `json:"key"`
+	Label         string  `json:"label"`
+	Revenue       float64 `json:"revenue"`
+	Orders        int64   `json:"orders"`
+	AverageBasket float64 `json:"average_basket"`
+}
+
+// SalesHeatmap is the final payload sent to React
+type SalesHeatmap struct {
+	Cells     []HeatmapCell  `json:"cells"` // Always 7 x 24, weekday-major
+	ByWeekday []HeatmapTotal `json:"by_weekday"`
+	ByHour    []HeatmapTotal `json:"by_hour"`
+	Busiest   *HeatmapCell   `json:"busiest"` // Highest revenue slot, nil when there were no sales
+	Revenue   float64        `json:"revenue"`
+	Orders    int64          `json:"orders"`
+}
+
+// --- GET: /api/reports/heatmap ---
+// GetSalesHeatmap spreads revenue, order count and average basket over hour-of-day x day-of-week,
+// for staffing. Takes the same filters as /api/reports (timeframe, search, category, productType,
+// paymentMethod); with product filters only the matching lines of each sale count towards revenue.
+func GetSalesHeatmap(c *gin.Context) {
+	filters := parseSalesReportFilters(c)
+
+	// 1. One row per sale: when it happened and what it was worth under the filters
+	rows, err := filters.lineItems(database.DB).
+		Select("sales.id, sales.sale_time, SUM(sale_items.quantity * sale_items.price_at_sale) as revenue").
+		Group("sales.id, sales.sale_time").
+		Rows()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sales"})
+		return
+	}
+	defer rows.Close()
+
+	// 2. Bucket by local weekday and hour (done here rather than in SQL so the shop's time zone is honoured)
+	var grid [7][24]HeatmapCell
+	for d := 0; d < 7; d++ {
+		for h := 0; h < 24; h++ {
+			grid[d][h] = HeatmapCell{Weekday: d, Hour: h}
+		}
+	}
+
+	var report SalesHeatmap
+	for rows.Next() {
+		var sale struct {
+			ID       uint
+			SaleTime time.Time
+			Revenue  float64
+		}
+		if err := database.DB.ScanRows(rows, &sale); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read sales"})
+			return
+		}
+		local := sale.SaleTime.Local()
+		cell := &grid[int(local.Weekday())][local.Hour()]
+		cell.Revenue += sale.Revenue
+		cell.Orders++
+		report.Revenue += sale.Revenue
+		report.Orders++
+	}
+	// A heatmap missing some sales would quietly shift staffing decisions
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read sales"})
+		return
+	}
+
+	// 3. Flatten the grid and build both roll-ups
+	report.ByWeekday = make([]HeatmapTotal, 7)
+	report.ByHour = make([]HeatmapTotal, 24)
+	for d := 0; d < 7; d++ {
+		report.ByWeekday[d] = HeatmapTotal{Key: d, Label: time.Weekday(d).String()}
+	}
+	for h := 0; h < 24; h++ {
+		report.ByHour[h] = HeatmapTotal{Key: h, Label: time.Date(2000, 1, 1, h, 0, 0, 0, time.Local).Format("15:04")}
+	}
+
+	for d := 0; d < 7; d++ {
+		for h := 0; h < 24; h++ {
+			cell := grid[d][h]
+			cell.AverageBasket = averageBasket(cell.Revenue, cell.Orders)
+			report.Cells = append(report.Cells, cell)
+
+			report.ByWeekday[d].Revenue += cell.Revenue
+			report.ByWeekday[d].Orders += cell.Orders
+			report.ByHour[h].Revenue += cell.Revenue
+			report.ByHour[h].Orders += cell.Orders
+
+			if cell.Orders > 0 && (report.Busiest == nil || cell.Revenue > report.Busiest.Revenue) {
+				busiest := cell
+				report.Busiest = &busiest
+			}
+		}
+	}
+	for i := range report.ByWeekday {
+		report.ByWeekday[i].AverageBasket = averageBasket(report.ByWeekday[i].Revenue, report.ByWeekday[i].Orders)
+	}
+	for i := range report.ByHour {
+		report.ByHour[i].AverageBasket = averageBasket(report.ByHour[i].Revenue, report.ByHour[i].Orders)
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// averageBasket is revenue per order, 0 when there were no orders
+func averageBasket(revenue float64, orders int64) float64 {
+	if orders == 0 {
+		return 0
+	}
+	return revenue / float64(orders)
+}
+
+// CashierPerformance is one staff member's takings and till behaviour over the period
+type CashierPerformance struct {
+	UserID          uint    `json:"user_id"` // 0 = records made before cashiers were tracked
+	Username        string  `json:"username"`
+	Role            string  `json:"role"`
+	Orders          int64   `json:"orders"`
+	Revenue         float64 `json:"revenue"`
+	Profit          float64 `json:"profit"`
+	AverageBasket   float64 `json:"average_basket"`
+	ItemsPerBasket  float64 `json:"items_per_basket"` // Weighed lines count as one item
+	VoidCount       int64   `json:"void_count"`
+	VoidValue       float64 `json:"void_value"`
+	LineRemovals    int64   `json:"line_removals"`
+	DrawerOpens     int64   `json:"drawer_opens"` // Manual no-sale opens
+	ShiftsRun       int64   `json:"shifts_run"`   // Closed shifts this person opened
+	OverShort       float64 `json:"over_short"`   // Net of those shifts
+	ShortShiftCount int64   `json:"short_shift_count"`
+}
+
+// --- GET: /api/reports/cashiers ---
+// GetCashierReport compares staff over a period: sales count, revenue, average basket and items per basket
+// (same filters as /api/reports), plus voids, line removals, manual drawer opens and shift over/short.
+// Shift over/short belongs to whoever opened the shift, since they counted the float in.
+func GetCashierReport(c *gin.Context) {
+	filters := parseSalesReportFilters(c)
+	start, end := filters.Start, filters.End
+	inPeriod := func(query *gorm.DB, column string) *gorm.DB {
+		if !start.IsZero() {
+			query = query.Where(column+" >= ?", start)
+		}
+		if !end.IsZero() {
+			query = query.Where(column+" <= ?", end)
+		}
+		return query
+	}
+
+	// 1. Everyone who can work the till appears, even on a quiet period
+	var users []models.User
+	if err := database.DB.Order("username asc").Find(&users).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch staff"})
+		return
+	}
+	rows := make(map[uint]*CashierPerformance)
+	userIDByName := make(map[string]uint)
+	for _, u := range users {
+		rows[u.ID] = &CashierPerformance{UserID: u.ID, Username: u.Username, Role: u.Role}
+		userIDByName[u.Username] = u.ID
+	}
+	row := func(userID uint) *CashierPerformance {
+		if _, exists := rows[userID]; !exists {
+			rows[userID] = &CashierPerformance{UserID: userID, Username: "Unattributed"}
+		}
+		return rows[userID]
+	}
+
+	// 2. Sales
+	sales, err := filters.cashierSales()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to aggregate sales by cashier"})
+		return
+	}
+	for _, s := range sales {
+		r := row(s.UserID)
+		r.Orders, r.Revenue, r.Profit = s.Orders, s.Revenue, s.Revenue-s.Cost
+		r.AverageBasket = averageBasket(s.Revenue, s.Orders)
+		if s.Orders > 0 {
+			r.ItemsPerBasket = s.Items / float64(s.Orders)
+		}
+	}
+
+	// 3. Voids, line removals and manual drawer opens
+	var voids []struct {
+		UserID uint
+		Count  int64
+		Value  float64
+	}
+	err = inPeriod(database.DB.Model(&models.VoidedTransaction{}), "timestamp").
+		Select("user_id, COUNT(id) as count, COALESCE(SUM(total_value_lost), 0) as value").
+		Group("user_id").Scan(&voids).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to aggregate voids by cashier"})
+		return
+	}
+	for _, v := range voids {
+		row(v.UserID).VoidCount, row(v.UserID).VoidValue = v.Count, v.Value
+	}
+
+	var counts []struct {
+		UserID uint
+		Count  int64
+	}
+	err = inPeriod(database.DB.Model(&models.SuspiciousActivityLog{}), "timestamp").
+		Where("action = ?", "PARTIAL_LINE_VOID").
+		Select("user_id, COUNT(id) as count").Group("user_id").Scan(&counts).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to aggregate line removals by cashier"})
+		return
+	}
+	for _, r := range counts {
+		row(r.UserID).LineRemovals = r.Count
+	}
+
+	counts = nil
+	err = inPeriod(database.DB.Model(&models.DrawerActivityLog{}), "timestamp").
+		Where("status = ?", "Completed").
+		Select("staff_id as user_id, COUNT(id) as count").Group("staff_id").Scan(&counts).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to aggregate drawer opens by cashier"})
+		return
+	}
+	for _, r := range counts {
+		row(r.UserID).DrawerOpens = r.Count
+	}
+
+	// 4. Closed shifts (stored by username)
+	var shifts []models.ShiftLog
+	if err := inPeriod(database.DB.Where("status = ?", "closed"), "closed_at").Find(&shifts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch closed shifts"})
+		return
+	}
+	for _, s := range shifts {
+		r := row(userIDByName[s.OpenedBy])
+		r.ShiftsRun++
+		r.OverShort += s.OverShortAmount
+		if s.OverShortAmount < -0.005 {
+			r.ShortShiftCount++
+		}
+	}
+
+	// 5. Biggest sellers first
+	report := make([]CashierPerformance, 0, len(rows))
+	for _, r := range rows {
+		report = append(report, *r)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		if report[i].Revenue != report[j].Revenue {
+			return report[i].Revenue > report[j].Revenue
+		}
+		return report[i].Username < report[j].Username
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"start":    start,
+		"end":      end,
+		"cashiers": report,
+	})
+}
+
+// cashierSales totals the period per cashier. Whole past days come from daily_cashier_sales when the
+// filters don't narrow the receipts (a product or tender filter needs the raw lines).
+func (f salesReportFilters) cashierSales() ([]models.DailyCashierSales, error) {
+	plan := f.plan()
+	pieces := plan.Live
+	if plan.UseSummary && (f.filtersProducts() || (f.PaymentMethod != "" && f.PaymentMethod != "All")) {
+		plan.UseSummary = false
+		pieces = []salesReportFilters{f}
+	}
+
+	byUser := make(map[uint]*models.DailyCashierSales)
+	add := func(rows []models.DailyCashierSales) {
+		for _, r := range rows {
+			if _, exists := byUser[r.UserID]; !exists {
+				byUser[r.UserID] = &models.DailyCashierSales{UserID: r.UserID}
+			}
+			byUser[r.UserID].Orders += r.Orders
+			byUser[r.UserID].Revenue += r.Revenue
+			byUser[r.UserID].Cost += r.Cost
+			byUser[r.UserID].Items += r.Items
+		}
+	}
+
+	for _, live := range pieces {
+		var rows []models.DailyCashierSales
+		err := live.lineItems(database.DB).
+			Select("sales.user_id, COUNT(DISTINCT sales.id) as orders, " +
+				"SUM(sale_items.quantity * sale_items.price_at_sale) as revenue, " +
+				"SUM(sale_items.quantity * sale_items.buy_price_rm) as cost, " +
+				"SUM(CASE WHEN products.is_weighable THEN 1 ELSE sale_items.quantity END) as items").
+			Group("sales.user_id").
+			Scan(&rows).Error
+		if err != nil {
+			return nil, err
+		}
+		add(rows)
+	}
+	if plan.UseSummary {
+		var rows []models.DailyCashierSales
+		query := database.DB.Model(&models.DailyCashierSales{}).Where("day <= ?", plan.ToDay)
+		if plan.FromDay != "" {
+			query = query.Where("day >= ?", plan.FromDay)
+		}
+		err := query.Select("user_id, SUM(orders) as orders, SUM(revenue) as revenue, SUM(cost) as cost, SUM(items) as items").
+			Group("user_id").Scan(&rows).Error
+		if err != nil {
+			return nil, err
+		}
+		add(rows)
+	}
+
+	totals := make([]models.DailyCashierSales, 0, len(byUser))
+	for _, r := range byUser {
+		totals = append(totals, *r)
+	}
+	return totals, nil
+}
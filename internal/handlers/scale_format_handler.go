@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"go-pos-agent/internal/database"
+	"go-pos-agent/internal/models"
+	"go-pos-agent/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ScaleFormatRequest defines the payload for creating or editing a scale barcode layout
+type ScaleFormatRequest struct {
+	Name           string `json:"name" binding:"required"`
+	PrefixFrom     int    `json:"prefix_from" binding:"required"`
+	PrefixTo       int    `json:"prefix_to" binding:"required"`
+	ItemCodeLength int    `json:"item_code_length" binding:"required"`
+	ValueType      string `json:"value_type" binding:"required"` // "price" or "weight"
+	Decimals       int    `json:"decimals"`
+	IsActive       *bool  `json:"is_active"` // Defaults to true
+}
+
+// toFormat copies the request onto a format row
+func (req ScaleFormatRequest) toFormat(format *models.ScaleBarcodeFormat) {
+	format.Name = req.Name
+	format.PrefixFrom = req.PrefixFrom
+	format.PrefixTo = req.PrefixTo
+	format.ItemCodeLength = req.ItemCodeLength
+	format.ValueType = req.ValueType
+	format.Decimals = req.Decimals
+	format.IsActive = req.IsActive == nil || *req.IsActive
+}
+
+// --- GET: /api/settings/scale-barcodes ---
+// GetScaleBarcodeFormats lists every configured scale label layout
+func GetScaleBarcodeFormats(c *gin.Context) {
+	var formats []models.ScaleBarcodeFormat
+	if err := database.DB.Order("prefix_from asc").Find(&formats).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch scale barcode formats"})
+		return
+	}
+	c.JSON(http.StatusOK, formats)
+}
+
+// --- POST: /api/settings/scale-barcodes ---
+// CreateScaleBarcodeFormat adds a new layout (e.g., 22-23 weight-embedded, 3 decimals for kg)
+func CreateScaleBarcodeFormat(c *gin.Context) {
+	var req ScaleFormatRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name, prefix range, item code length and value type are required"})
+		return
+	}
+
+	var format models.ScaleBarcodeFormat
+	req.toFormat(&format)
+
+	if err := services.ValidateScaleBarcodeFormat(database.DB, format); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := database.DB.Create(&format).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save scale barcode format"})
+		return
+	}
+	c.JSON(http.StatusCreated, format)
+}
+
+// --- PUT: /api/settings/scale-barcodes/:id ---
+// UpdateScaleBarcodeFormat edits or (de)activates a layout
+func UpdateScaleBarcodeFormat(c *gin.Context) {
+	var format models.ScaleBarcodeFormat
+	if err := database.DB.First(&format, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Scale barcode format not found"})
+		return
+	}
+
+	var req ScaleFormatRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name, prefix range, item code length and value type are required"})
+		return
+	}
+	req.toFormat(&format)
+
+	if err := services.ValidateScaleBarcodeFormat(database.DB, format); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	format.UpdatedAt = time.Now()
+	if err := database.DB.Save(&format).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update scale barcode format"})
+		return
+	}
+	c.JSON(http.StatusOK, format)
+}
+
+// --- DELETE: /api/settings/scale-barcodes/:id ---
+// DeleteScaleBarcodeFormat removes a layout; its prefixes are then read as normal product barcodes
+func DeleteScaleBarcodeFormat(c *gin.Context) {
+	if err := database.DB.Delete(&models.ScaleBarcodeFormat{}, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete scale barcode format"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Scale barcode format deleted"})
+}
@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-pos-agent/internal/database"
+	"go-pos-agent/internal/models"
+	"go-pos-agent/internal/scale"
+	"go-pos-agent/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LabelScaleRequest defines the payload for registering or editing a networked label scale
+type LabelScaleRequest struct {
+	Name     string `json:"name" binding:"required"`
+	Host     string `json:"host" binding:"required"`
+	Protocol string `json:"protocol"`  // Defaults to "cas"
+	Port     int    `json:"port"`      // Defaults to the protocol's port
+	IsActive *bool  `json:"is_active"` // Defaults to true
+	AutoSync bool   `json:"auto_sync"` // Off until the scale is opted in to automatic pushes
+}
+
+// toScale copies the request onto a scale row
+func (req LabelScaleRequest) toScale(labelScale *models.LabelScale) error {
+	if req.Protocol == "" {
+		req.Protocol = "cas"
+	}
+	protocol, err := scale.GetNetworkExporter(req.Protocol)
+	if err != nil {
+		return err
+	}
+	if req.Port == 0 {
+		req.Port = protocol.DefaultPort()
+	}
+	if req.Port < 1 || req.Port > 65535 {
+		return fmt.Errorf("Port must be between 1 and 65535")
+	}
+	labelScale.Name = req.Name
+	labelScale.Host = req.Host
+	labelScale.Protocol = req.Protocol
+	labelScale.Port = req.Port
+	labelScale.IsActive = req.IsActive == nil || *req.IsActive
+	labelScale.AutoSync = req.AutoSync
+	return nil
+}
+
+// --- GET: /api/scales ---
+// GetLabelScales lists the registered scales with their last sync outcome
+func GetLabelScales(c *gin.Context) {
+	var scales []models.LabelScale
+	if err := database.DB.Order("name asc").Find(&scales).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch label scales"})
+		return
+	}
+	c.JSON(http.StatusOK, scales)
+}
+
+// --- POST: /api/scales ---
+// CreateLabelScale registers a scale; it gets the full PLU list on its first sync
+func CreateLabelScale(c *gin.Context) {
+	var req LabelScaleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name and host are required"})
+		return
+	}
+
+	var labelScale models.LabelScale
+	if err := req.toScale(&labelScale); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := database.DB.Create(&labelScale).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save label scale"})
+		return
+	}
+	c.JSON(http.StatusCreated, labelScale)
+}
+
+// --- PUT: /api/scales/:id ---
+// UpdateLabelScale edits a scale. Moving it to a new address or protocol forgets what it holds,
+// because the device answering there may be a different (or wiped) scale.
+func UpdateLabelScale(c *gin.Context) {
+	var labelScale models.LabelScale
+	if err := database.DB.First(&labelScale, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Label scale not found"})
+		return
+	}
+
+	var req LabelScaleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name and host are required"})
+		return
+	}
+
+	oldAddress := fmt.Sprintf("%s:%d/%s", labelScale.Host, labelScale.Port, labelScale.Protocol)
+	if err := req.toScale(&labelScale); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	labelScale.UpdatedAt = time.Now()
+	if err := database.DB.Save(&labelScale).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update label scale"})
+		return
+	}
+
+	if fmt.Sprintf("%s:%d/%s", labelScale.Host, labelScale.Port, labelScale.Protocol) != oldAddress {
+		database.DB.Where("scale_id = ?", labelScale.ID).Delete(&models.ScalePLUState{})
+	}
+	c.JSON(http.StatusOK, labelScale)
+}
+
+// --- DELETE: /api/scales/:id ---
+// DeleteLabelScale removes a scale and its sync state (the sync log is kept for the record)
+func DeleteLabelScale(c *gin.Context) {
+	var labelScale models.LabelScale
+	if err := database.DB.First(&labelScale, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Label scale not found"})
+		return
+	}
+
+	database.DB.Where("scale_id = ?", labelScale.ID).Delete(&models.ScalePLUState{})
+	if err := database.DB.Delete(&labelScale).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete label scale"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Label scale deleted"})
+}
+
+// --- POST: /api/scales/:id/ping ---
+// PingLabelScale checks the scale is reachable and speaking the PLU protocol
+func PingLabelScale(c *gin.Context) {
+	var labelScale models.LabelScale
+	if err := database.DB.First(&labelScale, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Label scale not found"})
+		return
+	}
+
+	address := fmt.Sprintf("%s:%d", labelScale.Host, labelScale.Port)
+	client, err := services.DialScale(labelScale, 3*time.Second)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Cannot reach scale at " + address, "details": err.Error()})
+		return
+	}
+	defer client.Close()
+
+	if err := client.Ping(); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Scale did not answer the ping", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Scale is online", "address": address, "protocol": labelScale.Protocol})
+}
+
+// --- POST: /api/scales/:id/sync?full=true ---
+// SyncLabelScale pushes changes to one scale right now and returns the run.
+// full=true re-sends every PLU, e.g. after the scale's memory was cleared.
+func SyncLabelScale(c *gin.Context) {
+	var labelScale models.LabelScale
+	if err := database.DB.First(&labelScale, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Label scale not found"})
+		return
+	}
+
+	full := c.Query("full") == "true"
+	trigger := "manual"
+	if full {
+		trigger = "full_resync"
+	}
+
+	run, err := services.SyncScale(database.DB, labelScale, trigger, full)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Scale sync did not complete: " + err.Error(), "sync": run})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Scale is up to date", "sync": run})
+}
+
+// --- GET: /api/scales/:id/sync-logs?limit=50 ---
+// GetScaleSyncLogs shows the most recent sync runs for one scale
+func GetScaleSyncLogs(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 500 {
+		limit = 50
+	}
+
+	var logs []models.ScaleSyncLog
+	if err := database.DB.Where("scale_id = ?", c.Param("id")).Order("id desc").Limit(limit).Find(&logs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sync logs"})
+		return
+	}
+	c.JSON(http.StatusOK, logs)
+}
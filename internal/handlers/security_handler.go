@@ -179,6 +179,7 @@ func LogRemoval(c *gin.Context) {
 
 	logEntry := models.SuspiciousActivityLog{
 		SessionID: req.SessionID,
+		UserID:    c.MustGet("userID").(uint), // Attributes the removal to the cashier for the per-cashier report
 		Action:    "PARTIAL_LINE_VOID",
 		ItemName:  req.ItemName,
 		Timestamp: time.Now(),
@@ -202,7 +203,7 @@ func StopSuccess(c *gin.Context) {
 	}
 
 	// Hand off to the background Goroutine. We safely hijack the 'reason' parameter to pass the ReceiptID.
-	go finalizeRecording(req.SessionID, true, req.OrderID, req.ReceiptID, 0, "")
+	go finalizeRecording(req.SessionID, c.MustGet("userID").(uint), true, req.OrderID, req.ReceiptID, 0, "")
 
 	c.JSON(http.StatusOK, gin.H{"status": "finalizing_success_in_background"})
 }
@@ -221,13 +222,13 @@ func StopVoid(c *gin.Context) {
 		return
 	}
 
-	go finalizeRecording(req.SessionID, false, 0, req.Reason, req.TotalValueLost, req.ItemsInCart)
+	go finalizeRecording(req.SessionID, c.MustGet("userID").(uint), false, 0, req.Reason, req.TotalValueLost, req.ItemsInCart)
 
 	c.JSON(http.StatusOK, gin.H{"status": "finalizing_void_in_background"})
 }
 
 // finalizeRecording - The Background Engine handling the 30-Second Overhang
-func finalizeRecording(sessionID string, isSuccess bool, orderID uint, reasonOrReceipt string, valueLost float64, items string) {
+func finalizeRecording(sessionID string, userID uint, isSuccess bool, orderID uint, reasonOrReceipt string, valueLost float64, items string) {
 	// 1. Find the active session in server memory
 	recordingMutex.Lock()
 	session, exists := activeRecordings[sessionID]
@@ -291,6 +292,7 @@ func finalizeRecording(sessionID string, isSuccess bool, orderID uint, reasonOrR
 		// Create a brand new record in the VoidedTransactions table
 		voidRecord := models.VoidedTransaction{
 			SessionID:        sessionID,
+			UserID:           userID, // The cashier who abandoned the cart
 			TotalValueLost:   valueLost,
 			ItemsInCart:      items,
 			Reason:           reasonOrReceipt, // Here it correctly logs the true Void Reason
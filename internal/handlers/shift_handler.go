@@ -7,8 +7,10 @@ import (
 
 	"go-pos-agent/internal/database"
 	"go-pos-agent/internal/models"
+	"go-pos-agent/internal/services"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // ==========================================
@@ -25,6 +27,84 @@ func GetStoreSettings(c *gin.Context) {
 	c.JSON(http.StatusOK, settings)
 }
 
+// UpdateStoreSettings lets the admin change the master config. Only known keys are accepted.
+func UpdateStoreSettings(c *gin.Context) {
+	var settings models.StoreSettings
+	if err := database.DB.First(&settings).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch store settings"})
+		return
+	}
+
+	var input map[string]interface{}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	allowed := map[string]bool{
+		"enable_shift_tracking":        true,
+		"write_off_approval_threshold": true,
+		"negative_stock_policy":        true,
+		"internal_barcode_prefix":      true,
+		"sst_rate_percent":             true,
+		"store_name":                   true,
+		"store_address":                true,
+		"store_tax_number":             true,
+	}
+	updates := make(map[string]interface{})
+	for key, value := range input {
+		if !allowed[key] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown setting: " + key})
+			return
+		}
+		updates[key] = value
+	}
+
+	if policy, ok := updates["negative_stock_policy"]; ok && policy != "block" && policy != "allow" && policy != "warn" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "negative_stock_policy must be block, allow or warn"})
+		return
+	}
+
+	if rate, ok := updates["sst_rate_percent"]; ok {
+		if r, isNum := rate.(float64); !isNum || r < 0 || r > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "sst_rate_percent must be between 0 and 100"})
+			return
+		}
+	}
+
+	if threshold, ok := updates["write_off_approval_threshold"]; ok {
+		if t, isNum := threshold.(float64); !isNum || t < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "write_off_approval_threshold must be a number of at least 0"})
+			return
+		}
+	}
+
+	if tracking, ok := updates["enable_shift_tracking"]; ok {
+		if _, isBool := tracking.(bool); !isBool {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "enable_shift_tracking must be true or false"})
+			return
+		}
+	}
+
+	if prefix, ok := updates["internal_barcode_prefix"]; ok {
+		prefixStr, _ := prefix.(string)
+		if err := services.ValidateInternalBarcodePrefix(prefixStr); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := services.CheckInternalPrefixFree(database.DB, prefixStr); err != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if err := database.DB.Model(&settings).Updates(updates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update store settings"})
+		return
+	}
+	c.JSON(http.StatusOK, settings)
+}
+
 // GetActiveShift checks if there is currently an open register session
 func GetActiveShift(c *gin.Context) {
 	var activeShift models.ShiftLog
@@ -197,12 +277,17 @@ func CloseShift(c *gin.Context) {
 	}
 	var summaries []PaymentSummary
 
-	database.DB.Model(&models.Sale{}).
+	err := database.DB.Model(&models.Sale{}).
 		Select("LOWER(payment_method) as payment_method, COALESCE(SUM(total_amount), 0) as total, COUNT(id) as count").
 		Where("sale_time >= ?", activeShift.OpenedAt).
 		Where("status = ?", "completed").
 		Group("LOWER(payment_method)").
-		Scan(&summaries)
+		Scan(&summaries).Error
+	if err != nil {
+		log.Printf("❌ Failed to total shift %d: %v", activeShift.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to total the shift's sales"})
+		return
+	}
 
 	activeShift.TotalCash = 0
 	activeShift.CashCount = 0
@@ -226,9 +311,14 @@ func CloseShift(c *gin.Context) {
 
 	// 3. Core Till Math (Cleaned up!)
 	var tillPayouts float64
-	database.DB.Model(&models.Expense{}).
+	err = database.DB.Model(&models.Expense{}).
 		Where("shift_id = ? AND paid_from_till = ?", activeShift.ID, true).
-		Select("COALESCE(SUM(amount), 0)").Scan(&tillPayouts)
+		Select("COALESCE(SUM(amount), 0)").Scan(&tillPayouts).Error
+	if err != nil {
+		log.Printf("❌ Failed to total payouts for shift %d: %v", activeShift.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to total the shift's payouts"})
+		return
+	}
 
 	activeShift.ExpectedCash = activeShift.OpeningCash + activeShift.TotalCash - tillPayouts
 	activeShift.ActualClosingCash = req.ActualClosingCash
@@ -258,7 +348,18 @@ func CloseShift(c *gin.Context) {
 		activeShift.ClosingVideoURL = "NO_VIDEO"
 	}
 
-	if err := database.DB.Save(&activeShift).Error; err != nil {
+	// 6. Save the shift and issue its Z-report together, so a closed shift always has exactly one
+	var zReport *models.ZReport
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&activeShift).Error; err != nil {
+			return err
+		}
+		var zErr error
+		zReport, zErr = createZReport(tx, activeShift, closedBy)
+		return zErr
+	})
+	if err != nil {
+		log.Printf("❌ Failed to close shift %d: %v", activeShift.ID, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to close shift and save totals"})
 		return
 	}
@@ -269,8 +370,9 @@ func CloseShift(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Shift closed successfully",
-		"shift":   activeShift,
+		"message":  "Shift closed successfully",
+		"shift":    activeShift,
+		"z_report": zReport, // Full content: GET /api/reports/z/:number
 	})
 }
 
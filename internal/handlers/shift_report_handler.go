@@ -0,0 +1,501 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-pos-agent/internal/database"
+	"go-pos-agent/internal/models"
+	"go-pos-agent/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ShiftReport is the content of an X-report (mid-shift snapshot, changes nothing)
+// or a Z-report (issued once when the shift closes, numbered and frozen).
+type ShiftReport struct {
+	Kind        string      `json:"kind"`     // "X" or "Z"
+	ZNumber     uint64      `json:"z_number"` // 0 on X-reports
+	ShiftID     uint        `json:"shift_id"`
+	OpenedAt    time.Time   `json:"opened_at"`
+	ClosedAt    *time.Time  `json:"closed_at"`
+	PeriodEnd   time.Time   `json:"period_end"` // Everything up to this moment is included
+	OpenedBy    string      `json:"opened_by"`
+	ClosedBy    string      `json:"closed_by"`
+	GeneratedAt time.Time   `json:"generated_at"`
+	GeneratedBy string      `json:"generated_by"`
+	Store       StoreHeader `json:"store"` // As it stood when the report was built (frozen on Z-reports)
+
+	// Sales
+	GrossSales       float64      `json:"gross_sales"`
+	TransactionCount int64        `json:"transaction_count"`
+	ItemsSold        float64      `json:"items_sold"`
+	AverageSale      float64      `json:"average_sale"`
+	Tenders          []TenderLine `json:"tenders"`
+
+	// Corrections
+	VoidCount     int64   `json:"void_count"` // Whole carts abandoned / cleared
+	VoidValue     float64 `json:"void_value"`
+	LineVoidCount int64   `json:"line_void_count"` // Single lines removed from a cart
+
+	// Drawer
+	Payouts          []PayoutLine `json:"payouts"`
+	PayoutTotal      float64      `json:"payout_total"`
+	DrawerOpenCount  int64        `json:"drawer_open_count"`  // Manual no-sale opens
+	DrawerOpenCancel int64        `json:"drawer_open_cancel"` // Opens started but cancelled
+
+	// Tax (prices include SST)
+	SSTRatePercent  float64 `json:"sst_rate_percent"`
+	TaxableSales    float64 `json:"taxable_sales"`
+	NonTaxableSales float64 `json:"non_taxable_sales"`
+	SSTAmount       float64 `json:"sst_amount"`
+
+	// Cash reconciliation
+	OpeningCash  float64  `json:"opening_cash"`
+	CashSales    float64  `json:"cash_sales"`
+	ExpectedCash float64  `json:"expected_cash"`
+	CountedCash  *float64 `json:"counted_cash"` // Only known on the Z-report
+	OverShort    *float64 `json:"over_short"`
+
+	Notes []string `json:"notes"` // What the figures leave out
+}
+
+// TenderLine is the takings for one payment method
+type TenderLine struct {
+	Method string  `json:"method"`
+	Count  int64   `json:"count"`
+	Amount float64 `json:"amount"`
+}
+
+// PayoutLine is one till payout (cash taken out of the drawer for an expense)
+type PayoutLine struct {
+	Type        string  `json:"type"`
+	Description string  `json:"description"`
+	Amount      float64 `json:"amount"`
+}
+
+// ZReportView is a stored Z-report with its frozen content and whether the hash chain still holds
+type ZReportView struct {
+	models.ZReport
+	Report   ShiftReport `json:"report"`
+	Verified bool        `json:"verified"` // False means the stored payload was altered after it was issued
+	Chained  bool        `json:"chained"`  // False means Z number - 1 is missing or isn't the report this one was chained to
+}
+
+// --- GET: /api/shift/x-report?format=json|escpos ---
+// GetXReport reports on the open shift so far. It can be run any number of times and resets nothing.
+func GetXReport(c *gin.Context) {
+	var shift models.ShiftLog
+	if err := database.DB.Where("status = ?", "open").Where("closed_at IS NULL").First(&shift).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No open shift to report on"})
+		return
+	}
+
+	report, err := buildShiftReport(database.DB, shift, time.Now())
+	if err != nil {
+		log.Printf("❌ Failed to build X-report for shift %d: %v", shift.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build X-report"})
+		return
+	}
+	report.Kind = "X"
+	report.GeneratedBy = currentUsername(c)
+
+	writeShiftReport(c, report, false)
+}
+
+// --- POST: /api/shift/x-report/print ---
+// PrintXReport sends the X-report to the receipt printer
+func PrintXReport(c *gin.Context) {
+	var shift models.ShiftLog
+	if err := database.DB.Where("status = ?", "open").Where("closed_at IS NULL").First(&shift).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No open shift to report on"})
+		return
+	}
+
+	report, err := buildShiftReport(database.DB, shift, time.Now())
+	if err != nil {
+		log.Printf("❌ Failed to build X-report for shift %d: %v", shift.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build X-report"})
+		return
+	}
+	report.Kind = "X"
+	report.GeneratedBy = currentUsername(c)
+
+	printShiftReport(c, report, false)
+}
+
+// --- GET: /api/reports/z ---
+// GetZReports lists issued Z-reports, newest first (?limit=, default 60)
+func GetZReports(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "60"))
+	if err != nil || limit < 1 || limit > 500 {
+		limit = 60
+	}
+
+	var reports []models.ZReport
+	if err := database.DB.Order("z_number desc").Limit(limit).Find(&reports).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch Z-reports"})
+		return
+	}
+	c.JSON(http.StatusOK, reports)
+}
+
+// --- GET: /api/reports/z/:number?format=json|escpos|pdf ---
+// GetZReport returns a Z-report exactly as issued, with its hash check
+func GetZReport(c *gin.Context) {
+	view, err := loadZReport(c.Param("number"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Z-report not found"})
+		return
+	}
+
+	switch c.DefaultQuery("format", "json") {
+	case "json":
+		c.JSON(http.StatusOK, view)
+	case "pdf":
+		writePDF(c, renderZReportPDF(view.Report), fmt.Sprintf("z_report_%06d.pdf", view.ZNumber))
+	default:
+		writeShiftReport(c, view.Report, false)
+	}
+}
+
+// --- POST: /api/reports/z/:number/print ---
+// PrintZReport reprints a Z-report (marked as a reprint on the slip)
+func PrintZReport(c *gin.Context) {
+	view, err := loadZReport(c.Param("number"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Z-report not found"})
+		return
+	}
+	printShiftReport(c, view.Report, true)
+}
+
+// createZReport issues the next Z number for a closed shift. Runs inside the CloseShift transaction,
+// so a shift can never be closed without its Z-report (or get two).
+func createZReport(tx *gorm.DB, shift models.ShiftLog, generatedBy string) (*models.ZReport, error) {
+	// 1. Take the next number from the permanent counter (row locked so two closes can't share one)
+	var settings models.StoreSettings
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&settings).Error; err != nil {
+		return nil, fmt.Errorf("store settings missing: %v", err)
+	}
+	zNumber := settings.ZReportCounter + 1
+	if err := tx.Model(&settings).Update("z_report_counter", zNumber).Error; err != nil {
+		return nil, err
+	}
+
+	// 2. Freeze the report content
+	report, err := buildShiftReport(tx, shift, *shift.ClosedAt)
+	if err != nil {
+		return nil, err
+	}
+	report.Kind = "Z"
+	report.ZNumber = zNumber
+	report.GeneratedBy = generatedBy
+	payload, err := json.Marshal(report)
+	if err != nil {
+		return nil, err
+	}
+
+	// 3. Chain it to the previous Z-report
+	var previous models.ZReport
+	previousHash := ""
+	if err := tx.Order("z_number desc").First(&previous).Error; err == nil {
+		previousHash = previous.PayloadHash
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	zReport := &models.ZReport{
+		ZNumber:      zNumber,
+		ShiftID:      shift.ID,
+		GeneratedAt:  report.GeneratedAt,
+		GeneratedBy:  generatedBy,
+		Payload:      string(payload),
+		PayloadHash:  zReportHash(previousHash, string(payload)),
+		PreviousHash: previousHash,
+	}
+	if err := tx.Create(zReport).Error; err != nil {
+		return nil, err
+	}
+	return zReport, nil
+}
+
+// buildShiftReport totals everything that happened at the till between the shift opening and 'end'.
+// Any failed query fails the report: a Z-report with a silently missing section can't be reissued.
+func buildShiftReport(db *gorm.DB, shift models.ShiftLog, end time.Time) (ShiftReport, error) {
+	report := ShiftReport{
+		ShiftID:     shift.ID,
+		OpenedAt:    shift.OpenedAt,
+		ClosedAt:    shift.ClosedAt,
+		PeriodEnd:   end,
+		OpenedBy:    shift.OpenedBy,
+		ClosedBy:    shift.ClosedBy,
+		GeneratedAt: time.Now(),
+		OpeningCash: shift.OpeningCash,
+		Tenders:     []TenderLine{},
+		Payouts:     []PayoutLine{},
+		Notes:       []string{"No refunds line: the till has no refund flow, so refunds are not recorded"},
+	}
+	inShift := func(column string) (string, time.Time, time.Time) {
+		return column + " >= ? AND " + column + " <= ?", shift.OpenedAt, end
+	}
+
+	// 1. Sales by tender
+	err := db.Model(&models.Sale{}).
+		Select("LOWER(payment_method) as method, COUNT(id) as count, COALESCE(SUM(total_amount), 0) as amount").
+		Where(inShift("sale_time")).
+		Where("status = ?", "completed").
+		Group("LOWER(payment_method)").
+		Order("amount desc").
+		Scan(&report.Tenders).Error
+	if err != nil {
+		return report, fmt.Errorf("sales by tender: %w", err)
+	}
+	for _, t := range report.Tenders {
+		report.GrossSales += t.Amount
+		report.TransactionCount += t.Count
+		if t.Method == "cash" {
+			report.CashSales = t.Amount
+		}
+	}
+	if report.TransactionCount > 0 {
+		report.AverageSale = report.GrossSales / float64(report.TransactionCount)
+	}
+
+	// 2. Items and tax. Prices include SST, so the tax is the rate's share of the taxable takings.
+	// What a receipt charged (total_amount, after any discount or rounding) is split between its taxable
+	// and non-taxable lines by their shelf value, so the tax lines add up to the tenders above.
+	// The product's current SST flag is used (sale lines don't store it).
+	saleLines := db.Table("sale_items").
+		Select("sale_items.sale_id, SUM(sale_items.quantity) as items, " +
+			"SUM(CASE WHEN products.is_sst_applicable THEN sale_items.quantity * sale_items.price_at_sale ELSE 0 END) as taxable, " +
+			"SUM(sale_items.quantity * sale_items.price_at_sale) as total").
+		Joins("JOIN sales ON sale_items.sale_id = sales.id").
+		Joins("LEFT JOIN products ON sale_items.product_id = products.id").
+		Where(inShift("sales.sale_time")).
+		Group("sale_items.sale_id")
+	var lines struct {
+		Items   float64
+		Taxable float64
+	}
+	err = db.Table("sales").
+		Select("COALESCE(SUM(sale_lines.items), 0) as items, "+
+			"COALESCE(SUM(CASE WHEN sale_lines.total > 0 THEN sales.total_amount * sale_lines.taxable / sale_lines.total ELSE 0 END), 0) as taxable").
+		Joins("JOIN (?) sale_lines ON sale_lines.sale_id = sales.id", saleLines).
+		Where(inShift("sales.sale_time")).
+		Where("sales.status = ?", "completed").
+		Scan(&lines).Error
+	if err != nil {
+		return report, fmt.Errorf("items and tax: %w", err)
+	}
+
+	var settings models.StoreSettings
+	if err := db.First(&settings).Error; err != nil {
+		return report, fmt.Errorf("store settings: %w", err)
+	}
+	report.Store = StoreHeader{Name: settings.StoreName, Address: settings.StoreAddress, TaxNumber: settings.StoreTaxNumber}
+	report.ItemsSold = lines.Items
+	report.SSTRatePercent = settings.SSTRatePercent
+	report.TaxableSales = lines.Taxable
+	report.NonTaxableSales = report.GrossSales - lines.Taxable
+	report.SSTAmount = lines.Taxable * settings.SSTRatePercent / (100 + settings.SSTRatePercent)
+
+	// 3. Voids and line voids
+	if err := db.Model(&models.VoidedTransaction{}).Where(inShift("timestamp")).Count(&report.VoidCount).Error; err != nil {
+		return report, fmt.Errorf("voids: %w", err)
+	}
+	if err := db.Model(&models.VoidedTransaction{}).Where(inShift("timestamp")).Select("COALESCE(SUM(total_value_lost), 0)").Scan(&report.VoidValue).Error; err != nil {
+		return report, fmt.Errorf("void value: %w", err)
+	}
+	if err := db.Model(&models.SuspiciousActivityLog{}).Where(inShift("timestamp")).Where("action = ?", "PARTIAL_LINE_VOID").Count(&report.LineVoidCount).Error; err != nil {
+		return report, fmt.Errorf("line voids: %w", err)
+	}
+
+	// 4. Payouts and no-sale drawer opens
+	var payouts []models.Expense
+	if err := db.Where("shift_id = ? AND paid_from_till = ?", shift.ID, true).Order("date asc").Find(&payouts).Error; err != nil {
+		return report, fmt.Errorf("payouts: %w", err)
+	}
+	for _, p := range payouts {
+		report.Payouts = append(report.Payouts, PayoutLine{Type: p.ExpenseType, Description: p.Description, Amount: p.Amount})
+		report.PayoutTotal += p.Amount
+	}
+	if err := db.Model(&models.DrawerActivityLog{}).Where(inShift("timestamp")).Where("status = ?", "Completed").Count(&report.DrawerOpenCount).Error; err != nil {
+		return report, fmt.Errorf("drawer opens: %w", err)
+	}
+	if err := db.Model(&models.DrawerActivityLog{}).Where(inShift("timestamp")).Where("status <> ?", "Completed").Count(&report.DrawerOpenCancel).Error; err != nil {
+		return report, fmt.Errorf("cancelled drawer opens: %w", err)
+	}
+
+	// 5. Cash in the drawer. Over/short only exists once the closing count is in.
+	report.ExpectedCash = report.OpeningCash + report.CashSales - report.PayoutTotal
+	if shift.Status == "closed" {
+		counted := shift.ActualClosingCash
+		overShort := counted - report.ExpectedCash
+		report.CountedCash = &counted
+		report.OverShort = &overShort
+	}
+
+	return report, nil
+}
+
+// writeShiftReport answers with JSON or, for ?format=escpos, the raw print job as a download
+func writeShiftReport(c *gin.Context, report ShiftReport, reprint bool) {
+	switch c.DefaultQuery("format", "json") {
+	case "json":
+		c.JSON(http.StatusOK, report)
+	case "escpos":
+		fileName := fmt.Sprintf("x_report_shift_%d.bin", report.ShiftID)
+		if report.Kind == "Z" {
+			fileName = fmt.Sprintf("z_report_%06d.bin", report.ZNumber)
+		}
+		c.Header("Content-Disposition", "attachment; filename="+fileName)
+		c.Data(http.StatusOK, "application/octet-stream", renderShiftReportESCPOS(report, reprint))
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json or escpos"})
+	}
+}
+
+// printShiftReport sends the report to the receipt printer (RECEIPT_PRINTER in .env)
+func printShiftReport(c *gin.Context, report ShiftReport, reprint bool) {
+	printerName := os.Getenv("RECEIPT_PRINTER")
+	if printerName == "" {
+		printerName = "POSPrinter" // Default fallback if .env is missing
+	}
+
+	if err := sendRawToPrinter(printerName, renderShiftReportESCPOS(report, reprint), "shift_report.bin"); err != nil {
+		log.Printf("❌ Error printing %s-report: %v", report.Kind, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to communicate with printer driver"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": report.Kind + "-report sent to printer"})
+}
+
+// renderShiftReportESCPOS lays the report out for an 80 mm (42 column) receipt printer
+func renderShiftReportESCPOS(r ShiftReport, reprint bool) []byte {
+	const width = 42
+	money := func(v float64) string { return fmt.Sprintf("%.2f", v) }
+	row := func(label, value string) string {
+		gap := width - len([]rune(label)) - len([]rune(value))
+		if gap < 1 {
+			gap = 1
+		}
+		return label + strings.Repeat(" ", gap) + value
+	}
+	rule := strings.Repeat("-", width)
+
+	job := utils.NewESCPOSBuilder()
+	job.Align(1).Bold(true).Size(2, 2)
+	if r.Kind == "Z" {
+		job.Line(fmt.Sprintf("Z-REPORT #%06d", r.ZNumber))
+	} else {
+		job.Line("X-REPORT")
+	}
+	job.Size(1, 1).Bold(false)
+	if r.Kind == "X" {
+		job.Line("Mid-shift reading - not a closing")
+	}
+	if reprint {
+		job.Bold(true).Line("*** REPRINT ***").Bold(false)
+	}
+
+	job.Align(0).Line(rule)
+	job.Line(row("Shift", fmt.Sprintf("#%d", r.ShiftID)))
+	job.Line(row("Opened", r.OpenedAt.Format("02/01/2006 15:04")+" "+r.OpenedBy))
+	if r.ClosedAt != nil {
+		job.Line(row("Closed", r.ClosedAt.Format("02/01/2006 15:04")+" "+r.ClosedBy))
+	}
+	job.Line(row("Printed", r.GeneratedAt.Format("02/01/2006 15:04")+" "+r.GeneratedBy))
+
+	job.Line(rule).Bold(true).Line("SALES BY TENDER").Bold(false)
+	for _, t := range r.Tenders {
+		job.Line(row(fmt.Sprintf("%s (%d)", strings.ToUpper(t.Method), t.Count), money(t.Amount)))
+	}
+	job.Bold(true).Line(row(fmt.Sprintf("GROSS SALES (%d)", r.TransactionCount), money(r.GrossSales))).Bold(false)
+	job.Line(row("Items sold", fmt.Sprintf("%.3f", r.ItemsSold)))
+	job.Line(row("Average sale", money(r.AverageSale)))
+
+	job.Line(rule).Bold(true).Line("TAX").Bold(false)
+	job.Line(row(fmt.Sprintf("Taxable sales (SST %.0f%%)", r.SSTRatePercent), money(r.TaxableSales)))
+	job.Line(row("Non-taxable sales", money(r.NonTaxableSales)))
+	job.Line(row("SST included", money(r.SSTAmount)))
+
+	job.Line(rule).Bold(true).Line("CORRECTIONS").Bold(false)
+	job.Line(row(fmt.Sprintf("Voids (%d)", r.VoidCount), money(r.VoidValue)))
+	job.Line(row("Line voids", fmt.Sprintf("%d", r.LineVoidCount)))
+
+	job.Line(rule).Bold(true).Line("DRAWER").Bold(false)
+	for _, p := range r.Payouts {
+		job.Line(row("Payout "+truncateLabelText(p.Type, 20), "-"+money(p.Amount)))
+	}
+	job.Line(row("Payouts total", money(r.PayoutTotal)))
+	job.Line(row("No-sale opens", fmt.Sprintf("%d (%d cancelled)", r.DrawerOpenCount, r.DrawerOpenCancel)))
+
+	job.Line(rule).Bold(true).Line("CASH").Bold(false)
+	job.Line(row("Opening float", money(r.OpeningCash)))
+	job.Line(row("Cash sales", money(r.CashSales)))
+	job.Line(row("Payouts", "-"+money(r.PayoutTotal)))
+	job.Bold(true).Line(row("Expected in drawer", money(r.ExpectedCash))).Bold(false)
+	if r.CountedCash != nil && r.OverShort != nil {
+		job.Line(row("Counted", money(*r.CountedCash)))
+		job.Bold(true).Line(row("OVER / SHORT", fmt.Sprintf("%+.2f", *r.OverShort))).Bold(false)
+	}
+
+	job.Line(rule).Feed(3).Cut()
+	return job.Bytes()
+}
+
+// loadZReport fetches a Z-report by number and re-checks its hash and its link to the report before it
+func loadZReport(number string) (*ZReportView, error) {
+	var zReport models.ZReport
+	if err := database.DB.Where("z_number = ?", number).First(&zReport).Error; err != nil {
+		return nil, err
+	}
+
+	view := &ZReportView{ZReport: zReport}
+	if err := json.Unmarshal([]byte(zReport.Payload), &view.Report); err != nil {
+		return nil, err
+	}
+	view.Verified = zReportHash(zReport.PreviousHash, zReport.Payload) == zReport.PayloadHash
+
+	// The first report starts the chain; every later one must point at the hash of Z number - 1
+	if zReport.ZNumber <= 1 {
+		view.Chained = zReport.PreviousHash == ""
+		return view, nil
+	}
+	var previous models.ZReport
+	err := database.DB.Where("z_number = ?", zReport.ZNumber-1).First(&previous).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	view.Chained = err == nil && previous.PayloadHash == zReport.PreviousHash
+	return view, nil
+}
+
+// zReportHash chains each report to the one before it
+func zReportHash(previousHash string, payload string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(previousHash+payload)))
+}
+
+// currentUsername looks up the logged-in user's name for report footers
+func currentUsername(c *gin.Context) string {
+	userID, exists := c.Get("userID")
+	if !exists {
+		return "Unknown Staff"
+	}
+	var user models.User
+	if err := database.DB.Select("username").First(&user, userID).Error; err != nil {
+		return "Unknown Staff"
+	}
+	return user.Username
+}
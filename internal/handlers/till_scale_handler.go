@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"go-pos-agent/internal/scale"
+
+	"github.com/gin-gonic/gin"
+)
+
+// tillScale is the weighing scale attached to the checkout (nil when none is configured)
+var tillScale *scale.TillScale
+
+// StartTillScale starts reading the checkout scale configured in .env:
+//
+//	TILL_SCALE_PORT=COM3            (or /dev/ttyUSB0, or tcp://192.168.1.50:4001)
+//	TILL_SCALE_PROTOCOL=cas         (cas or toledo)
+//	TILL_SCALE_BAUD=9600
+func StartTillScale() {
+	port := os.Getenv("TILL_SCALE_PORT")
+	if port == "" {
+		return // No scale at this till; weighables are sold from scale labels only
+	}
+
+	baud, _ := strconv.Atoi(os.Getenv("TILL_SCALE_BAUD"))
+	reader, err := scale.NewTillScale(port, os.Getenv("TILL_SCALE_PROTOCOL"), baud)
+	if err != nil {
+		log.Printf("❌ TILL SCALE: %v", err)
+		return
+	}
+
+	tillScale = reader
+	tillScale.Start()
+}
+
+// --- GET: /api/till-scale/weight?wait_stable=true ---
+// GetLiveWeight returns the current net weight. With wait_stable=true it holds the request
+// for up to 3 seconds until the reading settles, so the till can add the item in one call.
+func GetLiveWeight(c *gin.Context) {
+	if tillScale == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "No weighing scale is configured at this till"})
+		return
+	}
+
+	if c.Query("wait_stable") == "true" {
+		c.JSON(http.StatusOK, tillScale.WaitStable(3*time.Second))
+		return
+	}
+	c.JSON(http.StatusOK, tillScale.Current())
+}
+
+// --- POST: /api/till-scale/tare ---
+// TareTillScale stores the weight currently on the plate (bag, tray) as the tare
+func TareTillScale(c *gin.Context) {
+	if tillScale == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "No weighing scale is configured at this till"})
+		return
+	}
+
+	live, err := tillScale.Tare()
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "weight": live})
+		return
+	}
+	c.JSON(http.StatusOK, live)
+}
+
+// --- DELETE: /api/till-scale/tare ---
+// ClearTillScaleTare goes back to gross weighing
+func ClearTillScaleTare(c *gin.Context) {
+	if tillScale == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "No weighing scale is configured at this till"})
+		return
+	}
+	c.JSON(http.StatusOK, tillScale.ClearTare())
+}
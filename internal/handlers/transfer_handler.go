@@ -0,0 +1,410 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go-pos-agent/internal/database"
+	"go-pos-agent/internal/models"
+	"go-pos-agent/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// errBadTransfer marks errors caused by the request (wrong status, bad quantities) rather than the server
+var errBadTransfer = errors.New("invalid transfer")
+
+// errTransferNotFound is returned when the :id doesn't exist
+var errTransferNotFound = errors.New("transfer not found")
+
+// StockTransferRequest defines a new transfer between two locations
+type StockTransferRequest struct {
+	FromLocationID uint   `json:"from_location_id" binding:"required"`
+	ToLocationID   uint   `json:"to_location_id" binding:"required"`
+	Notes          string `json:"notes"`
+	Items          []struct {
+		ProductID uint    `json:"product_id"`
+		Quantity  float64 `json:"quantity"`
+	} `json:"items" binding:"required"`
+}
+
+// ReceiveTransferRequest lists what actually arrived. Lines left out are taken as received in full.
+type ReceiveTransferRequest struct {
+	Items []struct {
+		ProductID        uint    `json:"product_id"`
+		ReceivedQuantity float64 `json:"received_quantity"`
+	} `json:"items"`
+}
+
+// --- GET: /api/transfers?status=in_transit&location_id=2 ---
+// GetStockTransfers lists transfers (newest first), optionally by status or a location on either end
+func GetStockTransfers(c *gin.Context) {
+	query := database.DB.Preload("Items").Order("id desc")
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if locationID := c.Query("location_id"); locationID != "" {
+		query = query.Where("from_location_id = ? OR to_location_id = ?", locationID, locationID)
+	}
+
+	var transfers []models.StockTransfer
+	if err := query.Limit(200).Find(&transfers).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch transfers"})
+		return
+	}
+	c.JSON(http.StatusOK, transfers)
+}
+
+// --- GET: /api/transfers/:id ---
+// GetStockTransfer shows one transfer with its lines
+func GetStockTransfer(c *gin.Context) {
+	var transfer models.StockTransfer
+	if err := database.DB.Preload("Items").First(&transfer, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Transfer not found"})
+		return
+	}
+	c.JSON(http.StatusOK, transfer)
+}
+
+// --- POST: /api/transfers ---
+// CreateStockTransfer saves a draft transfer. Nothing moves until it is dispatched.
+func CreateStockTransfer(c *gin.Context) {
+	var req StockTransferRequest
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.Items) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "From and to locations and at least one item are required"})
+		return
+	}
+
+	// 1. Validate both ends
+	if req.FromLocationID == req.ToLocationID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Pick two different locations"})
+		return
+	}
+	var count int64
+	database.DB.Model(&models.Location{}).Where("id IN ? AND is_active = ?", []uint{req.FromLocationID, req.ToLocationID}, true).Count(&count)
+	if count != 2 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Both locations must exist and be active"})
+		return
+	}
+
+	// 2. Validate the lines (one line per product, positive quantities)
+	transfer := models.StockTransfer{
+		FromLocationID: req.FromLocationID,
+		ToLocationID:   req.ToLocationID,
+		Status:         "draft",
+		Notes:          req.Notes,
+		CreatedBy:      c.MustGet("userID").(uint),
+	}
+	seen := map[uint]bool{}
+	for _, item := range req.Items {
+		if item.Quantity <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Quantity for product #%d must be greater than zero", item.ProductID)})
+			return
+		}
+		if seen[item.ProductID] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Product #%d is listed twice", item.ProductID)})
+			return
+		}
+		seen[item.ProductID] = true
+
+		var product models.Product
+		if err := database.DB.Where("is_archived = ?", false).First(&product, item.ProductID).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Product #%d not found", item.ProductID)})
+			return
+		}
+		transfer.Items = append(transfer.Items, models.StockTransferItem{ProductID: item.ProductID, Quantity: item.Quantity})
+	}
+
+	// 3. Save, then number it from its ID
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&transfer).Error; err != nil {
+			return err
+		}
+		transfer.TransferNumber = fmt.Sprintf("TRF-%06d", transfer.ID)
+		return tx.Model(&transfer).Update("transfer_number", transfer.TransferNumber).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save transfer"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, transfer)
+}
+
+// --- POST: /api/transfers/:id/dispatch ---
+// DispatchStockTransfer takes the goods out of the source location and into the transfer's own
+// transit location. Until receipt they are on neither end's shelf, but still part of the total stock.
+func DispatchStockTransfer(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	var transfer models.StockTransfer
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if _, err := claimTransfer(tx, c.Param("id"), "in_transit", map[string]interface{}{"dispatched_by": userID, "dispatched_at": &now}, &transfer, "draft"); err != nil {
+			return err
+		}
+		transfer.DispatchedBy = userID
+		transfer.DispatchedAt = &now
+		toName := locationName(tx, transfer.ToLocationID)
+
+		// 1. A virtual location for this transfer's goods on the road
+		transit := models.Location{Name: "In transit: " + transfer.TransferNumber, IsTransit: true}
+		if err := tx.Create(&transit).Error; err != nil {
+			return err
+		}
+		transfer.TransitLocationID = transit.ID
+		if err := tx.Model(&transfer).Update("transit_location_id", transit.ID).Error; err != nil {
+			return err
+		}
+
+		// 2. Each line leaves the source and goes on the road
+		for _, item := range transfer.Items {
+			if err := postTransferMovement(tx, transfer, item.ProductID, -item.Quantity, "Transfer Out: to "+toName, transfer.FromLocationID, userID); err != nil {
+				return err
+			}
+			if err := postTransferMovement(tx, transfer, item.ProductID, item.Quantity, "In Transit: to "+toName, transit.ID, userID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(transferErrorStatus(err), gin.H{"error": "Failed to dispatch transfer: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Transfer dispatched", "transfer": transfer})
+}
+
+// --- POST: /api/transfers/:id/receive ---
+// ReceiveStockTransfer books what arrived into the destination. A short delivery is written off
+// out of the transit location (reason TRANSIT_LOSS), so it shows up in the shrinkage report.
+func ReceiveStockTransfer(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	var req ReceiveTransferRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid receipt"})
+			return
+		}
+	}
+	received := map[uint]float64{}
+	for _, item := range req.Items {
+		received[item.ProductID] = item.ReceivedQuantity
+	}
+
+	var transfer models.StockTransfer
+	var shortages []string
+	var writeOffs []models.StockAdjustment
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if _, err := claimTransfer(tx, c.Param("id"), "received", map[string]interface{}{"received_by": userID, "received_at": &now}, &transfer, "in_transit"); err != nil {
+			return err
+		}
+		transfer.ReceivedBy = userID
+		transfer.ReceivedAt = &now
+		fromName := locationName(tx, transfer.FromLocationID)
+		toName := locationName(tx, transfer.ToLocationID)
+
+		for i := range transfer.Items {
+			item := &transfer.Items[i]
+			qty, listed := received[item.ProductID]
+			if !listed {
+				qty = item.Quantity
+			}
+			if qty < 0 || qty > item.Quantity {
+				return fmt.Errorf("%w: received quantity for product #%d must be between 0 and %.3f", errBadTransfer, item.ProductID, item.Quantity)
+			}
+
+			// 1. What arrived comes off the road and onto the destination's shelf
+			if qty > 0 {
+				if transfer.TransitLocationID != 0 {
+					if err := postTransferMovement(tx, transfer, item.ProductID, -qty, "Arrived: at "+toName, transfer.TransitLocationID, userID); err != nil {
+						return err
+					}
+				}
+				if err := postTransferMovement(tx, transfer, item.ProductID, qty, "Transfer In: from "+fromName, transfer.ToLocationID, userID); err != nil {
+					return err
+				}
+			}
+
+			// 2. What didn't is written off
+			if qty < item.Quantity {
+				writeOff, err := writeOffTransitLoss(tx, transfer, item.ProductID, item.Quantity-qty, userID, now)
+				if err != nil {
+					return err
+				}
+				writeOffs = append(writeOffs, writeOff)
+				shortages = append(shortages, fmt.Sprintf("product #%d short %.3f", item.ProductID, item.Quantity-qty))
+			}
+
+			item.ReceivedQuantity = &qty
+			if err := tx.Model(item).Update("received_quantity", qty).Error; err != nil {
+				return err
+			}
+		}
+
+		if len(shortages) == 0 {
+			return nil
+		}
+		return tx.Create(&models.AuditLog{
+			UserID:    userID,
+			Action:    "TRANSFER_SHORTAGE",
+			Details:   fmt.Sprintf("%s received short: %v", transfer.TransferNumber, shortages),
+			Timestamp: now,
+		}).Error
+	})
+	if err != nil {
+		c.JSON(transferErrorStatus(err), gin.H{"error": "Failed to receive transfer: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Transfer received", "transfer": transfer, "shortages": shortages, "write_offs": writeOffs})
+}
+
+// --- POST: /api/transfers/:id/cancel ---
+// CancelStockTransfer drops a draft, or calls back a transfer in transit (its stock returns to the source)
+func CancelStockTransfer(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	var transfer models.StockTransfer
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		previous, err := claimTransfer(tx, c.Param("id"), "cancelled", nil, &transfer, "draft", "in_transit")
+		if err != nil {
+			if errors.Is(err, errBadTransfer) && previous != "" && previous != "draft" && previous != "in_transit" {
+				return fmt.Errorf("%w: a %s transfer cannot be cancelled", errBadTransfer, previous)
+			}
+			return err
+		}
+
+		// A draft never moved stock; a transfer in transit sends its goods back to the source
+		if previous == "in_transit" {
+			for _, item := range transfer.Items {
+				if transfer.TransitLocationID != 0 {
+					if err := postTransferMovement(tx, transfer, item.ProductID, -item.Quantity, "Transfer Cancelled", transfer.TransitLocationID, userID); err != nil {
+						return err
+					}
+				}
+				if err := postTransferMovement(tx, transfer, item.ProductID, item.Quantity, "Transfer Cancelled", transfer.FromLocationID, userID); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(transferErrorStatus(err), gin.H{"error": "Failed to cancel transfer: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Transfer cancelled", "transfer": transfer})
+}
+
+// postTransferMovement moves one line's stock in or out of a location, filed under the transfer number
+func postTransferMovement(tx *gorm.DB, transfer models.StockTransfer, productID uint, change float64, reason string, locationID uint, userID uint) error {
+	_, err := services.ApplyMovement(tx, services.StockMovement{
+		ProductID:      productID,
+		Change:         change,
+		Reason:         reason,
+		UserID:         userID,
+		SourceDocument: transfer.TransferNumber,
+		LocationID:     locationID,
+	})
+	return err
+}
+
+// writeOffTransitLoss books units that never arrived as an approved TRANSIT_LOSS write-off at today's cost
+// and takes them out of the transit location. Transfers dispatched before transit locations existed
+// already dropped these units at dispatch, so for those only the write-off is recorded.
+func writeOffTransitLoss(tx *gorm.DB, transfer models.StockTransfer, productID uint, quantity float64, userID uint, now time.Time) (models.StockAdjustment, error) {
+	var product models.Product
+	if err := tx.Select("id", "cost_price").First(&product, productID).Error; err != nil {
+		return models.StockAdjustment{}, err
+	}
+	writeOff := models.StockAdjustment{
+		ProductID:   productID,
+		Quantity:    quantity,
+		LocationID:  transfer.TransitLocationID,
+		ReasonCode:  "TRANSIT_LOSS",
+		Notes:       "Short on receipt of " + transfer.TransferNumber,
+		UnitCost:    product.CostPrice,
+		TotalCost:   quantity * product.CostPrice,
+		Status:      "approved",
+		RequestedBy: userID,
+		ApprovedBy:  &userID,
+		ApprovedAt:  &now,
+		CreatedAt:   now,
+	}
+	if err := tx.Create(&writeOff).Error; err != nil {
+		return writeOff, err
+	}
+	if transfer.TransitLocationID == 0 {
+		return writeOff, nil
+	}
+	_, err := services.ApplyMovement(tx, services.StockMovement{
+		ProductID:      productID,
+		Change:         -quantity,
+		Reason:         "Write-Off: " + WriteOffReasons[writeOff.ReasonCode],
+		UserID:         userID,
+		SourceDocument: fmt.Sprintf("ADJ-%d", writeOff.ID),
+		LocationID:     transfer.TransitLocationID,
+	})
+	return writeOff, err
+}
+
+// claimTransfer loads the transfer with its lines and moves it on to the next status, provided it is in one of
+// the expected ones. The status change is a conditional UPDATE (WHERE status = what we read), so when two
+// requests race only one gets the transfer and the other is turned away before it posts any stock movement.
+// Returns the status the transfer had before.
+func claimTransfer(tx *gorm.DB, id string, toStatus string, fields map[string]interface{}, transfer *models.StockTransfer, fromStatuses ...string) (string, error) {
+	if err := tx.Preload("Items").First(transfer, id).Error; err != nil {
+		return "", errTransferNotFound
+	}
+	previous := transfer.Status
+	allowed := false
+	for _, status := range fromStatuses {
+		allowed = allowed || previous == status
+	}
+	if !allowed {
+		return previous, fmt.Errorf("%w: %s is %s", errBadTransfer, transfer.TransferNumber, previous)
+	}
+
+	updates := map[string]interface{}{"status": toStatus}
+	for column, value := range fields {
+		updates[column] = value
+	}
+	result := tx.Model(&models.StockTransfer{}).Where("id = ? AND status = ?", transfer.ID, previous).Updates(updates)
+	if result.Error != nil {
+		return previous, result.Error
+	}
+	if result.RowsAffected != 1 {
+		return previous, fmt.Errorf("%w: %s was changed by someone else, reload it", errBadTransfer, transfer.TransferNumber)
+	}
+	transfer.Status = toStatus
+	return previous, nil
+}
+
+// transferErrorStatus maps transfer and inventory errors onto HTTP status codes
+func transferErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errTransferNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errBadTransfer):
+		return http.StatusConflict
+	default:
+		return stockErrorStatus(err)
+	}
+}
+
+// locationName is used in ledger reasons ("Transfer Out: to Branch 2")
+func locationName(tx *gorm.DB, id uint) string {
+	var location models.Location
+	if err := tx.First(&location, id).Error; err != nil {
+		return fmt.Sprintf("location #%d", id)
+	}
+	return location.Name
+}
@@ -14,7 +14,7 @@ import (
 func GetUsers(c *gin.Context) {
 	var users []models.User
 	// Only select safe fields to send to the frontend
-	if err := database.DB.Select("id, username, role, created_at").Find(&users).Error; err != nil {
+	if err := database.DB.Select("id, username, role, location_id, created_at").Find(&users).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
 		return
 	}
@@ -23,9 +23,10 @@ func GetUsers(c *gin.Context) {
 
 // CreateUserRequest defines the payload for creating a user
 type CreateUserRequest struct {
-	Username string `json:"username" binding:"required"`
-	Password string `json:"password" binding:"required"`
-	Role     string `json:"role" binding:"required"`
+	Username   string `json:"username" binding:"required"`
+	Password   string `json:"password" binding:"required"`
+	Role       string `json:"role" binding:"required"`
+	LocationID *uint  `json:"location_id"` // Branch they sell at (omit for the default location)
 }
 
 // CreateUser adds a new user to the system via the Admin Dashboard
@@ -36,6 +37,13 @@ func CreateUser(c *gin.Context) {
 		return
 	}
 
+	if input.LocationID != nil {
+		if _, err := activeLocationID(database.DB, *input.LocationID); err != nil || *input.LocationID == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown or inactive location"})
+			return
+		}
+	}
+
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
@@ -46,6 +54,7 @@ func CreateUser(c *gin.Context) {
 		Username:     input.Username,
 		PasswordHash: string(hashedPassword),
 		Role:         input.Role,
+		LocationID:   input.LocationID,
 	}
 
 	if err := database.DB.Create(&user).Error; err != nil {
@@ -58,8 +67,9 @@ func CreateUser(c *gin.Context) {
 
 // UpdateUserRequest defines the payload for updating a user
 type UpdateUserRequest struct {
-	Role     string `json:"role"`
-	Password string `json:"password"` // Optional: only update if provided
+	Role       string `json:"role"`
+	Password   string `json:"password"`    // Optional: only update if provided
+	LocationID *uint  `json:"location_id"` // Optional: 0 moves them back to the default location
 }
 
 // UpdateUser changes a user's role or password
@@ -88,6 +98,16 @@ func UpdateUser(c *gin.Context) {
 	if input.Role != "" {
 		user.Role = input.Role
 	}
+	if input.LocationID != nil {
+		if *input.LocationID == 0 {
+			user.LocationID = nil
+		} else if _, err := activeLocationID(database.DB, *input.LocationID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown or inactive location"})
+			return
+		} else {
+			user.LocationID = input.LocationID
+		}
+	}
 	if input.Password != "" {
 		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
 		if err != nil {
@@ -10,6 +10,7 @@ type User struct {
 	Username     string    `gorm:"uniqueIndex;size:50" json:"username"`
 	PasswordHash string    `json:"-"`
 	Role         string    `json:"role"`
+	LocationID   *uint     `json:"location_id"` // Branch this person sells at (nil = the default location)
 	CreatedAt    time.Time `json:"created_at"`
 }
 
@@ -20,17 +21,31 @@ type Product struct {
 	Name            string  `json:"name"`
 	Price           float64 `json:"price"`
 	CostPrice       float64 `json:"cost_price"`
-	Category        string  `json:"category"`
+	Category        string  `json:"category"` // Display copy of the category name (kept in sync with CategoryID)
+	CategoryID      *uint   `gorm:"index" json:"category_id"`
 	StockQuantity   float64 `json:"stock_quantity"`
 	StockReserved   float64 `json:"stock_reserved"`
 	IsSSTApplicable bool    `json:"is_sst_applicable"`
 	IsWeighable     bool    `json:"is_weighable"`
 
+	// --- NEW: Scale PLU Fields (sent to the label scales for weighables) ---
+	ScaleDepartment int     `json:"scale_department"` // Department number on the scale (new products default to 21)
+	ShelfLifeDays   int     `json:"shelf_life_days"`  // Printed as the sell-by date on the scale label (default 15)
+	TareWeight      float64 `json:"tare_weight"`      // kg of packaging the scale subtracts
+	ScalePLU        int     `json:"scale_plu"`        // PLU number on the scales when the SKU isn't a number (allocated once, never shifts)
+	// ---------------------------------------
+
 	// --- NEW: Gas Cylinder Engine Fields ---
 	IsGas              bool    `json:"is_gas"`               // Flag to trigger the "Empty Exchange" UI prompt
 	EmptyCylinderStock float64 `json:"empty_cylinder_stock"` // Tracks physical empty tanks returned by customers
 	// ---------------------------------------
 
+	// --- NEW: Archive (Soft Delete) Fields ---
+	IsArchived   bool       `gorm:"default:false;index" json:"is_archived"` // Hidden from the till and product list, kept for historical reports
+	ArchivedAt   *time.Time `json:"archived_at"`
+	MergedIntoID *uint      `json:"merged_into_id"` // Set when this product was a duplicate folded into another one
+	// ---------------------------------------
+
 	ImageURL  string    `json:"image_url"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
@@ -45,6 +60,14 @@ type StockLedger struct {
 	Balance      float64   `json:"balance"`       // UPGRADED: Float64
 	Reason       string    `json:"reason"`
 	CreatedAt    time.Time `json:"created_at"`
+
+	// --- NEW: Who moved the stock and why (receipt ID, adjustment number, import...) ---
+	UserID         uint   `gorm:"index" json:"user_id"` // 0 = system / AI agent
+	SourceDocument string `gorm:"size:100" json:"source_document"`
+
+	// --- NEW: Where the stock moved (Balance stays the all-locations total) ---
+	LocationID      uint    `gorm:"index" json:"location_id"`
+	LocationBalance float64 `json:"location_balance"` // Balance at this location after the movement
 }
 
 // ComboComponent - Required for Task 3.3 (Bundle Engine)
@@ -60,9 +83,12 @@ type Sale struct {
 	ID               uint       `gorm:"primaryKey" json:"id"`
 	ReceiptID        string     `gorm:"uniqueIndex;size:50" json:"receipt_id"`
 	UserID           uint       `json:"user_id"`
-	TotalAmount      float64    `json:"total_amount"`
-	PaymentMethod    string     `json:"payment_method"`  // <-- NEW: Tracks Cash, QR, or Card
-	AmountTendered   float64    `json:"amount_tendered"` // <-- NEW: Tracks what the customer actually handed over
+	TotalAmount      float64    `json:"total_amount"`             // What the receipt charged: line total - Discount + Rounding
+	Discount         float64    `json:"discount"`                 // Cart discount given at the till
+	Rounding         float64    `json:"rounding"`                 // Cash rounding to the nearest 5 sen: gained (+) or given away (-)
+	PaymentMethod    string     `json:"payment_method"`           // <-- NEW: Tracks Cash, QR, or Card
+	AmountTendered   float64    `json:"amount_tendered"`          // <-- NEW: Tracks what the customer actually handed over
+	LocationID       uint       `gorm:"index" json:"location_id"` // Branch the stock left from (0 on sales from before branches: the default)
 	Status           string     `json:"status"`
 	SaleTime         time.Time  `json:"sale_time"`
 	LHDNValidationID string     `json:"lhdn_validation_id"`
@@ -178,6 +204,28 @@ type ShiftLog struct {
 type StoreSettings struct {
 	ID                  uint `gorm:"primaryKey" json:"id"`
 	EnableShiftTracking bool `json:"enable_shift_tracking"` // If false, the POS ignores all shift locks
+
+	// --- NEW: Shrinkage Controls ---
+	WriteOffApprovalThreshold float64 `gorm:"default:50" json:"write_off_approval_threshold"` // Write-offs above this cost value (RM) need a supervisor
+
+	// --- NEW: Inventory Controls ---
+	NegativeStockPolicy string `gorm:"default:'block';size:10" json:"negative_stock_policy"` // "block", "allow" or "warn"
+
+	// --- NEW: In-Store Barcodes (GS1 restricted range, never 20/21 which the scales use) ---
+	InternalBarcodePrefix  string `gorm:"default:'29';size:2" json:"internal_barcode_prefix"`
+	InternalBarcodeCounter uint64 `gorm:"default:0" json:"internal_barcode_counter"` // Last number handed out
+
+	// --- NEW: Shift Reports ---
+	SSTRatePercent float64 `gorm:"default:10" json:"sst_rate_percent"` // Sales tax included in the prices of SST items
+	ZReportCounter uint64  `gorm:"default:0" json:"z_report_counter"`  // Last Z number issued; never goes back
+
+	// --- NEW: Report Header (printed at the top of every PDF report) ---
+	StoreName      string `gorm:"default:'Nine POS';size:100" json:"store_name"`
+	StoreAddress   string `gorm:"size:255" json:"store_address"`
+	StoreTaxNumber string `gorm:"size:50" json:"store_tax_number"` // SST registration number
+
+	// --- NEW: Daily Sales Summaries ---
+	SummariesBackfilledThrough string `gorm:"size:10" json:"summaries_backfilled_through"` // Last day (YYYY-MM-DD) every earlier day has been built up to
 }
 
 // DrawerActivityLog - Tracks non-sale, manual openings of the physical cash drawer for security audits
@@ -190,3 +238,230 @@ type DrawerActivityLog struct {
 	Timestamp        time.Time `json:"timestamp"`          // The exact moment the drawer kicked
 	SecurityVideoURL string    `json:"security_video_url"` // Links the camera footage to the audit
 }
+
+// StockAdjustment - A stock write-off (spoilage, breakage, theft, staff use) with its reason code and approval trail
+type StockAdjustment struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	ProductID   uint       `gorm:"index" json:"product_id"`
+	Product     Product    `json:"product"`
+	Quantity    float64    `json:"quantity"`                         // Always positive: the amount leaving the shelf
+	LocationID  uint       `gorm:"index" json:"location_id"`         // Where the stock is written off (0 on older write-offs: the default location)
+	ReasonCode  string     `gorm:"index;size:30" json:"reason_code"` // e.g., "SPOILAGE", "BREAKAGE", "THEFT"
+	Notes       string     `json:"notes"`
+	PhotoURL    string     `json:"photo_url"`                   // Optional evidence (rotten crate, broken bottle)
+	UnitCost    float64    `json:"unit_cost"`                   // Cost price frozen at the time of the write-off
+	TotalCost   float64    `json:"total_cost"`                  // Quantity * UnitCost, used for the shrinkage report
+	Status      string     `gorm:"index;size:20" json:"status"` // "pending", "approved" or "rejected"
+	RequestedBy uint       `json:"requested_by"`
+	ApprovedBy  *uint      `json:"approved_by"`
+	ApprovedAt  *time.Time `json:"approved_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// PriceHistory - One row per selling/cost price change so "what did X cost last month" can be answered
+type PriceHistory struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	ProductID    uint      `gorm:"index" json:"product_id"`
+	OldPrice     float64   `json:"old_price"`
+	NewPrice     float64   `json:"new_price"`
+	OldCostPrice float64   `json:"old_cost_price"`
+	NewCostPrice float64   `json:"new_cost_price"`
+	Source       string    `json:"source"`  // Where the change came from: "API", "AI Agent", "Scheduled", "Import"
+	UserID       uint      `json:"user_id"` // 0 when the system made the change (e.g., the scheduler)
+	ChangedAt    time.Time `gorm:"index" json:"changed_at"`
+}
+
+// ScheduledPriceChange - A future-dated price (e.g., Friday promotion) applied by the background scheduler
+type ScheduledPriceChange struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	ProductID   uint       `gorm:"index" json:"product_id"`
+	Product     Product    `json:"product"`
+	NewPrice    float64    `json:"new_price"`
+	EffectiveAt time.Time  `gorm:"index" json:"effective_at"`
+	Status      string     `gorm:"index;size:20" json:"status"` // "pending", "applied" or "cancelled"
+	Note        string     `json:"note"`
+	CreatedBy   uint       `json:"created_by"`
+	AppliedAt   *time.Time `json:"applied_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// Category - First-class product category with an optional parent (e.g., "Drinks" > "Soft Drinks")
+type Category struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	Name         string    `gorm:"uniqueIndex;size:100" json:"name"`
+	ParentID     *uint     `gorm:"index" json:"parent_id"` // nil for top-level categories
+	DefaultSST   bool      `json:"default_sst"`            // New products in this category default to SST applicable
+	MarginTarget float64   `json:"margin_target"`          // Target gross margin in percent (e.g., 25 = 25%)
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// ScaleBarcodeFormat - One scale label layout: which prefixes it owns and how the 13 digits are split
+type ScaleBarcodeFormat struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	Name           string    `gorm:"size:100" json:"name"`
+	PrefixFrom     int       `json:"prefix_from"`               // 20-29
+	PrefixTo       int       `json:"prefix_to"`                 // Inclusive, >= prefix_from
+	ItemCodeLength int       `json:"item_code_length"`          // Digits identifying the product (usually 5)
+	ValueType      string    `gorm:"size:10" json:"value_type"` // "price" (RM) or "weight" (kg)
+	Decimals       int       `json:"decimals"`                  // Implied decimal places in the value
+	IsActive       bool      `json:"is_active"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// LabelScale - A networked label scale that receives its PLUs directly from the server
+type LabelScale struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	Name           string     `gorm:"size:100" json:"name"`                // e.g. "Deli Counter"
+	Host           string     `gorm:"size:100" json:"host"`                // IP or hostname on the shop LAN
+	Port           int        `json:"port"`                                // PLU protocol port (CAS CL: 20304)
+	Protocol       string     `gorm:"size:20;default:cas" json:"protocol"` // Network PLU protocol, see scale.NetworkFormats ("cas")
+	IsActive       bool       `json:"is_active"`                           // Inactive scales are never synced
+	AutoSync       bool       `json:"auto_sync"`                           // Opted in to automatic pushes after edits; otherwise only synced by hand
+	LastSyncAt     *time.Time `json:"last_sync_at"`
+	LastSyncStatus string     `gorm:"size:20" json:"last_sync_status"` // "ok", "partial" or "failed"
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// ScalePLUState - What we last successfully sent to a scale for one item, so only changes are re-sent
+type ScalePLUState struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	ScaleID    uint      `gorm:"uniqueIndex:idx_scale_plu" json:"scale_id"`
+	ItemCode   string    `gorm:"size:20;uniqueIndex:idx_scale_plu" json:"item_code"`
+	Hotkey     int       `json:"hotkey"` // Where the PLU sits on the scale, so it can be deleted there
+	Department int       `json:"department"`
+	Hash       string    `gorm:"size:64" json:"hash"` // Fingerprint of the PLU record the scale acknowledged
+	SyncedAt   time.Time `json:"synced_at"`
+}
+
+// ScaleSyncLog - One sync run against one scale
+type ScaleSyncLog struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	ScaleID    uint      `gorm:"index" json:"scale_id"`
+	Trigger    string    `gorm:"size:30" json:"trigger"` // "price_update", "manual", "full_resync"
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Sent       int       `json:"sent"`                  // PLUs written (new or changed)
+	Deleted    int       `json:"deleted"`               // PLUs removed (archived or no longer weighable)
+	Unchanged  int       `json:"unchanged"`             // Skipped because the scale already has them
+	Failed     int       `json:"failed"`                // Rejected (NAK) by the scale
+	Status     string    `gorm:"size:20" json:"status"` // "ok", "partial" or "failed"
+	Error      string    `json:"error"`
+}
+
+// Location - A place stock is held: the shop floor, the back store, a branch
+type Location struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Name      string    `gorm:"uniqueIndex;size:100" json:"name"`
+	IsDefault bool      `json:"is_default"` // Till sales and movements without a location use this one
+	IsActive  bool      `json:"is_active"`
+	IsTransit bool      `json:"is_transit"` // Holds one transfer's goods on the road (never listed, sold from or counted)
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// LocationStock - On-hand quantity of one product at one location.
+// Product.StockQuantity is always the sum of these rows (stock in transit sits at the transfer's transit location).
+type LocationStock struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	LocationID uint      `gorm:"uniqueIndex:idx_location_product" json:"location_id"`
+	ProductID  uint      `gorm:"uniqueIndex:idx_location_product;index" json:"product_id"`
+	Quantity   float64   `json:"quantity"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// StockTransfer - Moves stock between locations in two steps: dispatch (leaves the source,
+// goes in transit) and receive (arrives at the destination, possibly short)
+type StockTransfer struct {
+	ID                uint                `gorm:"primaryKey" json:"id"`
+	TransferNumber    string              `gorm:"uniqueIndex;size:20" json:"transfer_number"` // e.g. "TRF-000012"
+	FromLocationID    uint                `gorm:"index" json:"from_location_id"`
+	ToLocationID      uint                `gorm:"index" json:"to_location_id"`
+	TransitLocationID uint                `json:"transit_location_id"`         // Set on dispatch: where the goods are held until received (0 on older transfers)
+	Status            string              `gorm:"size:20;index" json:"status"` // "draft", "in_transit", "received", "cancelled"
+	Notes             string              `json:"notes"`
+	CreatedBy         uint                `json:"created_by"`
+	DispatchedBy      uint                `json:"dispatched_by"`
+	DispatchedAt      *time.Time          `json:"dispatched_at"`
+	ReceivedBy        uint                `json:"received_by"`
+	ReceivedAt        *time.Time          `json:"received_at"`
+	CreatedAt         time.Time           `json:"created_at"`
+	UpdatedAt         time.Time           `json:"updated_at"`
+	Items             []StockTransferItem `gorm:"foreignKey:TransferID" json:"items"`
+}
+
+// StockTransferItem - One product line on a transfer
+type StockTransferItem struct {
+	ID               uint     `gorm:"primaryKey" json:"id"`
+	TransferID       uint     `gorm:"index" json:"transfer_id"`
+	ProductID        uint     `json:"product_id"`
+	Quantity         float64  `json:"quantity"`          // Dispatched
+	ReceivedQuantity *float64 `json:"received_quantity"` // Set on receipt; less than Quantity = lost in transit (written off)
+}
+
+// ZReport - The end-of-day report issued when a shift closes. Numbered from a counter that never
+// resets, never edited after creation, and chained by hash so a changed or missing report shows up.
+type ZReport struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	ZNumber      uint64    `gorm:"uniqueIndex" json:"z_number"`
+	ShiftID      uint      `gorm:"uniqueIndex" json:"shift_id"`
+	GeneratedAt  time.Time `json:"generated_at"`
+	GeneratedBy  string    `json:"generated_by"`
+	Payload      string    `gorm:"type:text" json:"-"`           // The report exactly as issued (JSON)
+	PayloadHash  string    `gorm:"size:64" json:"payload_hash"`  // SHA-256 of PreviousHash + Payload
+	PreviousHash string    `gorm:"size:64" json:"previous_hash"` // Hash of Z number - 1 ("" for the first)
+}
+
+// --- Daily Sales Summaries ---
+// Pre-aggregated completed sales, one row per local calendar day (Day = "YYYY-MM-DD") and key.
+// Kept up to date after every checkout and rebuilt from sales/sale_items by a nightly job,
+// so reports only re-aggregate the raw tables for today.
+
+// DailyProductSales - One product's sales on one day, per payment method
+type DailyProductSales struct {
+	ID            uint    `gorm:"primaryKey" json:"id"`
+	Day           string  `gorm:"size:10;uniqueIndex:idx_daily_product" json:"day"`
+	ProductID     uint    `gorm:"uniqueIndex:idx_daily_product" json:"product_id"`
+	PaymentMethod string  `gorm:"size:30;uniqueIndex:idx_daily_product" json:"payment_method"`
+	Quantity      float64 `json:"quantity"`
+	Revenue       float64 `json:"revenue"`     // Quantity x shelf price
+	Cost          float64 `json:"cost"`        // Quantity x cost at the time of sale
+	OrderCount    int64   `json:"order_count"` // Receipts containing the product
+}
+
+// DailyCategorySales - One category's sales on one day (products counted under their category at the last rebuild)
+type DailyCategorySales struct {
+	ID         uint    `gorm:"primaryKey" json:"id"`
+	Day        string  `gorm:"size:10;uniqueIndex:idx_daily_category" json:"day"`
+	CategoryID uint    `gorm:"uniqueIndex:idx_daily_category" json:"category_id"` // 0 = uncategorised
+	Quantity   float64 `json:"quantity"`
+	Revenue    float64 `json:"revenue"`
+	Cost       float64 `json:"cost"`
+	OrderCount int64   `json:"order_count"`
+}
+
+// DailyTenderSales - Takings per payment method on one day
+type DailyTenderSales struct {
+	ID            uint    `gorm:"primaryKey" json:"id"`
+	Day           string  `gorm:"size:10;uniqueIndex:idx_daily_tender" json:"day"`
+	PaymentMethod string  `gorm:"size:30;uniqueIndex:idx_daily_tender" json:"payment_method"`
+	Orders        int64   `json:"orders"`
+	TotalAmount   float64 `json:"total_amount"` // What was collected (after discounts and rounding)
+	Revenue       float64 `json:"revenue"`      // Line totals at shelf price
+	Cost          float64 `json:"cost"`
+	Discounts     float64 `json:"discounts"`
+	Rounding      float64 `json:"rounding"`
+}
+
+// DailyCashierSales - One cashier's sales on one day
+type DailyCashierSales struct {
+	ID      uint    `gorm:"primaryKey" json:"id"`
+	Day     string  `gorm:"size:10;uniqueIndex:idx_daily_cashier" json:"day"`
+	UserID  uint    `gorm:"uniqueIndex:idx_daily_cashier" json:"user_id"`
+	Orders  int64   `json:"orders"`
+	Revenue float64 `json:"revenue"`
+	Cost    float64 `json:"cost"`
+	Items   float64 `json:"items"` // Weighed lines count as one item
+}
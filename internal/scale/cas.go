@@ -0,0 +1,48 @@
+package scale
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+)
+
+// casExporter writes the CSV layout imported by CAS CL-Works for the CL-series label scales.
+// Unit price is in RM with decimals; tare is in grams.
+type casExporter struct{}
+
+var casHeaders = []string{"Dept No.", "PLU No.", "PLU Type", "Name1", "Item Code", "Unit Weight", "Unit Price", "Tare Value", "Sell By Date"}
+
+func (casExporter) Name() string        { return "cas" }
+func (casExporter) FileName() string    { return "cas_plu_export.csv" }
+func (casExporter) ContentType() string { return "text/csv" }
+
+func (casExporter) Write(w io.Writer, records []PLURecord) error {
+	rows := make([][]string, 0, len(records))
+	for _, r := range records {
+		rows = append(rows, []string{
+			strconv.Itoa(r.Department),
+			strconv.Itoa(r.Hotkey),
+			"1", // 1 = weighed item
+			r.Name,
+			r.ItemCode,
+			"kg",
+			fmt.Sprintf("%.2f", r.UnitPrice),
+			strconv.Itoa(int(math.Round(r.Tare * 1000))), // kg -> g
+			strconv.Itoa(r.ShelfLifeDays),
+		})
+	}
+	return writeDelimited(w, ',', casHeaders, rows)
+}
+
+func (casExporter) Read(r io.Reader) ([]PLURecord, error) {
+	col, rows, err := readDelimited(r, ',', []string{"item code", "name1", "unit price"})
+	if err != nil {
+		return nil, fmt.Errorf("CAS file: %v", err)
+	}
+	return readRows(rows, 2, func(cells []string, row int) (PLURecord, error) {
+		get := func(name string) string { return cellAt(cells, col, name) }
+		return buildRecord(row, get("plu no."), get("item code"), get("name1"), get("unit price"), 1,
+			get("dept no."), get("sell by date"), get("tare value"), 1000)
+	})
+}
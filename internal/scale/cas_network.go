@@ -0,0 +1,248 @@
+package scale
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// --- CAS CL-series Ethernet PLU download (CL5000, CL5200, CL5500; TCP port 20304) ---
+// Each request is an ASCII header, a data block and a BCC byte (XOR of the data block):
+//
+//	W02A<PLU no, 5 hex>,<dept, 2 hex>L<data length, 3 hex>:<data><BCC>   write (add or replace) a PLU
+//	C02A<PLU no, 5 hex>,<dept, 2 hex>L000:<BCC>                         delete a PLU
+//	R00A00000,00L000:<BCC>                                              read status (our ping)
+//
+// The data block is a run of fields "F=<field no, 2 hex>.<type><length, 2 hex>:<value>", type S for text
+// and L for whole numbers. The scale answers every request with one line: "O<command>" when it took it,
+// "N<command><error, 2 hex>" when it refused it.
+//
+// Only the fields below are sent; the scale keeps its defaults for the rest (label format, barcode, ...).
+// The field numbers are the ones of the CL5000 PLU table; check them against the interface manual of the
+// scale's firmware before enabling a new model. The tests run this against StandIn, not a real scale.
+
+const (
+	casPort       = 20304
+	casNameLength = 40 // Bytes the scale keeps of Name1
+
+	casFieldPLUType   = 0x04 // 1 = priced by weight
+	casFieldUnitPrice = 0x06 // sen per kg
+	casFieldName1     = 0x0A
+	casFieldItemCode  = 0x0B // Printed into the label barcode
+	casFieldTare      = 0x0D // grams
+	casFieldSellBy    = 0x10 // days
+)
+
+const (
+	casCmdWrite  = "W02A"
+	casCmdDelete = "C02A"
+	casCmdStatus = "R00A"
+)
+
+func (casExporter) DefaultPort() int { return casPort }
+
+// Dial connects to a CL-series scale at host:port
+func (casExporter) Dial(address string, timeout time.Duration) (PLUSession, error) {
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return &casSession{conn: conn, reader: bufio.NewReader(conn), timeout: timeout}, nil
+}
+
+// casSession is one open connection to a CL-series scale
+type casSession struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	timeout time.Duration
+}
+
+func (s *casSession) Ping() error {
+	return s.send(encodeCASRequest(casCmdStatus, 0, 0, nil))
+}
+
+func (s *casSession) WritePLU(r PLURecord) error {
+	if err := checkCASAddress(r); err != nil {
+		return err
+	}
+	return s.send(encodeCASRequest(casCmdWrite, r.Hotkey, r.Department, casPLUData(r)))
+}
+
+func (s *casSession) DeletePLU(r PLURecord) error {
+	if err := checkCASAddress(r); err != nil {
+		return err
+	}
+	return s.send(encodeCASRequest(casCmdDelete, r.Hotkey, r.Department, nil))
+}
+
+func (s *casSession) Close() error {
+	return s.conn.Close()
+}
+
+// send writes one request and waits for the scale's answer line
+func (s *casSession) send(request []byte) error {
+	s.conn.SetDeadline(time.Now().Add(s.timeout))
+	if _, err := s.conn.Write(request); err != nil {
+		return err
+	}
+
+	reply, err := s.reader.ReadString('\n')
+	if err != nil {
+		if err == io.EOF {
+			return fmt.Errorf("scale closed the connection")
+		}
+		return err
+	}
+	reply = strings.TrimRight(reply, "\r\n")
+	command := string(request[:4])
+	switch {
+	case reply == "O"+command:
+		return nil
+	case strings.HasPrefix(reply, "N"+command):
+		return fmt.Errorf("%w (error %s)", ErrNAK, strings.TrimPrefix(reply, "N"+command))
+	}
+	return fmt.Errorf("unexpected reply %q from scale", reply)
+}
+
+// checkCASAddress refuses records the scale has no slot for, before anything is sent
+func checkCASAddress(r PLURecord) error {
+	if r.Hotkey < 1 || r.Hotkey > 0xFFFFF {
+		return fmt.Errorf("%w: PLU number %d is out of range", ErrNAK, r.Hotkey)
+	}
+	if r.Department < 0 || r.Department > 0xFF {
+		return fmt.Errorf("%w: department %d is out of range", ErrNAK, r.Department)
+	}
+	return nil
+}
+
+// encodeCASRequest builds the bytes of one request
+func encodeCASRequest(command string, plu, department int, data []byte) []byte {
+	request := []byte(fmt.Sprintf("%s%05X,%02XL%03X:", command, plu, department, len(data)))
+	request = append(request, data...)
+	return append(request, casBlockCheck(data))
+}
+
+// casBlockCheck is the XOR of the data block
+func casBlockCheck(data []byte) byte {
+	var bcc byte
+	for _, b := range data {
+		bcc ^= b
+	}
+	return bcc
+}
+
+// casPLUData is the data block of a write. Money travels in sen and tare in grams (whole numbers only).
+func casPLUData(r PLURecord) []byte {
+	var data []byte
+	field := func(number int, kind byte, value string) {
+		data = append(data, fmt.Sprintf("F=%02X.%c%02X:", number, kind, len(value))...)
+		data = append(data, value...)
+	}
+	field(casFieldPLUType, 'L', "1")
+	field(casFieldName1, 'S', casText(r.Name, casNameLength))
+	field(casFieldItemCode, 'S', casText(r.ItemCode, 20))
+	field(casFieldUnitPrice, 'L', strconv.Itoa(int(math.Round(r.UnitPrice*100))))
+	field(casFieldTare, 'L', strconv.Itoa(int(math.Round(r.Tare*1000))))
+	field(casFieldSellBy, 'L', strconv.Itoa(r.ShelfLifeDays))
+	return data
+}
+
+// casText drops control bytes and cuts the value to what the scale keeps, without splitting a character
+func casText(value string, max int) string {
+	value = strings.Map(func(r rune) rune {
+		if r < 0x20 {
+			return -1
+		}
+		return r
+	}, value)
+	for len(value) > max {
+		_, size := utf8.DecodeLastRuneInString(value)
+		value = value[:len(value)-size]
+	}
+	return value
+}
+
+// casRequest is one decoded request (the scale side, used by StandIn)
+type casRequest struct {
+	Command    string
+	PLU        int
+	Department int
+	Data       []byte
+}
+
+// readCASRequest reads the next request off the line
+func readCASRequest(r *bufio.Reader) (casRequest, error) {
+	header, err := r.ReadString(':')
+	if err != nil {
+		return casRequest{}, err
+	}
+	if len(header) != len("W02A00000,00L000:") {
+		return casRequest{}, fmt.Errorf("malformed header %q", header)
+	}
+
+	request := casRequest{Command: header[:4]}
+	var length int
+	if _, err := fmt.Sscanf(header[4:], "%05X,%02XL%03X:", &request.PLU, &request.Department, &length); err != nil {
+		return casRequest{}, fmt.Errorf("malformed header %q", header)
+	}
+
+	request.Data = make([]byte, length)
+	if _, err := io.ReadFull(r, request.Data); err != nil {
+		return casRequest{}, err
+	}
+	bcc, err := r.ReadByte()
+	if err != nil {
+		return casRequest{}, err
+	}
+	if bcc != casBlockCheck(request.Data) {
+		return casRequest{}, fmt.Errorf("bad block check on %s", request.Command)
+	}
+	return request, nil
+}
+
+// decodeCASPLU is the inverse of casPLUData (fields we don't know are skipped)
+func decodeCASPLU(request casRequest) (PLURecord, error) {
+	record := PLURecord{Hotkey: request.PLU, Department: request.Department}
+	data := request.Data
+	for len(data) > 0 {
+		var number, length int
+		var kind byte
+		if len(data) < len("F=00.S00:") {
+			return PLURecord{}, fmt.Errorf("truncated field")
+		}
+		if _, err := fmt.Sscanf(string(data[:9]), "F=%02X.%c%02X:", &number, &kind, &length); err != nil || len(data) < 9+length {
+			return PLURecord{}, fmt.Errorf("malformed field %q", data[:9])
+		}
+		value := string(data[9 : 9+length])
+		data = data[9+length:]
+
+		if kind == 'L' {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return PLURecord{}, fmt.Errorf("field %02X %q is not a number", number, value)
+			}
+			switch number {
+			case casFieldUnitPrice:
+				record.UnitPrice = float64(n) / 100
+			case casFieldTare:
+				record.Tare = float64(n) / 1000
+			case casFieldSellBy:
+				record.ShelfLifeDays = n
+			}
+			continue
+		}
+		switch number {
+		case casFieldName1:
+			record.Name = value
+		case casFieldItemCode:
+			record.ItemCode = value
+		}
+	}
+	return record, nil
+}
@@ -0,0 +1,141 @@
+package scale
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startStandIn runs a stand-in scale on a free local port and returns a session to it
+func startStandIn(t *testing.T, standIn *StandIn) PLUSession {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go standIn.Serve(listener)
+
+	protocol, err := GetNetworkExporter("cas")
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := protocol.Dial(listener.Addr().String(), 2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { session.Close() })
+	return session
+}
+
+func TestCASWriteAndDeletePLU(t *testing.T) {
+	standIn := NewStandIn(0)
+	session := startStandIn(t, standIn)
+
+	if err := session.Ping(); err != nil {
+		t.Fatalf("ping: %v", err)
+	}
+
+	chicken := PLURecord{Hotkey: 7, ItemCode: "00007", Name: "Ayam Segar", UnitPrice: 12.9, Department: 3, ShelfLifeDays: 2, Tare: 0.015}
+	if err := session.WritePLU(chicken); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	plus := standIn.PLUs()
+	if len(plus) != 1 || plus[0] != chicken {
+		t.Fatalf("scale holds %+v, want %+v", plus, chicken)
+	}
+
+	// Same PLU number in another department is a different PLU on the scale
+	beef := PLURecord{Hotkey: 7, ItemCode: "10007", Name: "Daging", UnitPrice: 45, Department: 4}
+	if err := session.WritePLU(beef); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := session.DeletePLU(chicken); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if plus := standIn.PLUs(); len(plus) != 1 || plus[0].ItemCode != "10007" {
+		t.Fatalf("after delete scale holds %+v, want only 10007", plus)
+	}
+}
+
+func TestCASRefusedPLUIsNAK(t *testing.T) {
+	standIn := NewStandIn(1, "00008")
+	session := startStandIn(t, standIn)
+
+	err := session.WritePLU(PLURecord{Hotkey: 8, ItemCode: "00008", Name: "Refused", UnitPrice: 1})
+	if !errors.Is(err, ErrNAK) {
+		t.Fatalf("refused item: got %v, want ErrNAK", err)
+	}
+	if err := session.WritePLU(PLURecord{Hotkey: 1, ItemCode: "00001", Name: "First", UnitPrice: 1}); err != nil {
+		t.Fatalf("first write: %v", err)
+	}
+	if err := session.WritePLU(PLURecord{Hotkey: 2, ItemCode: "00002", Name: "Full", UnitPrice: 1}); !errors.Is(err, ErrNAK) {
+		t.Fatalf("write past capacity: got %v, want ErrNAK", err)
+	}
+	// The connection is still usable after a refusal
+	if err := session.Ping(); err != nil {
+		t.Fatalf("ping after NAK: %v", err)
+	}
+}
+
+func TestCASOutOfRangeAddressIsNotSent(t *testing.T) {
+	standIn := NewStandIn(0)
+	session := startStandIn(t, standIn)
+
+	if err := session.WritePLU(PLURecord{Hotkey: 0, ItemCode: "ABC", Name: "No key"}); !errors.Is(err, ErrNAK) {
+		t.Fatalf("PLU 0: got %v, want ErrNAK", err)
+	}
+	if err := session.WritePLU(PLURecord{Hotkey: 1, ItemCode: "ABC", Department: 256}); !errors.Is(err, ErrNAK) {
+		t.Fatalf("department 256: got %v, want ErrNAK", err)
+	}
+	if len(standIn.PLUs()) != 0 {
+		t.Fatalf("nothing should have reached the scale")
+	}
+}
+
+func TestCASNameIsCutWithoutSplittingACharacter(t *testing.T) {
+	standIn := NewStandIn(0)
+	session := startStandIn(t, standIn)
+
+	name := strings.Repeat("é", 30) // 60 bytes
+	if err := session.WritePLU(PLURecord{Hotkey: 1, ItemCode: "00001", Name: name + "\x03"}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	got := standIn.PLUs()[0].Name
+	if got != strings.Repeat("é", 20) {
+		t.Fatalf("name on scale %q, want 20 characters", got)
+	}
+}
+
+func TestCASRequestEncoding(t *testing.T) {
+	request := encodeCASRequest(casCmdWrite, 0x1A2, 0x0F, []byte("F=04.L01:1"))
+	want := "W02A001A2,0FL00A:F=04.L01:1"
+	if string(request[:len(request)-1]) != want {
+		t.Fatalf("header %q, want %q", request[:len(request)-1], want)
+	}
+
+	decoded, err := readCASRequest(bufio.NewReader(strings.NewReader(string(request))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.PLU != 0x1A2 || decoded.Department != 0x0F || string(decoded.Data) != "F=04.L01:1" {
+		t.Fatalf("decoded %+v", decoded)
+	}
+
+	request[len(request)-1] ^= 0xFF
+	if _, err := readCASRequest(bufio.NewReader(strings.NewReader(string(request)))); err == nil {
+		t.Fatal("a bad block check must be refused")
+	}
+}
+
+func TestGetNetworkExporter(t *testing.T) {
+	if _, err := GetNetworkExporter("rongta"); err == nil {
+		t.Fatal("rongta has no network protocol")
+	}
+	if formats := NetworkFormats(); len(formats) != 1 || formats[0] != "cas" {
+		t.Fatalf("network formats %v", formats)
+	}
+}
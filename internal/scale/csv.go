@@ -0,0 +1,89 @@
+package scale
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// genericCSVExporter is a plain, self-describing CSV for scales (or people) without a dedicated format
+type genericCSVExporter struct{}
+
+var genericCSVHeaders = []string{"hotkey", "item_code", "name", "unit_price", "department", "shelf_life_days", "tare_kg"}
+
+func (genericCSVExporter) Name() string        { return "csv" }
+func (genericCSVExporter) FileName() string    { return "scale_plu_export.csv" }
+func (genericCSVExporter) ContentType() string { return "text/csv" }
+
+func (genericCSVExporter) Write(w io.Writer, records []PLURecord) error {
+	rows := make([][]string, 0, len(records))
+	for _, r := range records {
+		rows = append(rows, []string{
+			strconv.Itoa(r.Hotkey),
+			r.ItemCode,
+			r.Name,
+			fmt.Sprintf("%.2f", r.UnitPrice),
+			strconv.Itoa(r.Department),
+			strconv.Itoa(r.ShelfLifeDays),
+			fmt.Sprintf("%.3f", r.Tare),
+		})
+	}
+	return writeDelimited(w, ',', genericCSVHeaders, rows)
+}
+
+func (genericCSVExporter) Read(r io.Reader) ([]PLURecord, error) {
+	col, rows, err := readDelimited(r, ',', []string{"item_code", "name", "unit_price"})
+	if err != nil {
+		return nil, err
+	}
+	return readRows(rows, 2, func(cells []string, row int) (PLURecord, error) {
+		get := func(name string) string { return cellAt(cells, col, name) }
+		return buildRecord(row, get("hotkey"), get("item_code"), get("name"), get("unit_price"), 1,
+			get("department"), get("shelf_life_days"), get("tare_kg"), 1)
+	})
+}
+
+// writeDelimited writes a header row and the data rows with the given separator
+func writeDelimited(w io.Writer, separator rune, headers []string, rows [][]string) error {
+	writer := csv.NewWriter(w)
+	writer.Comma = separator
+	if err := writer.Write(headers); err != nil {
+		return err
+	}
+	if err := writer.WriteAll(rows); err != nil {
+		return err
+	}
+	return writer.Error()
+}
+
+// readDelimited reads a delimited file and maps its (case-insensitive) headers to column indexes
+func readDelimited(r io.Reader, separator rune, required []string) (map[string]int, [][]string, error) {
+	reader := csv.NewReader(r)
+	reader.Comma = separator
+	reader.FieldsPerRecord = -1 // Scale software is loose about trailing columns
+	reader.TrimLeadingSpace = true
+
+	all, err := reader.ReadAll()
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not read file: %v", err)
+	}
+	if len(all) == 0 {
+		return nil, nil, fmt.Errorf("file is empty")
+	}
+
+	col := map[string]int{}
+	for i, h := range all[0] {
+		key := strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\uFEFF"))) // Excel adds a BOM
+		if _, exists := col[key]; !exists {
+			col[key] = i
+		}
+	}
+	for _, name := range required {
+		if _, ok := col[name]; !ok {
+			return nil, nil, fmt.Errorf("missing %q column", name)
+		}
+	}
+	return col, all[1:], nil
+}
@@ -0,0 +1,47 @@
+package scale
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+)
+
+// digiExporter writes the tab-separated PLU master file loaded by DIGI SM-series scales.
+// DIGI keeps money in the smallest unit (sen) and tare in grams.
+type digiExporter struct{}
+
+var digiHeaders = []string{"PLU No", "Item Code", "Commodity Name", "Unit Price", "Price Mode", "Dept No", "Sell By Days", "Tare"}
+
+func (digiExporter) Name() string        { return "digi" }
+func (digiExporter) FileName() string    { return "digi_plu_export.txt" }
+func (digiExporter) ContentType() string { return "text/tab-separated-values" }
+
+func (digiExporter) Write(w io.Writer, records []PLURecord) error {
+	rows := make([][]string, 0, len(records))
+	for _, r := range records {
+		rows = append(rows, []string{
+			strconv.Itoa(r.Hotkey),
+			r.ItemCode,
+			r.Name,
+			strconv.Itoa(int(math.Round(r.UnitPrice * 100))), // RM 12.90 -> 1290
+			"0", // 0 = priced by weight
+			strconv.Itoa(r.Department),
+			strconv.Itoa(r.ShelfLifeDays),
+			strconv.Itoa(int(math.Round(r.Tare * 1000))), // kg -> g
+		})
+	}
+	return writeDelimited(w, '\t', digiHeaders, rows)
+}
+
+func (digiExporter) Read(r io.Reader) ([]PLURecord, error) {
+	col, rows, err := readDelimited(r, '\t', []string{"item code", "commodity name", "unit price"})
+	if err != nil {
+		return nil, fmt.Errorf("DIGI file: %v", err)
+	}
+	return readRows(rows, 2, func(cells []string, row int) (PLURecord, error) {
+		get := func(name string) string { return cellAt(cells, col, name) }
+		return buildRecord(row, get("plu no"), get("item code"), get("commodity name"), get("unit price"), 100,
+			get("dept no"), get("sell by days"), get("tare"), 1000)
+	})
+}
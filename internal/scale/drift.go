@@ -0,0 +1,145 @@
+package scale
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// PLUDrift is one difference between the catalogue and a PLU file read back from a scale
+type PLUDrift struct {
+	ItemCode string      `json:"item_code"`
+	Name     string      `json:"name"`
+	Status   string      `json:"status"` // "changed", "missing_on_scale" or "unknown_product"
+	Changes  []FieldDiff `json:"changes,omitempty"`
+}
+
+// FieldDiff shows what the catalogue says vs what the scale has
+type FieldDiff struct {
+	Field    string      `json:"field"`
+	Expected interface{} `json:"expected"`
+	OnScale  interface{} `json:"on_scale"`
+}
+
+// CompareRecords matches records by item code and lists everything that doesn't agree
+func CompareRecords(expected []PLURecord, onScale []PLURecord) []PLUDrift {
+	scaleByCode := make(map[string]PLURecord, len(onScale))
+	for _, r := range onScale {
+		scaleByCode[r.ItemCode] = r
+	}
+
+	drifts := []PLUDrift{}
+	seen := make(map[string]bool, len(expected))
+
+	for _, want := range expected {
+		seen[want.ItemCode] = true
+		got, ok := scaleByCode[want.ItemCode]
+		if !ok {
+			drifts = append(drifts, PLUDrift{ItemCode: want.ItemCode, Name: want.Name, Status: "missing_on_scale"})
+			continue
+		}
+
+		var changes []FieldDiff
+		if want.Name != got.Name {
+			changes = append(changes, FieldDiff{"name", want.Name, got.Name})
+		}
+		if math.Abs(want.UnitPrice-got.UnitPrice) > 0.005 {
+			changes = append(changes, FieldDiff{"unit_price", want.UnitPrice, got.UnitPrice})
+		}
+		if want.Department != got.Department {
+			changes = append(changes, FieldDiff{"department", want.Department, got.Department})
+		}
+		if want.ShelfLifeDays != got.ShelfLifeDays {
+			changes = append(changes, FieldDiff{"shelf_life_days", want.ShelfLifeDays, got.ShelfLifeDays})
+		}
+		if math.Abs(want.Tare-got.Tare) > 0.0005 {
+			changes = append(changes, FieldDiff{"tare", want.Tare, got.Tare})
+		}
+
+		if len(changes) > 0 {
+			drifts = append(drifts, PLUDrift{ItemCode: want.ItemCode, Name: want.Name, Status: "changed", Changes: changes})
+		}
+	}
+
+	// Items loaded on the scale that the catalogue doesn't know (or no longer sells by weight)
+	for _, got := range onScale {
+		if !seen[got.ItemCode] {
+			drifts = append(drifts, PLUDrift{ItemCode: got.ItemCode, Name: got.Name, Status: "unknown_product"})
+		}
+	}
+
+	return drifts
+}
+
+// parseFloatField and parseIntField read numeric cells, naming the column in the error
+func parseFloatField(value string, column string, row int) (float64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	var f float64
+	if _, err := fmt.Sscanf(value, "%g", &f); err != nil {
+		return 0, fmt.Errorf("row %d: %s %q is not a number", row, column, value)
+	}
+	return f, nil
+}
+
+func parseIntField(value string, column string, row int) (int, error) {
+	f, err := parseFloatField(value, column, row)
+	return int(math.Round(f)), err
+}
+
+// cellAt returns a trimmed cell by header name, or "" when the row is short
+func cellAt(cells []string, col map[string]int, name string) string {
+	i, ok := col[name]
+	if !ok || i >= len(cells) {
+		return ""
+	}
+	return strings.TrimSpace(cells[i])
+}
+
+// readRows runs the per-format row parser over data rows, skipping blank lines.
+// 'firstRow' is the 1-based file line of rows[0], used in error messages.
+func readRows(rows [][]string, firstRow int, parse func(cells []string, row int) (PLURecord, error)) ([]PLURecord, error) {
+	records := []PLURecord{}
+	for i, cells := range rows {
+		if strings.TrimSpace(strings.Join(cells, "")) == "" {
+			continue
+		}
+		record, err := parse(cells, firstRow+i)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// buildRecord converts the raw text of one PLU line. Brands store prices and tare in
+// different units, so 'priceScale' and 'tareScale' divide the raw numbers back to RM and kg.
+func buildRecord(row int, hotkey, itemCode, name, price string, priceScale float64,
+	department, shelfLife, tare string, tareScale float64) (PLURecord, error) {
+	if itemCode == "" {
+		return PLURecord{}, fmt.Errorf("row %d: item code is empty", row)
+	}
+
+	record := PLURecord{ItemCode: itemCode, Name: name}
+	var err error
+	if record.Hotkey, err = parseIntField(hotkey, "hotkey", row); err != nil {
+		return record, err
+	}
+	if record.UnitPrice, err = parseFloatField(price, "unit price", row); err != nil {
+		return record, err
+	}
+	record.UnitPrice /= priceScale
+	if record.Department, err = parseIntField(department, "department", row); err != nil {
+		return record, err
+	}
+	if record.ShelfLifeDays, err = parseIntField(shelfLife, "shelf life", row); err != nil {
+		return record, err
+	}
+	if record.Tare, err = parseFloatField(tare, "tare", row); err != nil {
+		return record, err
+	}
+	record.Tare /= tareScale
+	return record, nil
+}
@@ -0,0 +1,58 @@
+package scale
+
+import (
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PLUSession is one open connection to a networked label scale
+type PLUSession interface {
+	Ping() error                // Checks the scale answers in its protocol
+	WritePLU(r PLURecord) error // Adds or replaces one PLU
+	DeletePLU(r PLURecord) error
+	Close() error
+}
+
+// NetworkExporter is a brand whose scales can also be loaded over the LAN, not only from its PLU file.
+// The network protocol sits next to the file layout of the same brand, under the same format name.
+type NetworkExporter interface {
+	PLUExporter
+	DefaultPort() int
+	Dial(address string, timeout time.Duration) (PLUSession, error)
+}
+
+// ErrNAK means the scale received the command but refused it (full memory, bad field, etc.)
+var ErrNAK = errors.New("scale refused the command")
+
+// GetNetworkExporter returns the brand for a scale's protocol name, if we can talk to it directly
+func GetNetworkExporter(format string) (NetworkExporter, error) {
+	if exporter, ok := exporters[format].(NetworkExporter); ok {
+		return exporter, nil
+	}
+	return nil, fmt.Errorf("No network protocol for scale format %q (use %s)", format, strings.Join(NetworkFormats(), ", "))
+}
+
+// NetworkFormats lists the formats that also have a network protocol
+func NetworkFormats() []string {
+	var names []string
+	for name, exporter := range exporters {
+		if _, ok := exporter.(NetworkExporter); ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Fingerprint identifies the content of a PLU, to tell whether a scale needs it again.
+// Money and tare are rounded to what the scales can hold (sen and grams).
+func Fingerprint(r PLURecord) string {
+	canonical := fmt.Sprintf("%d|%s|%s|%d|%d|%d|%d", r.Hotkey, r.ItemCode, r.Name,
+		int(math.Round(r.UnitPrice*100)), r.Department, r.ShelfLifeDays, int(math.Round(r.Tare*1000)))
+	return fmt.Sprintf("%x", sha1.Sum([]byte(canonical)))
+}
@@ -0,0 +1,104 @@
+// Package scale talks to weighing hardware: PLU files and the network sync for the
+// label-printing deli scales, and the continuous weight stream of the checkout scale.
+package scale
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go-pos-agent/internal/models"
+)
+
+// PLURecord is one weighable product as a scale sees it
+type PLURecord struct {
+	Hotkey        int     `json:"hotkey"`    // Key / PLU number on the scale keyboard
+	ItemCode      string  `json:"item_code"` // Code printed into the label barcode (matches the product SKU)
+	Name          string  `json:"name"`
+	UnitPrice     float64 `json:"unit_price"` // RM per kg
+	Department    int     `json:"department"`
+	ShelfLifeDays int     `json:"shelf_life_days"`
+	Tare          float64 `json:"tare"` // kg
+}
+
+// PLUExporter writes (and reads back) the PLU file for one scale brand.
+// Reading is what lets us compare what is actually loaded on the scale with the catalogue.
+type PLUExporter interface {
+	Name() string
+	FileName() string
+	ContentType() string
+	Write(w io.Writer, records []PLURecord) error
+	Read(r io.Reader) ([]PLURecord, error)
+}
+
+// exporters is the registry of supported brands, keyed by ?format=
+var exporters = map[string]PLUExporter{
+	"rongta": rongtaExporter{},
+	"digi":   digiExporter{},
+	"cas":    casExporter{},
+	"csv":    genericCSVExporter{},
+}
+
+// GetExporter returns the exporter for a format name ("rongta", "digi", "cas", "csv")
+func GetExporter(format string) (PLUExporter, error) {
+	exporter, ok := exporters[format]
+	if !ok {
+		return nil, fmt.Errorf("Unsupported scale format %q (use %s)", format, strings.Join(SupportedFormats(), ", "))
+	}
+	return exporter, nil
+}
+
+// SupportedFormats lists the registered format names for error messages and the dashboard
+func SupportedFormats() []string {
+	names := make([]string, 0, len(exporters))
+	for name := range exporters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ItemCode is the code a weighable product is keyed in as on the scale (its SKU, or its ID if it has none).
+// Shared by the PLU files and the shelf labels so both show the same number.
+func ItemCode(p models.Product) string {
+	if p.SKU == "" {
+		return fmt.Sprintf("%d", p.ID) // Fallback if no SKU exists
+	}
+	return p.SKU
+}
+
+// NumericPLU is the scale key a product gets from its item code when that code is a plain number
+func NumericPLU(p models.Product) (int, bool) {
+	// --- SMART HOTKEY LOGIC ---
+	// Convert the 5-digit SKU (e.g., "00007") into a simple scale key (7).
+	if pluInt, err := strconv.Atoi(ItemCode(p)); err == nil && pluInt > 0 {
+		return pluInt, true
+	}
+	return 0, false
+}
+
+// RecordFromProduct builds the scale view of a product. A product whose item code isn't a plain number
+// uses the PLU number allocated to it (Product.ScalePLU); 'index' (its position in the export) is only
+// the last resort for one that has none yet.
+func RecordFromProduct(p models.Product, index int) PLURecord {
+	itemCode := ItemCode(p)
+
+	hotkey := index + 1
+	if pluInt, ok := NumericPLU(p); ok {
+		hotkey = pluInt
+	} else if p.ScalePLU > 0 {
+		hotkey = p.ScalePLU
+	}
+
+	return PLURecord{
+		Hotkey:        hotkey,
+		ItemCode:      itemCode,
+		Name:          p.Name,
+		UnitPrice:     p.Price,
+		Department:    p.ScaleDepartment,
+		ShelfLifeDays: p.ShelfLifeDays,
+		Tare:          p.TareWeight,
+	}
+}
@@ -0,0 +1,37 @@
+package scale
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// openWeightSource opens the checkout scale's data stream. "tcp://host:port" is used for
+// scales behind a serial-to-Ethernet adapter; anything else is a serial port ("COM3", "/dev/ttyUSB0").
+func openWeightSource(port string, baud int) (io.ReadCloser, error) {
+	if strings.HasPrefix(port, "tcp://") {
+		return net.DialTimeout("tcp", strings.TrimPrefix(port, "tcp://"), 5*time.Second)
+	}
+
+	// Serial: the OS tool sets the line speed, then the port is read like a file
+	path := port
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		// Command: mode COM3: BAUD=9600 PARITY=n DATA=8 STOP=1
+		cmd = exec.Command("cmd", "/C", "mode", port+":", "BAUD="+strconv.Itoa(baud), "PARITY=n", "DATA=8", "STOP=1")
+		path = `\\.\` + port // Needed for COM10 and above
+	} else {
+		cmd = exec.Command("stty", "-F", port, strconv.Itoa(baud), "raw", "-echo")
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("could not configure %s: %v (%s)", port, err, strings.TrimSpace(string(out)))
+	}
+
+	return os.OpenFile(path, os.O_RDWR, 0)
+}
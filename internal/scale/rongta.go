@@ -0,0 +1,115 @@
+package scale
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// rongtaHeaders are the exact column headers expected by the Rongta Scale Software.
+// We include all 24 columns to guarantee perfect copy-paste alignment.
+var rongtaHeaders = []string{
+	"Hotkey", "Name", "LFCode", "Code", "Barcode Type", "Unit Price",
+	"Unit Weight", "Unit Amount", "Department", "PT Weight", "Shelf Time",
+	"Pack Type", "Tare", "Error(%)", "Message1", "Message2", "Label",
+	"Discount/Table", "Account", "sPluFieldTitle20", "Account",
+	"Recommend days", "nutrition", "Ice(%)",
+}
+
+// rongtaExporter writes the native .xlsx sheet imported by the Rongta RLS scale software
+type rongtaExporter struct{}
+
+func (rongtaExporter) Name() string     { return "rongta" }
+func (rongtaExporter) FileName() string { return "rongta_plu_export.xlsx" }
+func (rongtaExporter) ContentType() string {
+	return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+}
+
+func (rongtaExporter) Write(w io.Writer, records []PLURecord) error {
+	f := excelize.NewFile()
+	defer f.Close()
+
+	// 1. Header row
+	for i, header := range rongtaHeaders {
+		cell, _ := excelize.CoordinatesToCellName(i+1, 1)
+		f.SetCellValue("Sheet1", cell, header)
+	}
+
+	// 2. One row per PLU (starting at Row 2), with safe Rongta defaults for the columns we don't manage
+	for i, r := range records {
+		row := i + 2
+		hotkey := fmt.Sprintf("%d", r.Hotkey)
+
+		values := []interface{}{
+			hotkey,                      // Hotkey
+			r.Name,                      // Name
+			hotkey,                      // LFCode
+			r.ItemCode,                  // Code (SKU)
+			2,                           // Barcode Type
+			r.UnitPrice,                 // Unit Price
+			"Kg",                        // Unit Weight
+			0,                           // Unit Amount
+			r.Department,                // Department
+			"0.000",                     // PT Weight
+			r.ShelfLifeDays,             // Shelf Time
+			"Normal",                    // Pack Type
+			fmt.Sprintf("%.3f", r.Tare), // Tare
+			0,                           // Error(%)
+			0,                           // Message1
+			0,                           // Message2
+			0,                           // Label
+			0,                           // Discount/Table
+			0,                           // Account
+			"",                          // sPluFieldTitle20
+			0,                           // Account
+			0,                           // Recommend days
+			0,                           // nutrition
+			0,                           // Ice(%)
+		}
+		for col, value := range values {
+			cell, _ := excelize.CoordinatesToCellName(col+1, row)
+			f.SetCellValue("Sheet1", cell, value)
+		}
+	}
+
+	return f.Write(w)
+}
+
+// Read parses a sheet exported from the Rongta software (columns are found by header, so reordering is fine)
+func (rongtaExporter) Read(r io.Reader) ([]PLURecord, error) {
+	f, err := excelize.OpenReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not a valid .xlsx file: %v", err)
+	}
+	defer f.Close()
+
+	rows, err := f.GetRows(f.GetSheetName(0))
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return []PLURecord{}, nil
+	}
+
+	// First occurrence of each header wins (the sheet repeats "Account")
+	col := map[string]int{}
+	for i, h := range rows[0] {
+		key := strings.ToLower(strings.TrimSpace(h))
+		if _, exists := col[key]; !exists {
+			col[key] = i
+		}
+	}
+	for _, required := range []string{"code", "name", "unit price"} {
+		if _, ok := col[required]; !ok {
+			return nil, fmt.Errorf("missing %q column", required)
+		}
+	}
+
+	return readRows(rows[1:], 2, func(cells []string, row int) (PLURecord, error) {
+		get := func(name string) string { return cellAt(cells, col, name) }
+		return buildRecord(row, get("hotkey"), get("code"), get("name"), get("unit price"), 1,
+			get("department"), get("shelf time"), get("tare"), 1)
+	})
+}
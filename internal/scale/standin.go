@@ -0,0 +1,134 @@
+package scale
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"sync"
+)
+
+// StandIn is an in-memory CL-series scale for the tests and cmd/scale-emulator. It answers the
+// requests casSession sends (status, PLU write, PLU delete) and keeps its PLU table in RAM.
+// It shares the encoder with the client, so it proves the sync logic, not compatibility with hardware.
+type StandIn struct {
+	Capacity int             // Most PLUs it can hold (0 = unlimited); writes beyond it are refused
+	Refuse   map[string]bool // Item codes to refuse, to simulate a scale rejecting a PLU
+	Logf     func(format string, args ...interface{})
+
+	mu   sync.Mutex
+	plus map[[2]int]PLURecord // Keyed by department and PLU number, like the scale
+}
+
+// NewStandIn creates an empty stand-in scale
+func NewStandIn(capacity int, refuse ...string) *StandIn {
+	s := &StandIn{Capacity: capacity, Refuse: map[string]bool{}, plus: map[[2]int]PLURecord{}}
+	for _, code := range refuse {
+		s.Refuse[code] = true
+	}
+	return s
+}
+
+// Serve answers connections until the listener is closed
+func (s *StandIn) Serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go s.serve(conn)
+	}
+}
+
+// PLUs returns what the scale holds, by department and PLU number
+func (s *StandIn) PLUs() []PLURecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records := make([]PLURecord, 0, len(s.plus))
+	for _, r := range s.plus {
+		records = append(records, r)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Department != records[j].Department {
+			return records[i].Department < records[j].Department
+		}
+		return records[i].Hotkey < records[j].Hotkey
+	})
+	return records
+}
+
+// serve answers requests from one connection until it closes
+func (s *StandIn) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		request, err := readCASRequest(reader)
+		if err != nil {
+			if _, isNetErr := err.(net.Error); isNetErr || err == io.EOF || err == io.ErrUnexpectedEOF {
+				return // Client hung up
+			}
+			// Garbled request: there is no telling where the next one starts, so hang up
+			s.logf("read: %v", err)
+			return
+		}
+
+		reply := "O" + request.Command
+		if code := s.handle(request); code != 0 {
+			reply = fmt.Sprintf("N%s%02X", request.Command, code)
+		}
+		if _, err := conn.Write([]byte(reply + "\r\n")); err != nil {
+			return
+		}
+	}
+}
+
+// handle applies one request to the PLU table and returns 0 or the error code to refuse it with
+func (s *StandIn) handle(request casRequest) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := [2]int{request.Department, request.PLU}
+	switch request.Command {
+	case casCmdStatus:
+		return 0
+
+	case casCmdWrite:
+		record, err := decodeCASPLU(request)
+		if err != nil {
+			s.logf("bad PLU %d: %v", request.PLU, err)
+			return 0x02
+		}
+		if s.Refuse[record.ItemCode] {
+			s.logf("NAK  %s %s", record.ItemCode, record.Name)
+			return 0x02
+		}
+		if _, exists := s.plus[key]; !exists && s.Capacity > 0 && len(s.plus) >= s.Capacity {
+			s.logf("FULL %s %s", record.ItemCode, record.Name)
+			return 0x03
+		}
+		s.plus[key] = record
+		s.logf("W    %5d %-8s %-20s RM %.2f/kg dept %d, %d days, tare %.3f kg", record.Hotkey, record.ItemCode, record.Name,
+			record.UnitPrice, record.Department, record.ShelfLifeDays, record.Tare)
+		return 0
+
+	case casCmdDelete:
+		delete(s.plus, key)
+		s.logf("D    %5d dept %d", request.PLU, request.Department)
+		return 0
+	}
+
+	s.logf("unknown command %q", request.Command)
+	return 0x01
+}
+
+func (s *StandIn) logf(format string, args ...interface{}) {
+	if s.Logf != nil {
+		s.Logf(format, args...)
+	}
+}
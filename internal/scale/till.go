@@ -0,0 +1,202 @@
+package scale
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	stabilityWindow = 700 * time.Millisecond // Readings must agree for this long...
+	stabilityBand   = 0.002                  // ...within +/- 2 g
+	staleAfter      = 2 * time.Second        // No message for this long = scale disconnected
+	reconnectDelay  = 5 * time.Second
+)
+
+// LiveWeight is what the till sees: net weight after the software tare, and whether it can be sold
+type LiveWeight struct {
+	Connected bool       `json:"connected"`
+	Net       float64    `json:"net"`   // kg, use this as the SaleItem quantity
+	Gross     float64    `json:"gross"` // kg, as reported by the scale
+	Tare      float64    `json:"tare"`  // kg, software tare (container on the plate)
+	Unit      string     `json:"unit"`
+	Stable    bool       `json:"stable"`
+	Overload  bool       `json:"overload"`
+	UpdatedAt *time.Time `json:"updated_at"`
+	Error     string     `json:"error,omitempty"`
+}
+
+type weightSample struct {
+	weight float64
+	at     time.Time
+}
+
+// TillScale reads a checkout scale's continuous output in the background and keeps the latest weight
+type TillScale struct {
+	port     string
+	baud     int
+	protocol WeightProtocol
+
+	mu        sync.Mutex
+	last      WeightReading
+	lastAt    time.Time
+	history   []weightSample
+	tare      float64
+	lastError string
+}
+
+// NewTillScale prepares a reader; call Start to begin reading
+func NewTillScale(port string, protocol string, baud int) (*TillScale, error) {
+	parser, err := GetWeightProtocol(protocol)
+	if err != nil {
+		return nil, err
+	}
+	if baud <= 0 {
+		baud = 9600
+	}
+	return &TillScale{port: port, baud: baud, protocol: parser}, nil
+}
+
+// Start reads the scale forever, reconnecting after errors (cable pulled, scale switched off)
+func (t *TillScale) Start() {
+	go func() {
+		for {
+			if err := t.readOnce(); err != nil {
+				t.mu.Lock()
+				t.lastError = err.Error()
+				t.mu.Unlock()
+				log.Printf("⚖️ TILL SCALE: %v (retrying in %s)", err, reconnectDelay)
+			}
+			time.Sleep(reconnectDelay)
+		}
+	}()
+}
+
+// readOnce opens the port and consumes messages until the stream breaks
+func (t *TillScale) readOnce() error {
+	source, err := openWeightSource(t.port, t.baud)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	log.Printf("⚖️ TILL SCALE: Reading %s (%s protocol)", t.port, t.protocol.Name())
+
+	scanner := bufio.NewScanner(source)
+	scanner.Split(t.protocol.Split())
+	for scanner.Scan() {
+		reading, err := t.protocol.Parse(scanner.Bytes())
+		if err != nil {
+			continue // Half a message after connecting, line noise, etc.
+		}
+		t.record(reading)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("%s closed", t.port)
+}
+
+// record stores a reading and trims the stability window
+func (t *TillScale) record(reading WeightReading) {
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.last = reading
+	t.lastAt = now
+	t.lastError = ""
+	t.history = append(t.history, weightSample{weight: reading.Weight, at: now})
+
+	cutoff := now.Add(-stabilityWindow)
+	for len(t.history) > 0 && t.history[0].at.Before(cutoff) {
+		t.history = t.history[1:]
+	}
+}
+
+// Current returns the live weight. It is only Stable when the scale reports no motion AND
+// the readings over the last stabilityWindow stayed within stabilityBand of each other.
+func (t *TillScale) Current() LiveWeight {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.currentLocked()
+}
+
+func (t *TillScale) currentLocked() LiveWeight {
+	live := LiveWeight{Unit: "kg", Tare: t.tare, Error: t.lastError}
+	if t.lastAt.IsZero() || time.Since(t.lastAt) > staleAfter {
+		if live.Error == "" {
+			live.Error = "No data from scale"
+		}
+		return live
+	}
+
+	at := t.lastAt
+	live.Connected = true
+	live.UpdatedAt = &at
+	live.Gross = round3(t.last.Weight)
+	live.Net = round3(t.last.Weight - t.tare)
+	live.Overload = t.last.Overload
+	live.Stable = t.last.Stable && !t.last.Overload && t.windowSteady()
+	return live
+}
+
+// windowSteady: enough samples covering the window, all close together
+func (t *TillScale) windowSteady() bool {
+	if len(t.history) < 3 || t.lastAt.Sub(t.history[0].at) < stabilityWindow/2 {
+		return false
+	}
+	low, high := t.history[0].weight, t.history[0].weight
+	for _, s := range t.history {
+		low = math.Min(low, s.weight)
+		high = math.Max(high, s.weight)
+	}
+	return high-low <= stabilityBand
+}
+
+// WaitStable polls until the weight settles or the timeout passes
+func (t *TillScale) WaitStable(timeout time.Duration) LiveWeight {
+	deadline := time.Now().Add(timeout)
+	for {
+		live := t.Current()
+		if live.Stable || time.Now().After(deadline) {
+			return live
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// Tare takes the current (stable) gross weight as the container weight
+func (t *TillScale) Tare() (LiveWeight, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	live := t.currentLocked()
+	if !live.Connected {
+		return live, fmt.Errorf("Scale is not connected")
+	}
+	if !live.Stable {
+		return live, fmt.Errorf("Weight is not stable yet")
+	}
+	if live.Gross < 0 {
+		return live, fmt.Errorf("Cannot tare a negative weight, zero the scale first")
+	}
+
+	t.tare = live.Gross
+	return t.currentLocked(), nil
+}
+
+// ClearTare removes the software tare
+func (t *TillScale) ClearTare() LiveWeight {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.tare = 0
+	return t.currentLocked()
+}
+
+// round3 keeps weights to the gram
+func round3(v float64) float64 {
+	return math.Round(v*1000) / 1000
+}
@@ -0,0 +1,158 @@
+package scale
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// WeightReading is one weight message from a checkout scale
+type WeightReading struct {
+	Weight    float64 // kg, gross (negative when below zero)
+	Stable    bool    // The scale itself reports no motion
+	Overload  bool    // Over capacity / under zero: the value can't be trusted
+	ScaleTare float64 // Tare held by the scale itself (kg), 0 if none
+	Net       bool    // Scale says the weight is already net of its own tare
+}
+
+// WeightProtocol decodes the continuous output of one scale family
+type WeightProtocol interface {
+	Name() string
+	Split() bufio.SplitFunc // Cuts the byte stream into messages
+	Parse(msg []byte) (WeightReading, error)
+}
+
+// GetWeightProtocol returns the parser for "cas" or "toledo"
+func GetWeightProtocol(name string) (WeightProtocol, error) {
+	switch strings.ToLower(name) {
+	case "", "cas":
+		return casContinuous{}, nil
+	case "toledo":
+		return toledoContinuous{}, nil
+	}
+	return nil, fmt.Errorf("unsupported weighing protocol %q (use cas or toledo)", name)
+}
+
+// --- CAS continuous output (PD-II, ER, SW series) ---
+// One ASCII line per reading, e.g. "ST,GS,+  1.234kg\r\n":
+//   ST = stable, US = unstable, OL = overload;  GS = gross, NT = net;  then sign, value and unit.
+
+type casContinuous struct{}
+
+func (casContinuous) Name() string           { return "cas" }
+func (casContinuous) Split() bufio.SplitFunc { return bufio.ScanLines }
+
+func (casContinuous) Parse(msg []byte) (WeightReading, error) {
+	parts := strings.Split(strings.TrimSpace(string(msg)), ",")
+	if len(parts) < 3 {
+		return WeightReading{}, fmt.Errorf("CAS: unexpected message %q", msg)
+	}
+
+	reading := WeightReading{}
+	switch strings.TrimSpace(parts[0]) {
+	case "ST":
+		reading.Stable = true
+	case "US":
+	case "OL":
+		reading.Overload = true
+		return reading, nil
+	default:
+		return WeightReading{}, fmt.Errorf("CAS: unknown status %q", parts[0])
+	}
+	reading.Net = strings.TrimSpace(parts[1]) == "NT"
+
+	// The weight is the last field; some models put a device ID field in between
+	raw := strings.ReplaceAll(strings.TrimSpace(parts[len(parts)-1]), " ", "")
+	unit := strings.TrimLeft(raw, "+-0123456789.")
+	value, err := strconv.ParseFloat(strings.TrimSuffix(raw, unit), 64)
+	if err != nil {
+		return WeightReading{}, fmt.Errorf("CAS: bad weight %q", parts[len(parts)-1])
+	}
+
+	switch strings.ToLower(unit) {
+	case "kg", "":
+		reading.Weight = value
+	case "g":
+		reading.Weight = value / 1000
+	case "lb":
+		reading.Weight = value * 0.45359237
+	default:
+		return WeightReading{}, fmt.Errorf("CAS: unknown unit %q", unit)
+	}
+	return reading, nil
+}
+
+// --- Mettler Toledo continuous output ---
+// Fixed frame: STX, status words A/B/C, 6 weight digits, 6 tare digits, CR (optionally a checksum byte).
+//   SWA bits 0-2: decimal point position
+//   SWB bit 0: net, bit 1: negative, bit 2: out of range, bit 3: in motion, bit 4: 1 = kg / 0 = lb
+
+// stx opens every Toledo frame
+const stx byte = 0x02
+
+type toledoContinuous struct{}
+
+func (toledoContinuous) Name() string { return "toledo" }
+
+func (toledoContinuous) Split() bufio.SplitFunc {
+	return func(data []byte, atEOF bool) (int, []byte, error) {
+		start := bytes.IndexByte(data, stx)
+		if start < 0 {
+			return len(data), nil, nil // Noise before the first frame
+		}
+		end := bytes.IndexByte(data[start:], '\r')
+		if end < 0 {
+			if atEOF {
+				return len(data), nil, nil
+			}
+			return start, nil, nil // Wait for the rest of the frame
+		}
+		return start + end + 1, data[start+1 : start+end], nil
+	}
+}
+
+func (toledoContinuous) Parse(msg []byte) (WeightReading, error) {
+	if len(msg) < 15 {
+		return WeightReading{}, fmt.Errorf("Toledo: short frame (%d bytes)", len(msg))
+	}
+	swa, swb := msg[0], msg[1]
+
+	weight, err := toledoValue(msg[3:9], swa)
+	if err != nil {
+		return WeightReading{}, err
+	}
+	tare, err := toledoValue(msg[9:15], swa)
+	if err != nil {
+		return WeightReading{}, err
+	}
+
+	reading := WeightReading{
+		Weight:    weight,
+		ScaleTare: tare,
+		Net:       swb&0x01 != 0,
+		Overload:  swb&0x04 != 0,
+		Stable:    swb&0x08 == 0,
+	}
+	if swb&0x02 != 0 {
+		reading.Weight = -reading.Weight
+	}
+	if swb&0x10 == 0 { // Scale is set to pounds
+		reading.Weight *= 0.45359237
+		reading.ScaleTare *= 0.45359237
+	}
+	return reading, nil
+}
+
+// toledoValue applies the decimal point from status word A to six raw digits
+func toledoValue(digits []byte, swa byte) (float64, error) {
+	n, err := strconv.Atoi(strings.TrimSpace(string(digits)))
+	if err != nil {
+		return 0, fmt.Errorf("Toledo: bad digits %q", digits)
+	}
+	// 000 = x100, 001 = x10, 010 = x1, 011 = 0.1, 100 = 0.01, 101 = 0.001, 110 = 0.0001, 111 = 0.00001
+	exponent := 2 - int(swa&0x07)
+	return float64(n) * math.Pow10(exponent), nil
+}
@@ -0,0 +1,137 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+
+	"go-pos-agent/internal/models"
+	"go-pos-agent/internal/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DefaultInternalBarcodePrefix is used when the store hasn't picked one.
+// 20-29 is GS1's "in-store" range; 20 and 21 are taken by the default scale barcode layout.
+const DefaultInternalBarcodePrefix = "29"
+
+// ValidateInternalBarcodePrefix makes sure a prefix is two digits inside GS1's in-store range 20-29.
+// Clashes with the scale layouts are checked separately (CheckInternalPrefixFree).
+func ValidateInternalBarcodePrefix(prefix string) error {
+	if len(prefix) != 2 || prefix[0] != '2' || prefix[1] < '0' || prefix[1] > '9' {
+		return fmt.Errorf("Internal barcode prefix must be between 20 and 29")
+	}
+	return nil
+}
+
+// AllocateInternalBarcode hands out the next in-store EAN-13: prefix + 10-digit counter + check digit.
+// The settings row is locked so two simultaneous product creations never get the same number,
+// and numbers that somehow already exist as a SKU are skipped.
+func AllocateInternalBarcode(tx *gorm.DB) (string, error) {
+	var settings models.StoreSettings
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&settings).Error; err != nil {
+		return "", fmt.Errorf("failed to load store settings: %v", err)
+	}
+
+	prefix := settings.InternalBarcodePrefix
+	if ValidateInternalBarcodePrefix(prefix) != nil {
+		prefix = DefaultInternalBarcodePrefix
+	}
+
+	counter := settings.InternalBarcodeCounter
+	for attempts := 0; attempts < 1000; attempts++ {
+		counter++
+		if counter > 9999999999 {
+			return "", fmt.Errorf("internal barcode range for prefix %s is exhausted", prefix)
+		}
+
+		code, err := utils.CompleteEAN13(fmt.Sprintf("%s%010d", prefix, counter))
+		if err != nil {
+			return "", err
+		}
+
+		var existing int64
+		tx.Model(&models.Product{}).Where("sku = ?", code).Count(&existing)
+		if existing > 0 {
+			continue
+		}
+
+		if err := tx.Model(&settings).Update("internal_barcode_counter", counter).Error; err != nil {
+			return "", err
+		}
+		return code, nil
+	}
+
+	return "", fmt.Errorf("could not find a free internal barcode")
+}
+
+// LoadScaleBarcodeLayouts returns the store's active scale label layouts for the scanner
+func LoadScaleBarcodeLayouts(db *gorm.DB) []utils.ScaleBarcodeLayout {
+	var formats []models.ScaleBarcodeFormat
+	db.Where("is_active = ?", true).Order("prefix_from asc").Find(&formats)
+
+	layouts := make([]utils.ScaleBarcodeLayout, 0, len(formats))
+	for _, f := range formats {
+		layouts = append(layouts, utils.ScaleBarcodeLayout{
+			Name:           f.Name,
+			PrefixFrom:     f.PrefixFrom,
+			PrefixTo:       f.PrefixTo,
+			ItemCodeLength: f.ItemCodeLength,
+			ValueType:      f.ValueType,
+			Decimals:       f.Decimals,
+		})
+	}
+	return layouts
+}
+
+// ValidateScaleBarcodeFormat checks a layout on its own and against the other active layouts
+// and the internal barcode prefix, so one scanned code can never mean two things.
+func ValidateScaleBarcodeFormat(db *gorm.DB, f models.ScaleBarcodeFormat) error {
+	if f.PrefixFrom < 20 || f.PrefixTo > 29 || f.PrefixFrom > f.PrefixTo {
+		return fmt.Errorf("Prefix range must sit inside 20-29 (from <= to)")
+	}
+	// 2 prefix digits + item code + at least 4 value digits + 1 check digit = 13
+	if f.ItemCodeLength < 4 || f.ItemCodeLength > 6 {
+		return fmt.Errorf("Item code length must be between 4 and 6 digits")
+	}
+	if f.ValueType != "price" && f.ValueType != "weight" {
+		return fmt.Errorf("Value type must be price or weight")
+	}
+	if f.Decimals < 0 || f.Decimals > 3 {
+		return fmt.Errorf("Decimals must be between 0 and 3")
+	}
+
+	if !f.IsActive {
+		return nil
+	}
+
+	var others []models.ScaleBarcodeFormat
+	db.Where("is_active = ? AND id <> ?", true, f.ID).Find(&others)
+	for _, other := range others {
+		if f.PrefixFrom <= other.PrefixTo && other.PrefixFrom <= f.PrefixTo {
+			return fmt.Errorf("Prefix range overlaps with format '%s' (%d-%d)", other.Name, other.PrefixFrom, other.PrefixTo)
+		}
+	}
+
+	var settings models.StoreSettings
+	if err := db.First(&settings).Error; err == nil {
+		if internal, err := strconv.Atoi(settings.InternalBarcodePrefix); err == nil && internal >= f.PrefixFrom && internal <= f.PrefixTo {
+			return fmt.Errorf("Prefix %d is used for in-store product barcodes", internal)
+		}
+	}
+	return nil
+}
+
+// CheckInternalPrefixFree makes sure no active scale layout already owns the prefix
+func CheckInternalPrefixFree(db *gorm.DB, prefix string) error {
+	value, err := strconv.Atoi(prefix)
+	if err != nil {
+		return fmt.Errorf("Internal barcode prefix must be two digits")
+	}
+
+	var clash models.ScaleBarcodeFormat
+	if err := db.Where("is_active = ? AND prefix_from <= ? AND prefix_to >= ?", true, value, value).First(&clash).Error; err == nil {
+		return fmt.Errorf("Prefix %s is already used by the scale barcode format '%s'", prefix, clash.Name)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"errors"
+	"strings"
+
+	"go-pos-agent/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// ErrUnknownCategory is returned when a product names a category that doesn't exist.
+// Refusing unknown names is what stops typos from creating phantom categories.
+var ErrUnknownCategory = errors.New("unknown category")
+
+// ResolveCategory finds a category by name, ignoring case and surrounding spaces
+func ResolveCategory(db *gorm.DB, name string) (*models.Category, error) {
+	var category models.Category
+	err := db.Where("LOWER(name) = ?", strings.ToLower(strings.TrimSpace(name))).First(&category).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrUnknownCategory
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &category, nil
+}
+
+// EnsureCategory returns the category with this name, creating it as a top-level category if needed.
+// Only used by trusted bulk paths (migration, import with allow_new_categories).
+func EnsureCategory(db *gorm.DB, name string) (*models.Category, error) {
+	category, err := ResolveCategory(db, name)
+	if err != ErrUnknownCategory {
+		return category, err
+	}
+
+	newCategory := models.Category{Name: strings.TrimSpace(name)}
+	if err := db.Create(&newCategory).Error; err != nil {
+		return nil, err
+	}
+	return &newCategory, nil
+}
+
+// CategoryTree is an in-memory copy of the categories table for roll-ups without N+1 queries
+type CategoryTree map[uint]models.Category
+
+// LoadCategoryTree reads every category once
+func LoadCategoryTree(db *gorm.DB) CategoryTree {
+	var categories []models.Category
+	db.Find(&categories)
+
+	tree := make(CategoryTree, len(categories))
+	for _, cat := range categories {
+		tree[cat.ID] = cat
+	}
+	return tree
+}
+
+// RootName walks up the parents and returns the top-level category name ("Uncategorized" if none).
+// Reports use this so "Soft Drinks" rolls up into "Drinks".
+func (t CategoryTree) RootName(categoryID *uint) string {
+	if categoryID == nil {
+		return "Uncategorized"
+	}
+
+	cat, ok := t[*categoryID]
+	if !ok {
+		return "Uncategorized"
+	}
+
+	// The hop limit protects against a corrupted parent loop
+	for hops := 0; cat.ParentID != nil && hops < len(t); hops++ {
+		parent, ok := t[*cat.ParentID]
+		if !ok {
+			break
+		}
+		cat = parent
+	}
+	return cat.Name
+}
+
+// DescendantIDs returns the category itself plus every sub-category below it
+func (t CategoryTree) DescendantIDs(rootID uint) []uint {
+	ids := []uint{rootID}
+	for i := 0; i < len(ids); i++ {
+		for _, cat := range t {
+			if cat.ParentID != nil && *cat.ParentID == ids[i] {
+				ids = append(ids, cat.ID)
+			}
+		}
+	}
+	return ids
+}
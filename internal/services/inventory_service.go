@@ -0,0 +1,363 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	"go-pos-agent/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Negative stock policies (StoreSettings.NegativeStockPolicy)
+const (
+	NegativeStockBlock = "block" // Refuse any movement that would take stock below zero (default)
+	NegativeStockAllow = "allow" // Let it through silently (e.g., goods sold before the delivery was keyed in)
+	NegativeStockWarn  = "warn"  // Let it through but flag it on the result and in the server log
+)
+
+var (
+	// ErrProductNotFound is returned when the movement targets a product that doesn't exist
+	ErrProductNotFound = errors.New("product not found")
+	// ErrInsufficientStock is returned when the "block" policy stops a movement
+	ErrInsufficientStock = errors.New("insufficient stock")
+	// ErrLocationNotFound is returned when the movement names a location that doesn't exist
+	ErrLocationNotFound = errors.New("location not found")
+	// ErrStockAtSeveralLocations is returned when a total is set for a product held in more than one place
+	ErrStockAtSeveralLocations = errors.New("stock is held at several locations, count each one through /api/locations/:id/count")
+)
+
+// StockMovement describes one change to a product's on-hand quantity.
+// Every stock change in the system (sales, restocks, write-offs, imports, merges, the AI agent)
+// goes through ApplyMovement or SetStockLevel so the ledger can never be skipped.
+type StockMovement struct {
+	ProductID      uint
+	Change         float64 // Positive = stock in, negative = stock out
+	Reason         string  // Ledger reason, e.g. "Sale Checkout", "Write-Off: Spoilage"
+	UserID         uint    // 0 = system / AI agent
+	SourceDocument string  // Receipt ID, adjustment number, import file... whatever explains the movement
+	LocationID     uint    // 0 = the default location (where the till sells from)
+}
+
+// MovementResult is the product after the movement plus the ledger row that recorded it
+type MovementResult struct {
+	Product      models.Product
+	Ledger       models.StockLedger
+	WentNegative bool   // Only possible under the "allow" and "warn" policies
+	Warning      string // Set under the "warn" policy when stock went below zero
+}
+
+// ApplyMovement locks the product row, applies the change at one location, enforces the
+// negative-stock policy and writes the ledger row. It must be called inside a transaction.
+// The product's StockQuantity moves with it, so it stays the total across all locations.
+func ApplyMovement(tx *gorm.DB, m StockMovement) (*MovementResult, error) {
+	// 1. Lock the row so two tills can't sell the last item at the same time
+	var product models.Product
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&product, m.ProductID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrProductNotFound
+		}
+		return nil, err
+	}
+
+	// 2. Resolve the location and its balance for this product
+	location, err := resolveLocation(tx, m.LocationID)
+	if err != nil {
+		return nil, err
+	}
+	locationStock, err := lockLocationStock(tx, location.ID, product.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	newBalance := product.StockQuantity + m.Change
+	newLocationBalance := locationStock.Quantity + m.Change
+	result := &MovementResult{}
+
+	// 3. Negative-stock policy (only outgoing movements can be refused).
+	// Stock has to be where it's taken from: units in the back store can't be sold off the shop floor.
+	if newLocationBalance < 0 && m.Change < 0 {
+		switch negativeStockPolicy(tx) {
+		case NegativeStockAllow:
+			result.WentNegative = true
+		case NegativeStockWarn:
+			result.WentNegative = true
+			result.Warning = fmt.Sprintf("%s is now at %.3f at %s (negative stock)", product.Name, newLocationBalance, location.Name)
+			log.Printf("⚠️ INVENTORY: %s (%s)", result.Warning, m.Reason)
+		default:
+			return nil, fmt.Errorf("%w for %s at %s (%.3f in stock, %.3f requested)", ErrInsufficientStock, product.Name, location.Name, locationStock.Quantity, -m.Change)
+		}
+	}
+
+	// 4. Update only the stock columns so concurrent edits to other fields aren't overwritten
+	if err := tx.Model(&product).Update("stock_quantity", newBalance).Error; err != nil {
+		return nil, err
+	}
+	product.StockQuantity = newBalance
+
+	if err := tx.Model(locationStock).Updates(map[string]interface{}{"quantity": newLocationBalance, "updated_at": time.Now()}).Error; err != nil {
+		return nil, err
+	}
+
+	// 5. Ledger Interceptor
+	result.Ledger = models.StockLedger{
+		ProductID:       product.ID,
+		ChangeAmount:    m.Change,
+		Balance:         newBalance,
+		Reason:          m.Reason,
+		UserID:          m.UserID,
+		SourceDocument:  m.SourceDocument,
+		LocationID:      location.ID,
+		LocationBalance: newLocationBalance,
+		CreatedAt:       time.Now(),
+	}
+	if err := tx.Create(&result.Ledger).Error; err != nil {
+		return nil, err
+	}
+
+	result.Product = product
+	return result, nil
+}
+
+// SetStockLevel moves a product to an absolute TOTAL quantity (imports, manual edits on the product).
+// The difference is posted at the one location holding the product (the default location if none does);
+// nothing is written if the level is unchanged. A total can't say which room gained or lost the
+// difference, so products held at several locations are refused: count each one with SetLocationStockLevel.
+func SetStockLevel(tx *gorm.DB, productID uint, newLevel float64, reason string, userID uint, sourceDocument string) (*MovementResult, error) {
+	var product models.Product
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&product, productID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrProductNotFound
+		}
+		return nil, err
+	}
+
+	if product.StockQuantity == newLevel {
+		return &MovementResult{Product: product}, nil
+	}
+
+	var balances []models.LocationStock
+	if err := tx.Where("product_id = ? AND quantity <> 0", productID).Find(&balances).Error; err != nil {
+		return nil, err
+	}
+	if len(balances) > 1 {
+		return nil, fmt.Errorf("%s: %w", product.Name, ErrStockAtSeveralLocations)
+	}
+	var locationID uint
+	if len(balances) == 1 {
+		locationID = balances[0].LocationID
+	}
+
+	return ApplyMovement(tx, StockMovement{
+		ProductID:      productID,
+		Change:         newLevel - product.StockQuantity,
+		Reason:         reason,
+		UserID:         userID,
+		SourceDocument: sourceDocument,
+		LocationID:     locationID,
+	})
+}
+
+// SetLocationStockLevel moves one location's balance to an absolute quantity (a stock count of that room)
+func SetLocationStockLevel(tx *gorm.DB, productID uint, locationID uint, newLevel float64, reason string, userID uint, sourceDocument string) (*MovementResult, error) {
+	var product models.Product
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&product, productID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrProductNotFound
+		}
+		return nil, err
+	}
+
+	location, err := resolveLocation(tx, locationID)
+	if err != nil {
+		return nil, err
+	}
+	locationStock, err := lockLocationStock(tx, location.ID, productID)
+	if err != nil {
+		return nil, err
+	}
+
+	if locationStock.Quantity == newLevel {
+		return &MovementResult{Product: product}, nil
+	}
+
+	return ApplyMovement(tx, StockMovement{
+		ProductID:      productID,
+		Change:         newLevel - locationStock.Quantity,
+		Reason:         reason,
+		UserID:         userID,
+		SourceDocument: sourceDocument,
+		LocationID:     location.ID,
+	})
+}
+
+// DefaultLocationID returns the location the till sells from
+func DefaultLocationID(tx *gorm.DB) (uint, error) {
+	var location models.Location
+	if err := tx.Where("is_default = ?", true).First(&location).Error; err != nil {
+		return 0, fmt.Errorf("no default location is set: %w", err)
+	}
+	return location.ID, nil
+}
+
+// resolveLocation loads the location, falling back to the default one for ID 0
+func resolveLocation(tx *gorm.DB, locationID uint) (models.Location, error) {
+	var location models.Location
+	query := tx.Where("is_default = ?", true)
+	if locationID != 0 {
+		query = tx.Where("id = ?", locationID)
+	}
+	if err := query.First(&location).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return location, ErrLocationNotFound
+		}
+		return location, err
+	}
+	return location, nil
+}
+
+// lockLocationStock loads (creating it at zero if needed) and locks a product's balance row at a location
+func lockLocationStock(tx *gorm.DB, locationID uint, productID uint) (*models.LocationStock, error) {
+	locationStock := &models.LocationStock{}
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where(models.LocationStock{LocationID: locationID, ProductID: productID}).
+		Attrs(models.LocationStock{UpdatedAt: time.Now()}).
+		FirstOrCreate(locationStock).Error
+	return locationStock, err
+}
+
+// DriftTolerance ignores float noise from fractional (weighed) quantities when comparing stock with the ledger
+const DriftTolerance = 0.0001
+
+// ReconcileLedger posts ledger-only corrections; the product's stock is trusted as-is.
+// If its location balances don't add up to it, the default location's balance takes the gap. Then every
+// location whose ledger rows don't sum to its balance gets a correction row there, so the ledger matches
+// per location, in total and in its running balance.
+func ReconcileLedger(tx *gorm.DB, productID uint, userID uint) ([]models.StockLedger, error) {
+	var product models.Product
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&product, productID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrProductNotFound
+		}
+		return nil, err
+	}
+
+	// 1. Location balances, made to add up to the product's stock
+	var balances []models.LocationStock
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("product_id = ?", productID).Find(&balances).Error; err != nil {
+		return nil, err
+	}
+	balanceAt := make(map[uint]float64)
+	var locationTotal float64
+	for _, b := range balances {
+		balanceAt[b.LocationID] = b.Quantity
+		locationTotal += b.Quantity
+	}
+	if gap := product.StockQuantity - locationTotal; math.Abs(gap) > DriftTolerance {
+		location, err := resolveLocation(tx, 0)
+		if err != nil {
+			return nil, err
+		}
+		locationStock, err := lockLocationStock(tx, location.ID, productID)
+		if err != nil {
+			return nil, err
+		}
+		locationStock.Quantity += gap
+		if err := tx.Model(locationStock).Updates(map[string]interface{}{"quantity": locationStock.Quantity, "updated_at": time.Now()}).Error; err != nil {
+			return nil, err
+		}
+		balanceAt[location.ID] = locationStock.Quantity
+	}
+
+	// 2. What the ledger says each location holds
+	var sums []struct {
+		LocationID uint
+		Total      float64
+	}
+	if err := tx.Model(&models.StockLedger{}).
+		Select("location_id, SUM(change_amount) as total").
+		Where("product_id = ?", productID).
+		Group("location_id").
+		Scan(&sums).Error; err != nil {
+		return nil, err
+	}
+	ledgerAt := make(map[uint]float64)
+	var running float64
+	for _, row := range sums {
+		ledgerAt[row.LocationID] = row.Total
+		running += row.Total
+		if _, held := balanceAt[row.LocationID]; !held {
+			balanceAt[row.LocationID] = 0
+		}
+	}
+
+	// 3. One correction per drifting location, in location order
+	locationIDs := make([]uint, 0, len(balanceAt))
+	for id := range balanceAt {
+		locationIDs = append(locationIDs, id)
+	}
+	sort.Slice(locationIDs, func(i, j int) bool { return locationIDs[i] < locationIDs[j] })
+
+	entries := []models.StockLedger{}
+	correction := func(locationID uint, change float64) error {
+		running += change
+		entry := models.StockLedger{
+			ProductID:       product.ID,
+			ChangeAmount:    change,
+			Balance:         running,
+			Reason:          "Reconciliation",
+			UserID:          userID,
+			SourceDocument:  "RECONCILIATION",
+			LocationID:      locationID,
+			LocationBalance: balanceAt[locationID],
+			CreatedAt:       time.Now(),
+		}
+		if err := tx.Create(&entry).Error; err != nil {
+			return err
+		}
+		entries = append(entries, entry)
+		return nil
+	}
+	for _, id := range locationIDs {
+		if diff := balanceAt[id] - ledgerAt[id]; math.Abs(diff) > DriftTolerance {
+			if err := correction(id, diff); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// 4. The sums were right but the running balance wasn't: a zero-change row puts it right
+	if len(entries) == 0 {
+		var latest models.StockLedger
+		err := tx.Where("product_id = ?", productID).Order("id desc").First(&latest).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		if err == nil && math.Abs(latest.Balance-product.StockQuantity) > DriftTolerance {
+			if err := correction(latest.LocationID, 0); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return entries, nil
+}
+
+// negativeStockPolicy reads the store's policy, defaulting to "block" when it isn't set
+func negativeStockPolicy(tx *gorm.DB) string {
+	var settings models.StoreSettings
+	if err := tx.First(&settings).Error; err != nil {
+		return NegativeStockBlock
+	}
+
+	switch settings.NegativeStockPolicy {
+	case NegativeStockAllow, NegativeStockWarn:
+		return settings.NegativeStockPolicy
+	default:
+		return NegativeStockBlock
+	}
+}
@@ -0,0 +1,59 @@
+package services
+
+import (
+	"time"
+
+	"go-pos-agent/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// RecordPriceChange writes a PriceHistory row if the selling or cost price actually moved.
+// 'before' must be the product as it was BEFORE the update. Every code path that changes a
+// price (dashboard, AI agent, scheduler, import) calls this so the history has no gaps.
+func RecordPriceChange(tx *gorm.DB, before models.Product, newPrice float64, newCostPrice float64, source string, userID uint) error {
+	if before.Price == newPrice && before.CostPrice == newCostPrice {
+		return nil
+	}
+
+	history := models.PriceHistory{
+		ProductID:    before.ID,
+		OldPrice:     before.Price,
+		NewPrice:     newPrice,
+		OldCostPrice: before.CostPrice,
+		NewCostPrice: newCostPrice,
+		Source:       source,
+		UserID:       userID,
+		ChangedAt:    time.Now(),
+	}
+	return tx.Create(&history).Error
+}
+
+// PriceAt answers "what was the selling price of this product at time t" from the history.
+// If nothing changed after t, the current price is still the answer.
+func PriceAt(db *gorm.DB, product models.Product, at time.Time) float64 {
+	// 1. The first change AFTER 't' tells us what the price was before it happened
+	var next models.PriceHistory
+	if err := db.Where("product_id = ? AND changed_at > ?", product.ID, at).Order("changed_at asc").First(&next).Error; err == nil {
+		return next.OldPrice
+	}
+
+	// 2. No later change: the live price has been in effect since then
+	return product.Price
+}
+
+// CostPricesAt returns the cost price every product had at time t, in one query.
+// Products missing from the map haven't changed cost since t, so their current cost applies.
+func CostPricesAt(db *gorm.DB, at time.Time) map[uint]float64 {
+	var later []models.PriceHistory
+	db.Where("changed_at > ?", at).Order("changed_at asc, id asc").Find(&later)
+
+	// The first change after 't' holds the cost that was in effect at 't'
+	costs := make(map[uint]float64)
+	for _, h := range later {
+		if _, seen := costs[h.ProductID]; !seen {
+			costs[h.ProductID] = h.OldCostPrice
+		}
+	}
+	return costs
+}
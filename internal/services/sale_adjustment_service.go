@@ -0,0 +1,25 @@
+package services
+
+import (
+	"math"
+	"strings"
+)
+
+// The till records a receipt's cart discount (sales.discount) and its cash rounding (sales.rounding)
+// next to what it charged (sales.total_amount = shelf-price lines - discount + rounding).
+
+// SaleDiscountSQL and SaleRoundingSQL sum the two over a query on sales
+const (
+	SaleDiscountSQL = "COALESCE(SUM(sales.discount), 0)"
+	SaleRoundingSQL = "COALESCE(SUM(sales.rounding), 0)"
+)
+
+// CashRounding is what the rounding mechanism adds to a cash bill so it can be paid in 5 sen coins
+// (1-2 sen round down, 3-4 round up, and so on). Card, QR and other tenders are charged to the sen.
+func CashRounding(paymentMethod string, amount float64) float64 {
+	if !strings.EqualFold(paymentMethod, "cash") {
+		return 0
+	}
+	sen := math.Round(amount * 100)
+	return (math.Round(sen/5)*5 - sen) / 100
+}
@@ -0,0 +1,342 @@
+package services
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go-pos-agent/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// summariesReady is set once the daily summaries cover every past day. Until then
+// (first start after upgrading, while the backfill runs) reports keep reading the raw tables.
+var summariesReady atomic.Bool
+
+// summaryRebuildLock keeps two rebuilds from deleting and re-inserting the same days at once
+var summaryRebuildLock sync.Mutex
+
+// SummariesReady reports whether reports may read past days from the daily summaries
+func SummariesReady() bool {
+	return summariesReady.Load()
+}
+
+// SummaryDay is the summary key for a moment: its calendar date in the shop's time zone
+func SummaryDay(t time.Time) string {
+	return t.Local().Format("2006-01-02")
+}
+
+// RecordSaleInSummaries adds one just-completed sale (with its Items) to that day's summary rows.
+// It runs after the checkout has committed; if it fails, the nightly rebuild puts the day right.
+func RecordSaleInSummaries(db *gorm.DB, sale models.Sale) error {
+	if sale.Status != "completed" {
+		return nil
+	}
+	day := SummaryDay(sale.SaleTime)
+
+	// 1. The products as they are now (category and weighable flag decide the category and item counts)
+	productIDs := make([]uint, 0, len(sale.Items))
+	for _, item := range sale.Items {
+		productIDs = append(productIDs, item.ProductID)
+	}
+	var products []models.Product
+	if err := db.Where("id IN ?", productIDs).Find(&products).Error; err != nil {
+		return err
+	}
+	productByID := make(map[uint]models.Product, len(products))
+	for _, p := range products {
+		productByID[p.ID] = p
+	}
+
+	// 2. Fold the lines into one row per product and per category
+	productRows := make(map[uint]*models.DailyProductSales)
+	categoryRows := make(map[uint]*models.DailyCategorySales)
+	tender := models.DailyTenderSales{Day: day, PaymentMethod: sale.PaymentMethod, Orders: 1, TotalAmount: sale.TotalAmount}
+	cashier := models.DailyCashierSales{Day: day, UserID: sale.UserID, Orders: 1}
+
+	for _, item := range sale.Items {
+		revenue := item.Quantity * item.PriceAtSale
+		cost := item.Quantity * item.BuyPriceRM
+		product := productByID[item.ProductID]
+
+		if _, exists := productRows[item.ProductID]; !exists {
+			productRows[item.ProductID] = &models.DailyProductSales{Day: day, ProductID: item.ProductID, PaymentMethod: sale.PaymentMethod, OrderCount: 1}
+		}
+		productRows[item.ProductID].Quantity += item.Quantity
+		productRows[item.ProductID].Revenue += revenue
+		productRows[item.ProductID].Cost += cost
+
+		var categoryID uint
+		if product.CategoryID != nil {
+			categoryID = *product.CategoryID
+		}
+		if _, exists := categoryRows[categoryID]; !exists {
+			categoryRows[categoryID] = &models.DailyCategorySales{Day: day, CategoryID: categoryID, OrderCount: 1}
+		}
+		categoryRows[categoryID].Quantity += item.Quantity
+		categoryRows[categoryID].Revenue += revenue
+		categoryRows[categoryID].Cost += cost
+
+		tender.Revenue += revenue
+		tender.Cost += cost
+		cashier.Revenue += revenue
+		cashier.Cost += cost
+		if product.IsWeighable {
+			cashier.Items++
+		} else {
+			cashier.Items += item.Quantity
+		}
+	}
+
+	tender.Discounts, tender.Rounding = sale.Discount, sale.Rounding
+
+	// 3. Add everything to the existing rows in one transaction
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, row := range productRows {
+			if err := addToSummary(tx, row, []string{"day", "product_id", "payment_method"}, "quantity", "revenue", "cost", "order_count"); err != nil {
+				return err
+			}
+		}
+		for _, row := range categoryRows {
+			if err := addToSummary(tx, row, []string{"day", "category_id"}, "quantity", "revenue", "cost", "order_count"); err != nil {
+				return err
+			}
+		}
+		if err := addToSummary(tx, &tender, []string{"day", "payment_method"}, "orders", "total_amount", "revenue", "cost", "discounts", "rounding"); err != nil {
+			return err
+		}
+		return addToSummary(tx, &cashier, []string{"day", "user_id"}, "orders", "revenue", "cost", "items")
+	})
+}
+
+// addToSummary inserts a summary row, or adds its figures onto the row that already has the same key
+func addToSummary(tx *gorm.DB, row interface{}, keys []string, totals ...string) error {
+	conflictColumns := make([]clause.Column, len(keys))
+	for i, k := range keys {
+		conflictColumns[i] = clause.Column{Name: k}
+	}
+	assignments := make(map[string]interface{}, len(totals))
+	for _, column := range totals {
+		assignments[column] = gorm.Expr(column + " + excluded." + column)
+	}
+	return tx.Clauses(clause.OnConflict{Columns: conflictColumns, DoUpdates: clause.Assignments(assignments)}).Create(row).Error
+}
+
+// RebuildDailySummaries recomputes the summary rows of every day from 'from' to 'to' (inclusive, local dates)
+// straight from sales and sale_items. Returns the number of days rebuilt.
+func RebuildDailySummaries(db *gorm.DB, from, to time.Time) (int, error) {
+	return rebuildSummaryDays(db, from, to, nil)
+}
+
+// RebuildSummariesForProduct rebuilds every day the product has summary rows for. Call it after moving the
+// product's sales to another product (a merge), inside the same transaction.
+func RebuildSummariesForProduct(db *gorm.DB, productID uint) (int, error) {
+	var days []string
+	if err := db.Model(&models.DailyProductSales{}).Where("product_id = ?", productID).Distinct("day").Pluck("day", &days).Error; err != nil {
+		return 0, err
+	}
+
+	summaryRebuildLock.Lock()
+	defer summaryRebuildLock.Unlock()
+	for i, day := range days {
+		dayStart, err := time.ParseInLocation("2006-01-02", day, time.Local)
+		if err != nil {
+			return i, err
+		}
+		if err := rebuildSummaryDay(db, dayStart); err != nil {
+			return i, err
+		}
+	}
+	return len(days), nil
+}
+
+// rebuildSummaryDays rebuilds the days one by one, calling 'done' after each day that made it in
+func rebuildSummaryDays(db *gorm.DB, from, to time.Time, done func(dayStart time.Time) error) (int, error) {
+	summaryRebuildLock.Lock()
+	defer summaryRebuildLock.Unlock()
+
+	from = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.Local)
+	to = time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.Local)
+
+	days := 0
+	for dayStart := from; !dayStart.After(to); dayStart = dayStart.AddDate(0, 0, 1) {
+		if err := rebuildSummaryDay(db, dayStart); err != nil {
+			return days, err
+		}
+		days++
+		if done != nil {
+			if err := done(dayStart); err != nil {
+				return days, err
+			}
+		}
+	}
+	return days, nil
+}
+
+// rebuildSummaryDay replaces one day's rows in all four summary tables
+func rebuildSummaryDay(db *gorm.DB, dayStart time.Time) error {
+	day := SummaryDay(dayStart)
+	dayEnd := dayStart.AddDate(0, 0, 1)
+	lines := func(tx *gorm.DB) *gorm.DB {
+		return tx.Table("sale_items").
+			Joins("JOIN sales ON sale_items.sale_id = sales.id").
+			Where("sales.status = ? AND sales.sale_time >= ? AND sales.sale_time < ?", "completed", dayStart, dayEnd)
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		// 1. Clear the day
+		for _, model := range []interface{}{&models.DailyProductSales{}, &models.DailyCategorySales{}, &models.DailyTenderSales{}, &models.DailyCashierSales{}} {
+			if err := tx.Where("day = ?", day).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+
+		// 2. Per product and tender
+		var productRows []models.DailyProductSales
+		err := lines(tx).
+			Select("? as day, sale_items.product_id, sales.payment_method, SUM(sale_items.quantity) as quantity, "+
+				"SUM(sale_items.quantity * sale_items.price_at_sale) as revenue, SUM(sale_items.quantity * sale_items.buy_price_rm) as cost, "+
+				"COUNT(DISTINCT sales.id) as order_count", day).
+			Group("sale_items.product_id, sales.payment_method").
+			Scan(&productRows).Error
+		if err != nil {
+			return err
+		}
+
+		// 3. Per category (products that no longer exist count as uncategorised)
+		var categoryRows []models.DailyCategorySales
+		err = lines(tx).
+			Joins("LEFT JOIN products ON sale_items.product_id = products.id").
+			Select("? as day, COALESCE(products.category_id, 0) as category_id, SUM(sale_items.quantity) as quantity, "+
+				"SUM(sale_items.quantity * sale_items.price_at_sale) as revenue, SUM(sale_items.quantity * sale_items.buy_price_rm) as cost, "+
+				"COUNT(DISTINCT sales.id) as order_count", day).
+			Group("COALESCE(products.category_id, 0)").
+			Scan(&categoryRows).Error
+		if err != nil {
+			return err
+		}
+
+		// 4. Per tender: receipt totals, discounts and rounding from the headers, line totals from the items
+		var tenderRows []models.DailyTenderSales
+		err = tx.Model(&models.Sale{}).
+			Select("? as day, sales.payment_method, COUNT(sales.id) as orders, SUM(sales.total_amount) as total_amount, "+
+				SaleDiscountSQL+" as discounts, "+SaleRoundingSQL+" as rounding", day).
+			Where("sales.status = ? AND sales.sale_time >= ? AND sales.sale_time < ?", "completed", dayStart, dayEnd).
+			Group("sales.payment_method").
+			Scan(&tenderRows).Error
+		if err != nil {
+			return err
+		}
+		var tenderLines []struct {
+			PaymentMethod string
+			Revenue       float64
+			Cost          float64
+		}
+		err = lines(tx).
+			Select("sales.payment_method, SUM(sale_items.quantity * sale_items.price_at_sale) as revenue, SUM(sale_items.quantity * sale_items.buy_price_rm) as cost").
+			Group("sales.payment_method").
+			Scan(&tenderLines).Error
+		if err != nil {
+			return err
+		}
+		for i := range tenderRows {
+			for _, l := range tenderLines {
+				if l.PaymentMethod == tenderRows[i].PaymentMethod {
+					tenderRows[i].Revenue, tenderRows[i].Cost = l.Revenue, l.Cost
+				}
+			}
+		}
+
+		// 5. Per cashier
+		var cashierRows []models.DailyCashierSales
+		err = tx.Model(&models.Sale{}).
+			Select("? as day, user_id, COUNT(id) as orders", day).
+			Where("status = ? AND sale_time >= ? AND sale_time < ?", "completed", dayStart, dayEnd).
+			Group("user_id").
+			Scan(&cashierRows).Error
+		if err != nil {
+			return err
+		}
+		var cashierLines []struct {
+			UserID  uint
+			Revenue float64
+			Cost    float64
+			Items   float64
+		}
+		err = lines(tx).
+			Joins("LEFT JOIN products ON sale_items.product_id = products.id").
+			Select("sales.user_id, SUM(sale_items.quantity * sale_items.price_at_sale) as revenue, SUM(sale_items.quantity * sale_items.buy_price_rm) as cost, " +
+				"SUM(CASE WHEN products.is_weighable THEN 1 ELSE sale_items.quantity END) as items").
+			Group("sales.user_id").
+			Scan(&cashierLines).Error
+		if err != nil {
+			return err
+		}
+		for i := range cashierRows {
+			for _, l := range cashierLines {
+				if l.UserID == cashierRows[i].UserID {
+					cashierRows[i].Revenue, cashierRows[i].Cost, cashierRows[i].Items = l.Revenue, l.Cost, l.Items
+				}
+			}
+		}
+
+		// 6. Write the fresh rows
+		for _, rows := range []interface{}{&productRows, &categoryRows, &tenderRows, &cashierRows} {
+			if err := tx.CreateInBatches(rows, 200).Error; err != nil && err != gorm.ErrEmptySlice {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// RefreshDailySummaries is the nightly job. It rebuilds the last 'recentDays' days before today, which picks up
+// anything the per-checkout updates missed (product merges, category moves, a failed update), and on the first
+// runs after an upgrade it also backfills every day since the first sale. Progress is kept in
+// StoreSettings.SummariesBackfilledThrough, so a backfill cut short resumes where it stopped; until it
+// reaches yesterday, reports keep reading the raw tables.
+// Today is never rebuilt here: its rows are only ever added to by checkouts.
+func RefreshDailySummaries(db *gorm.DB, recentDays int) {
+	now := time.Now()
+	yesterday := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local).AddDate(0, 0, -1)
+	from := yesterday.AddDate(0, 0, 1-recentDays)
+
+	// 1. Resume from the day after the marker, or start from the very first sale
+	var settings models.StoreSettings
+	if err := db.First(&settings).Error; err != nil {
+		log.Println("❌ SUMMARIES: Could not load store settings:", err)
+		return
+	}
+	if settings.SummariesBackfilledThrough != "" {
+		if through, err := time.ParseInLocation("2006-01-02", settings.SummariesBackfilledThrough, time.Local); err == nil && through.Before(from) {
+			from = through.AddDate(0, 0, 1)
+			log.Printf("📊 SUMMARIES: Resuming the backfill from %s...", SummaryDay(from))
+		}
+	} else {
+		var first models.Sale
+		if err := db.Order("sale_time asc").First(&first).Error; err == nil && first.SaleTime.Before(from) {
+			from = first.SaleTime
+			log.Printf("📊 SUMMARIES: Backfilling daily sales summaries from %s...", SummaryDay(from))
+		}
+	}
+
+	// 2. Rebuild, moving the marker forward after every day so an interrupted run loses nothing
+	days, err := rebuildSummaryDays(db, from, yesterday, func(dayStart time.Time) error {
+		day := SummaryDay(dayStart)
+		if day <= settings.SummariesBackfilledThrough {
+			return nil
+		}
+		settings.SummariesBackfilledThrough = day
+		return db.Model(&models.StoreSettings{}).Where("id = ?", settings.ID).Update("summaries_backfilled_through", day).Error
+	})
+	if err != nil {
+		log.Printf("❌ SUMMARIES: Rebuild stopped after %d day(s): %v", days, err)
+		return
+	}
+
+	summariesReady.Store(true)
+	log.Printf("✅ SUMMARIES: Rebuilt %d day(s) of sales summaries up to %s", days, SummaryDay(yesterday))
+}
@@ -0,0 +1,285 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"go-pos-agent/internal/models"
+	"go-pos-agent/internal/scale"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// scaleDialTimeout bounds both the connect and every command round-trip
+const scaleDialTimeout = 5 * time.Second
+
+// scaleSyncLocks keeps two syncs from talking to the same scale at once (scale ID -> *sync.Mutex)
+var scaleSyncLocks sync.Map
+
+// WeighablePLURecords builds the scale view of every active weighable product, in a stable order.
+// Products whose SKU isn't a number get a PLU number of their own the first time they are seen.
+func WeighablePLURecords(db *gorm.DB) ([]scale.PLURecord, error) {
+	var products []models.Product
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("is_weighable = ? AND is_archived = ?", true, false).Order("id asc").Find(&products).Error; err != nil {
+			return err
+		}
+		return assignScalePLUs(tx, products)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]scale.PLURecord, 0, len(products))
+	for i, p := range products {
+		records = append(records, scale.RecordFromProduct(p, i))
+	}
+	return records, nil
+}
+
+// assignScalePLUs gives each product without a numeric SKU the lowest free PLU number, once. The number stays
+// with the product, so archiving or adding another weighable never moves it to another key on the scale.
+// Numbers of archived (or no longer weighed) products stay reserved in case they come back; only a
+// number that a numeric SKU (or another product) now claims is given up and re-allocated.
+func assignScalePLUs(tx *gorm.DB, products []models.Product) error {
+	var reserved []int
+	if err := tx.Model(&models.Product{}).Where("scale_plu > 0 AND (is_archived = ? OR is_weighable = ?)", true, false).
+		Pluck("scale_plu", &reserved).Error; err != nil {
+		return err
+	}
+	taken := make(map[int]bool, len(products)+len(reserved))
+	for _, plu := range reserved {
+		taken[plu] = true
+	}
+	for _, p := range products {
+		if plu, ok := scale.NumericPLU(p); ok {
+			taken[plu] = true
+		}
+	}
+
+	var unassigned []int
+	for i, p := range products {
+		if _, ok := scale.NumericPLU(p); ok {
+			continue
+		}
+		if p.ScalePLU > 0 && !taken[p.ScalePLU] {
+			taken[p.ScalePLU] = true
+			continue
+		}
+		unassigned = append(unassigned, i)
+	}
+
+	next := 1
+	for _, i := range unassigned {
+		for taken[next] {
+			next++
+		}
+		taken[next] = true
+		if err := tx.Model(&models.Product{}).Where("id = ?", products[i].ID).UpdateColumn("scale_plu", next).Error; err != nil {
+			return err
+		}
+		products[i].ScalePLU = next
+	}
+	return nil
+}
+
+// SyncScale pushes the catalogue to one scale, sending only PLUs whose content differs from what the
+// scale last acknowledged and deleting ones that are no longer sold by weight. 'full' ignores the
+// remembered state and re-sends everything (e.g. after the scale's memory was cleared).
+// The run is always written to ScaleSyncLog, even when it fails.
+func SyncScale(db *gorm.DB, labelScale models.LabelScale, trigger string, full bool) (models.ScaleSyncLog, error) {
+	lock, _ := scaleSyncLocks.LoadOrStore(labelScale.ID, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	run := models.ScaleSyncLog{ScaleID: labelScale.ID, Trigger: trigger, StartedAt: time.Now()}
+	err := pushChangedPLUs(db, labelScale, full, &run)
+
+	// Work out the outcome and record it
+	run.FinishedAt = time.Now()
+	switch {
+	case err == nil && run.Failed == 0:
+		run.Status = "ok"
+	case run.Sent > 0 || run.Deleted > 0:
+		run.Status = "partial"
+	default:
+		run.Status = "failed"
+	}
+	if err != nil {
+		run.Error = err.Error()
+	} else if run.Failed > 0 {
+		run.Error = fmt.Sprintf("%d PLUs refused by the scale", run.Failed)
+	}
+
+	db.Create(&run)
+	db.Model(&models.LabelScale{}).Where("id = ?", labelScale.ID).Updates(map[string]interface{}{
+		"last_sync_at":     run.FinishedAt,
+		"last_sync_status": run.Status,
+	})
+
+	if err == nil && run.Failed > 0 {
+		err = scale.ErrNAK
+	}
+	return run, err
+}
+
+// pushChangedPLUs does the actual diff and network work, counting into 'run'
+func pushChangedPLUs(db *gorm.DB, labelScale models.LabelScale, full bool, run *models.ScaleSyncLog) error {
+	// 1. What the scale should have vs what it last acknowledged
+	records, err := WeighablePLURecords(db)
+	if err != nil {
+		return fmt.Errorf("failed to load weighable products: %v", err)
+	}
+
+	var states []models.ScalePLUState
+	if err := db.Where("scale_id = ?", labelScale.ID).Find(&states).Error; err != nil {
+		return fmt.Errorf("failed to load sync state: %v", err)
+	}
+	synced := make(map[string]models.ScalePLUState, len(states))
+	for _, s := range states {
+		synced[s.ItemCode] = s
+	}
+
+	// 2. Diff: changed/new PLUs to write, vanished PLUs to delete. A scale addresses a PLU by its
+	// (PLU number, department), so an address some current record now occupies is never deleted:
+	// the write that lands there replaces whatever the scale held.
+	type address struct{ hotkey, department int }
+	occupied := make(map[address]bool, len(records))
+	current := make(map[string]bool, len(records))
+	for _, r := range records {
+		occupied[address{r.Hotkey, r.Department}] = true
+		current[r.ItemCode] = true
+	}
+
+	var toWrite []scale.PLURecord
+	moved := map[string]scale.PLURecord{} // Item code -> the address it must be cleared from before it is written
+	for _, r := range records {
+		state, known := synced[r.ItemCode]
+		if !full && known && state.Hash == scale.Fingerprint(r) {
+			run.Unchanged++
+			continue
+		}
+		toWrite = append(toWrite, r)
+		if known && (state.Hotkey != r.Hotkey || state.Department != r.Department) && !occupied[address{state.Hotkey, state.Department}] {
+			moved[r.ItemCode] = scale.PLURecord{ItemCode: r.ItemCode, Hotkey: state.Hotkey, Department: state.Department}
+		}
+	}
+	var toDelete []scale.PLURecord
+	for _, s := range states {
+		if current[s.ItemCode] {
+			continue
+		}
+		if occupied[address{s.Hotkey, s.Department}] {
+			// Its slot now belongs to another product: only the bookkeeping goes
+			if err := db.Delete(&s).Error; err != nil {
+				return fmt.Errorf("failed to save sync state: %v", err)
+			}
+			continue
+		}
+		toDelete = append(toDelete, scale.PLURecord{ItemCode: s.ItemCode, Hotkey: s.Hotkey, Department: s.Department})
+	}
+
+	if len(toWrite) == 0 && len(toDelete) == 0 {
+		return nil // Scale is already up to date, no need to connect
+	}
+
+	// 3. Talk to the scale in its own protocol
+	client, err := DialScale(labelScale, scaleDialTimeout)
+	if err != nil {
+		run.Failed = len(toWrite) + len(toDelete)
+		return err
+	}
+	defer client.Close()
+
+	// 4. Writes. A NAK only fails that PLU; a broken connection stops the run
+	// (whatever wasn't acknowledged stays "changed" and goes out next time).
+	// A PLU that moved is cleared from its old address first; if that fails it isn't written, so the
+	// remembered state still points at the old address and the move is retried as a whole next time.
+	for i, r := range toWrite {
+		if old, ok := moved[r.ItemCode]; ok {
+			if err := client.DeletePLU(old); err != nil {
+				if errors.Is(err, scale.ErrNAK) {
+					run.Failed++
+					continue
+				}
+				run.Failed += len(toWrite) - i + len(toDelete)
+				return fmt.Errorf("connection lost while moving PLU %s: %v", r.ItemCode, err)
+			}
+		}
+		if err := client.WritePLU(r); err != nil {
+			if errors.Is(err, scale.ErrNAK) {
+				run.Failed++
+				continue
+			}
+			run.Failed += len(toWrite) - i + len(toDelete)
+			return fmt.Errorf("connection lost while sending PLU %s: %v", r.ItemCode, err)
+		}
+
+		state := models.ScalePLUState{ScaleID: labelScale.ID, ItemCode: r.ItemCode, Hotkey: r.Hotkey, Department: r.Department,
+			Hash: scale.Fingerprint(r), SyncedAt: time.Now()}
+		if err := db.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "scale_id"}, {Name: "item_code"}},
+			DoUpdates: clause.AssignmentColumns([]string{"hotkey", "department", "hash", "synced_at"}),
+		}).Create(&state).Error; err != nil {
+			return fmt.Errorf("failed to save sync state: %v", err)
+		}
+		run.Sent++
+	}
+
+	// 5. Deletions
+	for i, r := range toDelete {
+		if err := client.DeletePLU(r); err != nil {
+			if errors.Is(err, scale.ErrNAK) {
+				run.Failed++
+				continue
+			}
+			run.Failed += len(toDelete) - i
+			return fmt.Errorf("connection lost while deleting PLU %s: %v", r.ItemCode, err)
+		}
+		db.Where("scale_id = ? AND item_code = ?", labelScale.ID, r.ItemCode).Delete(&models.ScalePLUState{})
+		run.Deleted++
+	}
+
+	return nil
+}
+
+// DialScale opens a session with a scale in the protocol it was registered with
+func DialScale(labelScale models.LabelScale, timeout time.Duration) (scale.PLUSession, error) {
+	protocol, err := scale.GetNetworkExporter(labelScale.Protocol)
+	if err != nil {
+		return nil, err
+	}
+	address := fmt.Sprintf("%s:%d", labelScale.Host, labelScale.Port)
+	session, err := protocol.Dial(address, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("cannot reach scale at %s: %v", address, err)
+	}
+	return session, nil
+}
+
+// TriggerScaleSync pushes changes in the background to every active scale opted in to auto-sync.
+// Called after anything that can change a weighable's PLU (price updates, edits, imports, archiving),
+// so callers never wait on the network.
+func TriggerScaleSync(db *gorm.DB, trigger string) {
+	go func() {
+		var scales []models.LabelScale
+		if err := db.Where("is_active = ? AND auto_sync = ?", true, true).Find(&scales).Error; err != nil || len(scales) == 0 {
+			return
+		}
+
+		for _, labelScale := range scales {
+			run, err := SyncScale(db, labelScale, trigger, false)
+			if err != nil {
+				log.Printf("❌ SCALE SYNC: %s (%s): %v", labelScale.Name, trigger, err)
+				continue
+			}
+			if run.Sent > 0 || run.Deleted > 0 {
+				log.Printf("⚖️ SCALE SYNC: %s: %d sent, %d deleted (%s)", labelScale.Name, run.Sent, run.Deleted, trigger)
+			}
+		}
+	}()
+}
@@ -0,0 +1,213 @@
+package services
+
+import (
+	"net"
+	"testing"
+
+	"go-pos-agent/internal/models"
+	"go-pos-agent/internal/scale"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// scaleSyncFixture is an in-memory catalogue and one registered scale that points at a stand-in on a free local port
+func scaleSyncFixture(t *testing.T, standIn *scale.StandIn) (*gorm.DB, models.LabelScale) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1) // One connection, one in-memory database
+	if err := db.AutoMigrate(&models.Product{}, &models.LabelScale{}, &models.ScalePLUState{}, &models.ScaleSyncLog{}); err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go standIn.Serve(listener)
+
+	addr := listener.Addr().(*net.TCPAddr)
+	labelScale := models.LabelScale{Name: "Deli", Host: "127.0.0.1", Port: addr.Port, Protocol: "cas", IsActive: true}
+	if err := db.Create(&labelScale).Error; err != nil {
+		t.Fatal(err)
+	}
+	return db, labelScale
+}
+
+func TestSyncScaleSendsOnlyChanges(t *testing.T) {
+	standIn := scale.NewStandIn(0)
+	db, labelScale := scaleSyncFixture(t, standIn)
+
+	products := []models.Product{
+		{SKU: "00007", Name: "Ayam", Price: 12.9, IsWeighable: true, ScaleDepartment: 21},
+		{SKU: "00008", Name: "Ikan", Price: 18, IsWeighable: true, ScaleDepartment: 21},
+		{SKU: "9555", Name: "Not weighed", Price: 3},
+	}
+	if err := db.Create(&products).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// 1. First sync sends everything weighable
+	run, err := SyncScale(db, labelScale, "test", false)
+	if err != nil || run.Sent != 2 || run.Status != "ok" {
+		t.Fatalf("first sync: %+v, %v", run, err)
+	}
+
+	// 2. Nothing changed: nothing sent
+	run, err = SyncScale(db, labelScale, "test", false)
+	if err != nil || run.Sent != 0 || run.Unchanged != 2 {
+		t.Fatalf("second sync: %+v, %v", run, err)
+	}
+
+	// 3. A price change sends that PLU only; an archived product is deleted from the scale
+	db.Model(&products[0]).Update("price", 13.5)
+	db.Model(&products[1]).Update("is_archived", true)
+	run, err = SyncScale(db, labelScale, "test", false)
+	if err != nil || run.Sent != 1 || run.Deleted != 1 || run.Unchanged != 0 {
+		t.Fatalf("third sync: %+v, %v", run, err)
+	}
+
+	plus := standIn.PLUs()
+	if len(plus) != 1 || plus[0].ItemCode != "00007" || plus[0].UnitPrice != 13.5 || plus[0].Hotkey != 7 {
+		t.Fatalf("scale holds %+v", plus)
+	}
+
+	var logs int64
+	db.Model(&models.ScaleSyncLog{}).Where("scale_id = ?", labelScale.ID).Count(&logs)
+	if logs != 3 {
+		t.Fatalf("%d sync logs, want 3", logs)
+	}
+}
+
+func TestSyncScaleRetriesRefusedPLUs(t *testing.T) {
+	standIn := scale.NewStandIn(0, "00008")
+	db, labelScale := scaleSyncFixture(t, standIn)
+
+	db.Create(&[]models.Product{
+		{SKU: "00007", Name: "Ayam", Price: 12.9, IsWeighable: true},
+		{SKU: "00008", Name: "Ikan", Price: 18, IsWeighable: true},
+	})
+
+	run, err := SyncScale(db, labelScale, "test", false)
+	if err == nil || run.Status != "partial" || run.Sent != 1 || run.Failed != 1 {
+		t.Fatalf("sync with a refusal: %+v, %v", run, err)
+	}
+
+	// The scale takes it now: only the refused PLU goes out again
+	delete(standIn.Refuse, "00008")
+	run, err = SyncScale(db, labelScale, "test", false)
+	if err != nil || run.Sent != 1 || run.Unchanged != 1 {
+		t.Fatalf("retry: %+v, %v", run, err)
+	}
+}
+
+func TestSyncScaleUnreachable(t *testing.T) {
+	standIn := scale.NewStandIn(0)
+	db, labelScale := scaleSyncFixture(t, standIn)
+	db.Create(&models.Product{SKU: "00007", Name: "Ayam", Price: 12.9, IsWeighable: true})
+
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	labelScale.Port = listener.Addr().(*net.TCPAddr).Port
+	listener.Close() // Nobody listens there any more
+
+	run, err := SyncScale(db, labelScale, "test", false)
+	if err == nil || run.Status != "failed" || run.Failed != 1 {
+		t.Fatalf("unreachable scale: %+v, %v", run, err)
+	}
+}
+
+func TestSyncScaleKeepsPLUNumbersOfNonNumericSKUs(t *testing.T) {
+	standIn := scale.NewStandIn(0)
+	db, labelScale := scaleSyncFixture(t, standIn)
+
+	products := []models.Product{
+		{SKU: "AYAM", Name: "Ayam", Price: 12.9, IsWeighable: true, ScaleDepartment: 21},
+		{SKU: "IKAN", Name: "Ikan", Price: 18, IsWeighable: true, ScaleDepartment: 21},
+	}
+	db.Create(&products)
+	if _, err := SyncScale(db, labelScale, "test", false); err != nil {
+		t.Fatal(err)
+	}
+
+	// holds returns item code -> PLU number on the stand-in
+	holds := func() map[string]int {
+		plus := map[string]int{}
+		for _, r := range standIn.PLUs() {
+			plus[r.ItemCode] = r.Hotkey
+		}
+		return plus
+	}
+
+	// 1. Archiving AYAM deletes it and leaves IKAN where it was
+	db.Model(&products[0]).Update("is_archived", true)
+	run, err := SyncScale(db, labelScale, "test", false)
+	if err != nil || run.Deleted != 1 || run.Sent != 0 {
+		t.Fatalf("sync after archive: %+v, %v", run, err)
+	}
+	if plus := holds(); len(plus) != 1 || plus["IKAN"] != 2 {
+		t.Fatalf("after archive the scale holds %v, want IKAN at 2", plus)
+	}
+
+	// 2. A new product doesn't take the archived product's number
+	bawang := models.Product{SKU: "BAWANG", Name: "Bawang", Price: 6, IsWeighable: true, ScaleDepartment: 21}
+	db.Create(&bawang)
+	if _, err := SyncScale(db, labelScale, "test", false); err != nil {
+		t.Fatal(err)
+	}
+	if plus := holds(); plus["IKAN"] != 2 || plus["BAWANG"] != 3 {
+		t.Fatalf("after adding BAWANG the scale holds %v", plus)
+	}
+
+	// 3. Restoring AYAM brings it back at its own number, nothing else moves
+	db.Model(&products[0]).Update("is_archived", false)
+	run, err = SyncScale(db, labelScale, "test", false)
+	if err != nil || run.Sent != 1 || run.Deleted != 0 {
+		t.Fatalf("sync after restore: %+v, %v", run, err)
+	}
+	if plus := holds(); len(plus) != 3 || plus["AYAM"] != 1 || plus["IKAN"] != 2 || plus["BAWANG"] != 3 {
+		t.Fatalf("after restore the scale holds %v", plus)
+	}
+
+	// 4. Moving IKAN to another department clears its old address
+	db.Model(&products[1]).Update("scale_department", 22)
+	if _, err := SyncScale(db, labelScale, "test", false); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range standIn.PLUs() {
+		if r.ItemCode == "IKAN" && r.Department != 22 {
+			t.Fatalf("IKAN left behind in department %d", r.Department)
+		}
+	}
+	if len(standIn.PLUs()) != 3 {
+		t.Fatalf("scale holds %+v, want 3 PLUs", standIn.PLUs())
+	}
+}
+
+func TestSyncScaleNeverDeletesAnOccupiedAddress(t *testing.T) {
+	standIn := scale.NewStandIn(0)
+	db, labelScale := scaleSyncFixture(t, standIn)
+
+	ayam := models.Product{SKU: "AYAM", Name: "Ayam", Price: 12.9, IsWeighable: true, ScaleDepartment: 21}
+	db.Create(&ayam)
+	if _, err := SyncScale(db, labelScale, "test", false); err != nil {
+		t.Fatal(err)
+	}
+
+	// AYAM goes; a product keyed in by number takes its slot
+	db.Model(&ayam).Update("is_archived", true)
+	db.Create(&models.Product{SKU: "00001", Name: "Daging", Price: 45, IsWeighable: true, ScaleDepartment: 21})
+	run, err := SyncScale(db, labelScale, "test", false)
+	if err != nil || run.Sent != 1 || run.Deleted != 0 {
+		t.Fatalf("sync: %+v, %v", run, err)
+	}
+	plus := standIn.PLUs()
+	if len(plus) != 1 || plus[0].ItemCode != "00001" || plus[0].Hotkey != 1 {
+		t.Fatalf("scale holds %+v, want only 00001 at 1", plus)
+	}
+}
@@ -1,55 +1,103 @@
 package utils
 
 import (
+	"errors"
+	"math"
 	"strconv"
-	"strings"
 )
 
+// ErrBadCheckDigit means the scanner misread the label: the 13th digit doesn't match the other 12
+var ErrBadCheckDigit = errors.New("barcode check digit does not match (misread)")
+
+// ScaleBarcodeLayout describes how a scale packs data into an EAN-13:
+// [2-digit prefix][item code][value][check digit]. The value fills whatever digits the item code leaves.
+type ScaleBarcodeLayout struct {
+	Name           string
+	PrefixFrom     int    // e.g. 20
+	PrefixTo       int    // e.g. 21 (inclusive)
+	ItemCodeLength int    // Digits after the prefix that identify the product (usually 5)
+	ValueType      string // "price" (RM) or "weight" (kg)
+	Decimals       int    // Implied decimal places in the value (e.g. 2 for "01550" = 15.50)
+}
+
+// DefaultScaleBarcodeLayout is the classic 20/21 price-embedded label (5-digit item, RM with 2 decimals)
+var DefaultScaleBarcodeLayout = ScaleBarcodeLayout{
+	Name:           "Price-embedded (20-21)",
+	PrefixFrom:     20,
+	PrefixTo:       21,
+	ItemCodeLength: 5,
+	ValueType:      "price",
+	Decimals:       2,
+}
+
 // ScaleBarcodeData holds the extracted information from a smart scale barcode.
 type ScaleBarcodeData struct {
 	IsScaleBarcode  bool
-	ItemID          string  // The 5-digit internal SKU/Identifier (e.g., "00123")
+	ItemID          string  // The internal SKU/Identifier (e.g., "00123")
 	CalculatedPrice float64 // The embedded exact price or weight value
+	ValueType       string  // "price" or "weight"
+	Layout          string  // Name of the layout that matched
 }
 
-// ParseEAN13 inspects a barcode string to see if it was generated by a deli/produce scale.
-// If it is a scale barcode, it slices the string to extract the Item ID and the Value.
+// ParseEAN13 inspects a barcode string using the default 20/21 price-embedded layout.
+// Kept for callers that don't have the store's configured layouts at hand.
 func ParseEAN13(barcode string) ScaleBarcodeData {
+	data, err := ParseScaleBarcode(barcode, []ScaleBarcodeLayout{DefaultScaleBarcodeLayout})
+	if err != nil {
+		return ScaleBarcodeData{IsScaleBarcode: false}
+	}
+	return data
+}
+
+// ParseScaleBarcode checks a barcode against the store's scale layouts. It returns IsScaleBarcode=false
+// for ordinary product barcodes, and ErrBadCheckDigit when a scale-range code fails its checksum
+// (a misread must never be charged as a different price or weight).
+func ParseScaleBarcode(barcode string, layouts []ScaleBarcodeLayout) (ScaleBarcodeData, error) {
 	// 1. Length Check: Standard EAN-13 barcodes must be exactly 13 digits.
 	if len(barcode) != 13 {
-		return ScaleBarcodeData{IsScaleBarcode: false}
+		return ScaleBarcodeData{IsScaleBarcode: false}, nil
+	}
+	prefix, err := strconv.Atoi(barcode[:2])
+	if err != nil {
+		return ScaleBarcodeData{IsScaleBarcode: false}, nil
 	}
 
-	// 2. Prefix Check: In-store commercial scales typically use prefixes 20 or 21.
-	if strings.HasPrefix(barcode, "20") || strings.HasPrefix(barcode, "21") {
+	// 2. Prefix Check: find the layout that owns this prefix
+	for _, layout := range layouts {
+		if prefix < layout.PrefixFrom || prefix > layout.PrefixTo {
+			continue
+		}
+
+		// 3. Checksum: reject misreads before trusting any embedded value
+		if !IsValidEAN13(barcode) {
+			return ScaleBarcodeData{}, ErrBadCheckDigit
+		}
 
-		// 3. Mathematical Slicing:
-		// Index 0-1: Prefix (e.g., "20")
-		// Index 2-6: Item ID (5 digits)
-		// Index 7-11: Price/Weight Value (5 digits)
-		// Index 12: Checksum (1 digit)
-		itemID := barcode[2:7]
-		valueStr := barcode[7:12]
+		// 4. Slicing:
+		// Index 0-1: Prefix, then the item code, then the value, Index 12: Checksum
+		itemEnd := 2 + layout.ItemCodeLength
+		if layout.ItemCodeLength < 1 || itemEnd >= 12 {
+			continue
+		}
+		itemID := barcode[2:itemEnd]
+		valueStr := barcode[itemEnd:12]
 
-		// 4. Value Conversion:
-		// The scale encodes the value as an integer (e.g., "01550" represents RM 15.50).
-		// We convert the string to an integer, then divide by 100 to get the float representation.
+		// 5. Value Conversion: the scale encodes the value as an integer with implied decimals
+		// (e.g., "01550" with 2 decimals represents RM 15.50, "01250" with 3 decimals is 1.250 kg).
 		valueInt, err := strconv.Atoi(valueStr)
 		if err != nil {
-			// If the value isn't a valid number, fail gracefully.
-			return ScaleBarcodeData{IsScaleBarcode: false}
+			return ScaleBarcodeData{IsScaleBarcode: false}, nil
 		}
 
-		calculatedPrice := float64(valueInt) / 100.0
-
-		// Return the successfully extracted data.
 		return ScaleBarcodeData{
 			IsScaleBarcode:  true,
 			ItemID:          itemID,
-			CalculatedPrice: calculatedPrice,
-		}
+			CalculatedPrice: float64(valueInt) / math.Pow10(layout.Decimals),
+			ValueType:       layout.ValueType,
+			Layout:          layout.Name,
+		}, nil
 	}
 
-	// If it doesn't start with 20 or 21, it's just a regular pre-packaged product barcode.
-	return ScaleBarcodeData{IsScaleBarcode: false}
+	// If no layout claims the prefix, it's just a regular pre-packaged product barcode.
+	return ScaleBarcodeData{IsScaleBarcode: false}, nil
 }
@@ -0,0 +1,80 @@
+package utils
+
+import "bytes"
+
+// ESCPOSBuilder assembles a raw ESC/POS job (the same byte language as the drawer kick command)
+// so it can be copied straight to a thermal receipt or label printer.
+type ESCPOSBuilder struct {
+	buf bytes.Buffer
+}
+
+// NewESCPOSBuilder starts a job with the printer reset (ESC @)
+func NewESCPOSBuilder() *ESCPOSBuilder {
+	b := &ESCPOSBuilder{}
+	b.buf.Write([]byte{0x1B, 0x40})
+	return b
+}
+
+// Align sets justification: 0 = left, 1 = centre, 2 = right (ESC a n)
+func (b *ESCPOSBuilder) Align(n byte) *ESCPOSBuilder {
+	b.buf.Write([]byte{0x1B, 0x61, n})
+	return b
+}
+
+// Bold toggles emphasised printing (ESC E n)
+func (b *ESCPOSBuilder) Bold(on bool) *ESCPOSBuilder {
+	var n byte
+	if on {
+		n = 1
+	}
+	b.buf.Write([]byte{0x1B, 0x45, n})
+	return b
+}
+
+// Size sets the character magnification, 1-8 in each direction (GS ! n)
+func (b *ESCPOSBuilder) Size(width, height byte) *ESCPOSBuilder {
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+	b.buf.Write([]byte{0x1D, 0x21, (width-1)<<4 | (height - 1)})
+	return b
+}
+
+// Line prints the text followed by a line feed
+func (b *ESCPOSBuilder) Line(text string) *ESCPOSBuilder {
+	b.buf.WriteString(text)
+	b.buf.WriteByte(0x0A)
+	return b
+}
+
+// Feed advances the paper by n lines (ESC d n)
+func (b *ESCPOSBuilder) Feed(lines byte) *ESCPOSBuilder {
+	b.buf.Write([]byte{0x1B, 0x64, lines})
+	return b
+}
+
+// BarcodeEAN13 prints an EAN-13 with its digits underneath.
+// The printer computes the bars itself; we only send the 13 digits (GS k 67 n d1...dn).
+func (b *ESCPOSBuilder) BarcodeEAN13(code string) *ESCPOSBuilder {
+	b.buf.Write([]byte{0x1D, 0x68, 80}) // GS h: bar height in dots
+	b.buf.Write([]byte{0x1D, 0x77, 2})  // GS w: module width
+	b.buf.Write([]byte{0x1D, 0x48, 2})  // GS H: human readable digits below
+	b.buf.Write([]byte{0x1D, 0x6B, 67, byte(len(code))})
+	b.buf.WriteString(code)
+	b.buf.WriteByte(0x0A)
+	return b
+}
+
+// Cut performs a partial cut after feeding the label clear of the head (GS V 66 n)
+func (b *ESCPOSBuilder) Cut() *ESCPOSBuilder {
+	b.buf.Write([]byte{0x1D, 0x56, 66, 3})
+	return b
+}
+
+// Bytes returns the finished job
+func (b *ESCPOSBuilder) Bytes() []byte {
+	return b.buf.Bytes()
+}
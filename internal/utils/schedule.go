@@ -0,0 +1,21 @@
+package utils
+
+import "time"
+
+// nextDailyRun is the next time the clock reads hour:minute (local), strictly after 'now'
+func nextDailyRun(now time.Time, hour, minute int) time.Time {
+	next := time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// RunDailyAt calls job every day at hour:minute local time, for jobs that must see a finished day
+// (a ticker started with the process would drift to whenever the server happened to boot). Never returns.
+func RunDailyAt(hour, minute int, job func()) {
+	for {
+		time.Sleep(time.Until(nextDailyRun(time.Now(), hour, minute)))
+		job()
+	}
+}